@@ -0,0 +1,423 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sahilrush/src/client"
+	"github.com/sahilrush/src/models"
+)
+
+func userCmd(c *cli, args []string) error {
+	if len(args) != 2 || args[0] != "create" {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	balance, err := c.api.CreateUser(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	return c.print(balance, func(w io.Writer) {
+		fmt.Fprintf(w, "created user %s\n", args[1])
+	})
+}
+
+func balanceCmd(c *cli, args []string) error {
+	if len(args) > 1 {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	if len(args) == 1 {
+		balance, err := c.api.Balance(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return c.print(balance, func(w io.Writer) {
+			printBalances(w, map[string]models.UserBalance{args[0]: balance})
+		})
+	}
+
+	balances, err := c.api.Balances(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(balances, func(w io.Writer) { printBalances(w, balances) })
+}
+
+func holdingsCmd(c *cli, args []string) error {
+	flags := flag.NewFlagSet("holdings", flag.ContinueOnError)
+	symbol := flags.String("symbol", "", "only this market")
+	args, err := c.parse(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	stocks, err := c.api.Stocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	held := models.Stock{}
+	for market, users := range stocks {
+		if *symbol != "" && market != *symbol {
+			continue
+		}
+		for userId, outcomes := range users {
+			if len(args) == 1 && userId != args[0] {
+				continue
+			}
+			if held[market] == nil {
+				held[market] = models.User{}
+			}
+			held[market][userId] = outcomes
+		}
+	}
+	return c.print(held, func(w io.Writer) { printHoldings(w, held) })
+}
+
+func portfolioCmd(c *cli, args []string) error {
+	if len(args) != 1 {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	portfolio, err := c.api.Portfolio(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(portfolio, func(w io.Writer) { printPortfolio(w, portfolio) })
+}
+
+func onrampCmd(c *cli, args []string) error {
+	if len(args) != 2 {
+		return c.usageErr()
+	}
+	amount, err := strconv.Atoi(args[1])
+	if err != nil {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	intent, err := c.api.Onramp(ctx, args[0], amount)
+	if err != nil {
+		return err
+	}
+	return c.print(intent, func(w io.Writer) {
+		fmt.Fprintf(w, "deposit %s of %d for %s is %s\n", intent.ID, intent.Amount, intent.UserId, intent.Status)
+		if intent.CheckoutURL != "" {
+			fmt.Fprintf(w, "pay at %s\n", intent.CheckoutURL)
+		}
+	})
+}
+
+func marketCmd(c *cli, args []string) error {
+	if len(args) == 0 {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	switch args[0] {
+	case "create":
+		c.usage = "market create [-amm liquidity] [-amm-funded-by creator|platform] <userId> <symbol>"
+		flags := flag.NewFlagSet("market create", flag.ContinueOnError)
+		seed := models.MakerSeed{}
+		flags.Float64Var(&seed.Liquidity, "amm", 0, "seed an LMSR market maker with this liquidity")
+		flags.StringVar(&seed.FundedBy, "amm-funded-by", "", "who puts up the maker's subsidy, creator by default")
+		args, err := c.parse(flags, args[1:], 2, 2)
+		if err != nil {
+			return err
+		}
+
+		var book models.Pricing
+		if seed.Liquidity != 0 {
+			book, err = c.api.CreateMarketWithMaker(ctx, args[0], args[1], seed)
+		} else {
+			book, err = c.api.CreateMarket(ctx, args[0], args[1])
+		}
+		if err != nil {
+			return err
+		}
+		return c.print(book, func(w io.Writer) {
+			fmt.Fprintf(w, "created market %s, %s holds the initial shares\n", args[1], args[0])
+			if seed.Liquidity != 0 {
+				fmt.Fprintf(w, "seeded a market maker with liquidity %g\n", seed.Liquidity)
+			}
+		})
+	case "resolve":
+		c.usage = "market resolve <symbol> <yes|no>"
+		if len(args) != 3 {
+			return c.usageErr()
+		}
+		resolution, err := c.api.ResolveMarket(ctx, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		return c.print(resolution, func(w io.Writer) { printResolution(w, args[1], resolution) })
+	}
+	return c.usageErr()
+}
+
+func orderCmd(c *cli, args []string) error {
+	if len(args) == 0 {
+		return c.usageErr()
+	}
+
+	switch args[0] {
+	case "place":
+		c.usage = "order place [-type limit|market] [-client-id id] <userId> <symbol> <buy|sell> <yes|no> <quantity> [price]"
+		return placeCmd(c, args[1:])
+	case "cancel":
+		c.usage = "order cancel <userId> <orderId>"
+		if len(args) != 3 {
+			return c.usageErr()
+		}
+		ctx, cancel := c.context()
+		defer cancel()
+		order, err := c.api.CancelOrder(ctx, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		return c.print(order, func(w io.Writer) { printOrder(w, order) })
+	case "get":
+		c.usage = "order get <orderId>"
+		if len(args) != 2 {
+			return c.usageErr()
+		}
+		ctx, cancel := c.context()
+		defer cancel()
+		order, err := c.api.Order(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return c.print(order, func(w io.Writer) { printOrder(w, order) })
+	}
+	return c.usageErr()
+}
+
+func placeCmd(c *cli, args []string) error {
+	flags := flag.NewFlagSet("order place", flag.ContinueOnError)
+	orderType := flags.String("type", models.OrderLimit, "limit or market")
+	clientOrderId := flags.String("client-id", "", "client order ID, usable once per user")
+	args, err := c.parse(flags, args, 5, 6)
+	if err != nil {
+		return err
+	}
+
+	req := models.OrderRequest{
+		UserId:        args[0],
+		Symbol:        args[1],
+		Side:          args[2],
+		Outcome:       args[3],
+		Type:          *orderType,
+		ClientOrderId: *clientOrderId,
+	}
+	if req.Quantity, err = strconv.Atoi(args[4]); err != nil {
+		return c.usageErr()
+	}
+	if len(args) == 6 {
+		if req.Price, err = strconv.Atoi(args[5]); err != nil {
+			return c.usageErr()
+		}
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	order, err := c.api.PlaceOrder(ctx, req)
+	if err != nil {
+		return err
+	}
+	return c.print(order, func(w io.Writer) { printOrder(w, order) })
+}
+
+func ordersCmd(c *cli, args []string) error {
+	flags := flag.NewFlagSet("orders", flag.ContinueOnError)
+	symbol := flags.String("symbol", "", "only orders in this market")
+	status := flags.String("status", "", "open, partially_filled, filled or cancelled")
+	args, err := c.parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	orders, err := c.api.Orders(ctx, client.OrderFilter{UserId: args[0], Symbol: *symbol, Status: *status})
+	if err != nil {
+		return err
+	}
+	return c.print(orders, func(w io.Writer) { printOrders(w, orders) })
+}
+
+func bookCmd(c *cli, args []string) error {
+	if len(args) != 1 {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	book, err := c.api.Orderbook(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(book, func(w io.Writer) { printLadder(w, args[0], book) })
+}
+
+func candlesCmd(c *cli, args []string) error {
+	flags := flag.NewFlagSet("candles", flag.ContinueOnError)
+	filter := client.CandleFilter{}
+	flags.StringVar(&filter.Interval, "interval", "", "1m, 5m, 1h or 1d")
+	flags.StringVar(&filter.Outcome, "outcome", "", "yes or no")
+	from := flags.String("from", "", "earliest candle, RFC 3339 or a duration back from now like 24h")
+	to := flags.String("to", "", "latest candle, RFC 3339 or a duration back from now")
+	args, err := c.parse(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if filter.From, err = when(*from); err != nil {
+		return c.usageErr()
+	}
+	if filter.To, err = when(*to); err != nil {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	series, err := c.api.Candles(ctx, args[0], filter)
+	if err != nil {
+		return err
+	}
+	return c.print(series, func(w io.Writer) { printCandles(w, series) })
+}
+
+// when reads an RFC 3339 time or a duration before now, empty is the zero time
+func when(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func tickersCmd(c *cli, args []string) error {
+	if len(args) != 0 {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	all, err := c.api.Tickers(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(all, func(w io.Writer) { printTickers(w, all) })
+}
+
+func ammCmd(c *cli, args []string) error {
+	if len(args) != 1 {
+		return c.usageErr()
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	status, err := c.api.MarketMaker(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(status, func(w io.Writer) { printMaker(w, status) })
+}
+
+// tradesCmd prints the most recent trades; with -follow it then polls for
+// newer ones until interrupted, using the last trade ID as the cursor
+func tradesCmd(c *cli, args []string) error {
+	flags := flag.NewFlagSet("trades", flag.ContinueOnError)
+	symbol := flags.String("symbol", "", "only trades in this market")
+	limit := flags.Int("limit", 20, "number of recent trades to print first")
+	follow := flags.Bool("follow", false, "keep printing new trades")
+	interval := flags.Duration("interval", time.Second, "how often -follow polls")
+	if _, err := c.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	filter := client.TradeFilter{Symbol: *symbol, Limit: *limit}
+	ctx, cancel := c.context()
+	trades, err := c.api.Trades(ctx, filter)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := c.printTrades(trades, !*follow); err != nil {
+		return err
+	}
+	if !*follow {
+		return nil
+	}
+
+	stop, cancelStop := interrupted()
+	defer cancelStop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	filter.Limit = 1000
+	for {
+		if len(trades) > 0 {
+			filter.After = trades[len(trades)-1].ID
+		}
+		select {
+		case <-stop.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		ctx, cancel := c.context()
+		trades, err = c.api.Trades(ctx, filter)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if err := c.printTrades(trades, false); err != nil {
+			return err
+		}
+	}
+}
+
+// printTrades writes trades as a table, or in JSON mode as a list, or one
+// trade per line while following
+func (c *cli) printTrades(trades []models.Trade, list bool) error {
+	if !c.json {
+		printTradeRows(c.out, trades)
+		return nil
+	}
+	if list {
+		return c.print(trades, nil)
+	}
+	for _, trade := range trades {
+		if err := c.print(trade, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
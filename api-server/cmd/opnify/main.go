@@ -0,0 +1,179 @@
+// Command opnify drives the Opnify API from a terminal or a script.
+//
+//	opnify market create alice ELECTION
+//	opnify order place alice ELECTION sell yes 10 6
+//	opnify book ELECTION
+//	opnify -json trades -follow -symbol ELECTION
+//
+// Every command talks to the REST API through the client package. With -json
+// the data of each reply is printed as JSON, one document per line, and
+// errors are printed to stderr as the API's error object.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/client"
+)
+
+// command is one subcommand, run gets the arguments after its name
+type command struct {
+	usage   string
+	summary string
+	run     func(cli *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"user":      {"user create <userId>", "create a user", userCmd},
+	"balance":   {"balance [userId]", "INR balance of a user, or of every user", balanceCmd},
+	"holdings":  {"holdings [-symbol symbol] [userId]", "YES/NO shares held, by market and user", holdingsCmd},
+	"portfolio": {"portfolio <userId>", "positions with average price, value and PnL", portfolioCmd},
+	"onramp":    {"onramp <userId> <amount>", "open a deposit intent and print its checkout URL", onrampCmd},
+	"market":    {"market create|resolve ...", "create or resolve a market", marketCmd},
+	"order":     {"order place|cancel|get ...", "place, cancel or look up an order", orderCmd},
+	"orders":    {"orders [-symbol symbol] [-status status] <userId>", "orders of a user, oldest first", ordersCmd},
+	"book":      {"book <symbol>", "order book of a market as a price ladder", bookCmd},
+	"candles":   {"candles [-interval i] [-outcome o] [-from t] [-to t] <symbol>", "OHLCV candles of a market", candlesCmd},
+	"tickers":   {"tickers", "last price, quotes, 24h volume and open interest of every market", tickersCmd},
+	"amm":       {"amm <symbol>", "prices, quotes, subsidy and PnL of a market's market maker", ammCmd},
+	"trades":    {"trades [-symbol symbol] [-limit n] [-follow] [-interval d]", "recent trades, -follow keeps printing new ones", tradesCmd},
+}
+
+// cli carries the global flags and the client to every command
+type cli struct {
+	api     *client.Client
+	json    bool
+	timeout time.Duration
+	key     string
+	out     io.Writer
+	usage   string
+}
+
+func main() {
+	flags := flag.NewFlagSet("opnify", flag.ExitOnError)
+	flags.Usage = func() { usage(flags) }
+
+	baseURL := os.Getenv("OPNIFY_API")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	flags.StringVar(&baseURL, "api", baseURL, "base URL of the API server (OPNIFY_API)")
+	jsonOut := flags.Bool("json", false, "print replies as JSON")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of each request")
+	key := flags.String("idempotency-key", "", "send commands with this Idempotency-Key so a retry does not run them twice")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		usage(flags)
+		os.Exit(2)
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "opnify: unknown command %q\n\n", flags.Arg(0))
+		usage(flags)
+		os.Exit(2)
+	}
+
+	api := client.New(baseURL)
+	// Platform funded market makers need the operator's signature
+	api.OperatorSecret = os.Getenv("OPNIFY_OPERATOR_SECRET")
+	c := &cli{
+		api:     api,
+		json:    *jsonOut,
+		timeout: *timeout,
+		key:     *key,
+		out:     os.Stdout,
+		usage:   cmd.usage,
+	}
+	if err := cmd.run(c, flags.Args()[1:]); err != nil {
+		os.Exit(c.fail(err))
+	}
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: opnify [flags] <command> [args]\n\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-60s %s\n", commands[name].usage, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flags.PrintDefaults()
+}
+
+// errUsage marks a command called with the wrong arguments
+type errUsage string
+
+func (e errUsage) Error() string { return "usage: opnify " + string(e) }
+
+// fail prints an error and returns the exit code: 2 for usage errors, 1 for
+// everything else
+func (c *cli) fail(err error) int {
+	var usageErr errUsage
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(os.Stderr, usageErr)
+		return 2
+	}
+
+	var apiErr *apierr.Error
+	if c.json && errors.As(err, &apiErr) {
+		json.NewEncoder(os.Stderr).Encode(apiErr)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "opnify:", err)
+	return 1
+}
+
+// context returns the context of one request, carrying the idempotency key
+func (c *cli) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	if c.key != "" {
+		ctx = client.WithIdempotencyKey(ctx, c.key)
+	}
+	return ctx, cancel
+}
+
+// print writes data as JSON in JSON mode, otherwise calls text to write it
+// for people
+func (c *cli) print(data interface{}, text func(w io.Writer)) error {
+	if c.json {
+		return json.NewEncoder(c.out).Encode(data)
+	}
+	text(c.out)
+	return nil
+}
+
+// interrupted returns a context cancelled on Ctrl-C, for commands that run
+// until stopped
+func interrupted() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// usageErr reports that the running command got the wrong arguments
+func (c *cli) usageErr() error {
+	return errUsage(c.usage)
+}
+
+// parse parses the flags of the running command, which come before its
+// arguments, and checks the number of arguments left
+func (c *cli) parse(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() < min || flags.NArg() > max {
+		return nil, c.usageErr()
+	}
+	return flags.Args(), nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/client"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/services"
+	"github.com/sahilrush/src/transport"
+)
+
+var api *client.Client
+
+// TestMain runs the API server with the engine in process for the commands
+// to talk to
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "opnify-cli")
+	if err != nil {
+		panic(err)
+	}
+
+	cfg := config.Defaults()
+	cfg.Queue.Transport = "inproc"
+	cfg.RateLimit.Enabled = false
+	cfg.Engine.CommandLog = dir + "/commands.log"
+	cfg.Engine.SnapshotPath = dir + "/snapshot.json"
+	cfg.Payments.WebhookSecret = "cli-test-webhook-secret"
+	cfg.Payments.PayoutSecret = "cli-test-payout-secret"
+	cfg.Payments.PayoutProcessor = "fake"
+	cfg.Features.AutoBalance = true
+	config.Current = cfg
+	logging.Setup(io.Discard, "error", "text")
+	gin.SetMode(gin.TestMode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := transport.NewInProc()
+	health, err := services.NewHealth(ctx, t)
+	if err != nil {
+		panic(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- services.RunEngine(ctx, t) }()
+
+	server := httptest.NewServer(services.NewRouter(t, health, nil))
+	api = client.New(server.URL)
+
+	code := m.Run()
+
+	server.Close()
+	cancel()
+	<-done
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// output is a buffer a following command can write to while the test reads it
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// run runs a command line as main would after the global flags
+func run(out io.Writer, jsonOut bool, args ...string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return errors.New("unknown command " + args[0])
+	}
+	c := &cli{api: api, json: jsonOut, timeout: 5 * time.Second, out: out, usage: cmd.usage}
+	return cmd.run(c, args[1:])
+}
+
+// text runs a command and returns what it printed for people
+func text(t *testing.T, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run(&out, false, args...); err != nil {
+		t.Fatalf("opnify %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String()
+}
+
+// jsonOf runs a command in JSON mode and decodes what it printed into v
+func jsonOf(t *testing.T, v interface{}, args ...string) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run(&out, true, args...); err != nil {
+		t.Fatalf("opnify -json %s: %v", strings.Join(args, " "), err)
+	}
+	if err := json.Unmarshal(out.Bytes(), v); err != nil {
+		t.Fatalf("opnify -json %s printed %q: %v", strings.Join(args, " "), out.String(), err)
+	}
+}
+
+// TestSession runs the commands an operator would to open a market and trade it
+func TestSession(t *testing.T) {
+	if got := text(t, "user", "create", "cli-alice"); got != "created user cli-alice\n" {
+		t.Errorf("user create printed %q", got)
+	}
+	if got := text(t, "market", "create", "cli-alice", "CLIMKT"); got != "created market CLIMKT, cli-alice holds the initial shares\n" {
+		t.Errorf("market create printed %q", got)
+	}
+
+	var ask models.Order
+	jsonOf(t, &ask, "order", "place", "-client-id", "ask-1", "cli-alice", "CLIMKT", "sell", "yes", "10", "6")
+	if ask.ID == "" || ask.Status != models.OrderOpen || ask.Remaining != 10 || ask.ClientOrderId != "ask-1" {
+		t.Fatalf("placed ask %+v", ask)
+	}
+	bought := text(t, "order", "place", "cli-bob", "CLIMKT", "buy", "yes", "4", "6")
+	for _, want := range []string{"filled\n", "cli-bob buy 4 YES CLIMKT at 6\n", "filled 4, resting 0\n", "PRICE", "cli-alice"} {
+		if !strings.Contains(bought, want) {
+			t.Errorf("buy printed\n%s\nwithout %q", bought, want)
+		}
+	}
+
+	// The 6 YES left on offer are asks at 6, the same as bids for NO at 4
+	ladder := strings.Split(text(t, "book", "CLIMKT"), "\n")
+	if ladder[0] != "CLIMKT" || len(ladder) != models.ContractPrice+2 {
+		t.Fatalf("ladder\n%s", strings.Join(ladder, "\n"))
+	}
+	for i, row := range ladder[2 : len(ladder)-1] {
+		price := models.ContractPrice - 1 - i
+		fields := strings.Fields(row)
+		want := []string{itoa(price), itoa(models.ContractPrice - price)}
+		if price == 6 {
+			want = append(want, "6", strings.Repeat("#", 20))
+		}
+		if strings.Join(fields, " ") != strings.Join(want, " ") {
+			t.Errorf("ladder row for YES at %d is %q, want %q", price, row, strings.Join(want, " "))
+		}
+	}
+
+	var trades []models.Trade
+	jsonOf(t, &trades, "trades", "-symbol", "CLIMKT")
+	if len(trades) != 1 || trades[0].Quantity != 4 || trades[0].Price != 6 || trades[0].Buyer != "cli-bob" {
+		t.Errorf("trades %+v", trades)
+	}
+
+	cancelled := text(t, "order", "cancel", "cli-alice", ask.ID)
+	if !strings.HasPrefix(cancelled, "order "+ask.ID+" cancelled\n") {
+		t.Errorf("cancel printed %q", cancelled)
+	}
+	var orders []models.Order
+	jsonOf(t, &orders, "orders", "-symbol", "CLIMKT", "-status", models.OrderCancelled, "cli-alice")
+	if len(orders) != 1 || orders[0].ID != ask.ID || orders[0].Filled != 4 {
+		t.Errorf("cancelled orders %+v", orders)
+	}
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+// TestFollowTrades tails the trades of a market: the trades so far and those
+// made while following are printed one JSON document per line, and an
+// interrupt ends the command
+func TestFollowTrades(t *testing.T) {
+	text(t, "market", "create", "cli-carol", "CLIFOLLOW")
+	text(t, "order", "place", "cli-carol", "CLIFOLLOW", "sell", "no", "5", "3")
+	text(t, "order", "place", "cli-dave", "CLIFOLLOW", "buy", "no", "1", "3")
+
+	out := &output{}
+	done := make(chan error, 1)
+	go func() {
+		done <- run(out, true, "trades", "-symbol", "CLIFOLLOW", "-follow", "-interval", "10ms")
+	}()
+	waitFor(t, func() bool { return strings.Count(out.String(), "\n") == 1 })
+	text(t, "order", "place", "cli-dave", "CLIFOLLOW", "buy", "no", "2", "3")
+	waitFor(t, func() bool { return strings.Count(out.String(), "\n") == 2 })
+
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("following: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("still following after an interrupt")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, quantity := range []int{1, 2} {
+		var trade models.Trade
+		if err := json.Unmarshal([]byte(lines[i]), &trade); err != nil || trade.Buyer != "cli-dave" || trade.Quantity != quantity {
+			t.Errorf("line %d is %q, want the trade of %d", i+1, lines[i], quantity)
+		}
+	}
+}
+
+// waitFor polls cond for up to five seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+	}
+}
+
+// TestErrors checks a script can tell a bad command line from a refusal of
+// the API: exit code 2 for the first, 1 and the error object for the second
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		exit int
+		// stderr is what -json mode prints, a prefix for usage errors
+		stderr string
+	}{
+		{"missing arguments", []string{"order", "cancel", "cli-alice"}, 2, "usage: opnify order cancel <userId> <orderId>"},
+		{"quantity not a number", []string{"order", "place", "cli-alice", "CLIMKT", "buy", "yes", "ten", "5"}, 2, "usage: opnify order place"},
+		{"unknown flag", []string{"trades", "-since", "1h"}, 2, "usage: opnify trades"},
+		{"unknown market", []string{"book", "CLINOPE"}, 1, `{"code":"MARKET_NOT_FOUND"`},
+		{"unknown user", []string{"balance", "cli-nobody"}, 1, `{"code":"USER_NOT_FOUND"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &cli{api: api, json: true, timeout: 5 * time.Second, out: io.Discard, usage: commands[tt.args[0]].usage}
+			err := commands[tt.args[0]].run(c, tt.args[1:])
+			if err == nil {
+				t.Fatal("command succeeded")
+			}
+			if tt.exit == 1 && !apierr.Is(err, apierr.From(err).Code) {
+				t.Errorf("API refusal came back as %v", err)
+			}
+
+			stderr := captureStderr(t, func() {
+				if exit := c.fail(err); exit != tt.exit {
+					t.Errorf("exit code %d, want %d", exit, tt.exit)
+				}
+			})
+			if !strings.HasPrefix(stderr, tt.stderr) {
+				t.Errorf("printed %q, want it to start with %q", stderr, tt.stderr)
+			}
+		})
+	}
+}
+
+// captureStderr returns what fn wrote to os.Stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stderr
+	os.Stderr = w
+	fn()
+	os.Stderr = saved
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
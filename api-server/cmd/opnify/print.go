@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tickers"
+)
+
+func table(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+}
+
+func printBalances(w io.Writer, balances map[string]models.UserBalance) {
+	tw := table(w)
+	fmt.Fprintln(tw, "USER\tAVAILABLE\tLOCKED\tWITHDRAWING\t")
+	for _, userId := range sortedKeys(balances) {
+		b := balances[userId]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", userId, b.Balance, b.Locked, b.PendingWithdrawal)
+	}
+	tw.Flush()
+}
+
+func printHoldings(w io.Writer, stocks models.Stock) {
+	tw := table(w)
+	fmt.Fprintln(tw, "MARKET\tUSER\tYES\tYES LOCKED\tNO\tNO LOCKED\t")
+	for _, symbol := range sortedKeys(stocks) {
+		for _, userId := range sortedKeys(stocks[symbol]) {
+			held := stocks[symbol][userId]
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t\n", symbol, userId,
+				held["yes"].Quantity, held["yes"].Locked, held["no"].Quantity, held["no"].Locked)
+		}
+	}
+	tw.Flush()
+}
+
+func printPortfolio(w io.Writer, p models.Portfolio) {
+	fmt.Fprintf(w, "%s: %d INR available, %d locked\n", p.UserId, p.Balance.Balance, p.Balance.Locked)
+	tw := table(w)
+	fmt.Fprintln(tw, "MARKET\tOUTCOME\tQTY\tLOCKED\tAVG\tMARK\tVALUE\tREALIZED\tUNREALIZED\tBIDDING\tOFFERING\t")
+	for _, pos := range p.Positions {
+		market := pos.Symbol
+		if pos.Resolved != "" {
+			market += " (" + pos.Resolved + ")"
+		}
+		mark := "-"
+		if pos.MarkSource != "" {
+			mark = fmt.Sprintf("%.1f %s", pos.MarkPrice, pos.MarkSource)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f\t%s\t%.1f\t%d\t%.1f\t%d\t%d\t\n", market, pos.Outcome, pos.Quantity, pos.Locked,
+			pos.AvgPrice, mark, pos.Value, pos.RealizedPnl, pos.UnrealizedPnl, pos.OpenBuy, pos.OpenSell)
+	}
+	tw.Flush()
+	t := p.Totals
+	fmt.Fprintf(w, "value %.1f on cost %d, realized %d, unrealized %.1f, fees %d, net %.1f\n",
+		t.Value, t.Cost, t.RealizedPnl, t.UnrealizedPnl, t.Fees, t.NetPnl)
+	fmt.Fprintf(w, "%d open orders, %d INR committed to bids\n", t.OpenOrders, t.OpenBuyCost)
+}
+
+func printResolution(w io.Writer, symbol string, resolution models.Resolution) {
+	fmt.Fprintf(w, "%s resolved %s\n", symbol, strings.ToUpper(resolution.Outcome))
+	tw := table(w)
+	fmt.Fprintln(tw, "USER\tPAYOUT\t")
+	for _, userId := range sortedKeys(resolution.Payouts) {
+		fmt.Fprintf(tw, "%s\t%d\t\n", userId, resolution.Payouts[userId])
+	}
+	tw.Flush()
+}
+
+func printOrder(w io.Writer, order models.Order) {
+	fmt.Fprintf(w, "order %s %s\n", order.ID, order.Status)
+	fmt.Fprintf(w, "  %s %s %d %s %s", order.UserId, order.Side, order.Quantity, strings.ToUpper(order.Outcome), order.Symbol)
+	if order.Type == models.OrderMarket {
+		fmt.Fprintln(w, " at market")
+	} else {
+		fmt.Fprintf(w, " at %d\n", order.Price)
+	}
+	fmt.Fprintf(w, "  filled %d, resting %d\n", order.Filled, order.Remaining)
+	if order.ClientOrderId != "" {
+		fmt.Fprintf(w, "  client order id %s\n", order.ClientOrderId)
+	}
+	if len(order.Fills) > 0 {
+		printTradeRows(w, order.Fills)
+	}
+}
+
+func printOrders(w io.Writer, orders []models.Order) {
+	tw := table(w)
+	fmt.Fprintln(tw, "ID\tMARKET\tSIDE\tOUTCOME\tTYPE\tPRICE\tQTY\tFILLED\tRESTING\tSTATUS\t")
+	for _, o := range orders {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t\n",
+			o.ID, o.Symbol, o.Side, o.Outcome, o.Type, o.Price, o.Quantity, o.Filled, o.Remaining, o.Status)
+	}
+	tw.Flush()
+}
+
+func printCandles(w io.Writer, series candles.Series) {
+	fmt.Fprintf(w, "%s %s %s\n", series.Symbol, strings.ToUpper(series.Outcome), series.Interval)
+	tw := table(w)
+	fmt.Fprintln(tw, "START\tOPEN\tHIGH\tLOW\tCLOSE\tVOLUME\tTRADES\t")
+	for _, candle := range series.Candles {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n", candle.Start.Local().Format(time.DateTime),
+			candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, candle.Trades)
+	}
+	tw.Flush()
+}
+
+func printTickers(w io.Writer, all []tickers.Ticker) {
+	tw := table(w)
+	fmt.Fprintln(tw, "MARKET\tLAST\t24H\tYES BID\tYES ASK\tNO BID\tNO ASK\tVOLUME 24H\tOPEN INTEREST\tTRADERS\t")
+	for _, t := range all {
+		market := t.Symbol
+		if t.Resolved != "" {
+			market += " (" + t.Resolved + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%+d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t\n", market, orBlank(t.LastPrice), t.Change24h,
+			orBlank(t.Yes.Bid), orBlank(t.Yes.Ask), orBlank(t.No.Bid), orBlank(t.No.Ask), t.Volume24h, t.OpenInterest, t.Traders)
+	}
+	tw.Flush()
+}
+
+func printMaker(w io.Writer, s amm.Status) {
+	m := s.Maker
+	funder := m.FundedBy
+	if m.Funder != "" {
+		funder += " " + m.Funder
+	}
+	fmt.Fprintf(w, "%s market maker, liquidity %g, funded by %s\n", m.Symbol, m.Liquidity, funder)
+	tw := table(w)
+	if !m.Settled {
+		fmt.Fprintln(tw, "OUTCOME\tPRICE\tBID\tASK\tSOLD\tHELD\t")
+		fmt.Fprintf(tw, "yes\t%.2f\t%s\t%s\t%d\t%d\t\n", s.Prices.Yes, orBlank(s.Yes.Bid), orBlank(s.Yes.Ask), m.NetYes, s.Holdings.Yes)
+		fmt.Fprintf(tw, "no\t%.2f\t%s\t%s\t%d\t%d\t\n", s.Prices.No, orBlank(s.No.Bid), orBlank(s.No.Ask), m.NetNo, s.Holdings.No)
+		tw.Flush()
+		tw = table(w)
+	}
+	fmt.Fprintln(tw, "SUBSIDY\tCASH\tVALUE\tPNL\tVOLUME\tNOTIONAL\t")
+	fmt.Fprintf(tw, "%d\t%d\t%.2f\t%+.2f\t%d\t%d\t\n", m.Subsidy, s.Cash, s.Value, s.Pnl, m.Volume, m.Notional)
+	tw.Flush()
+	if m.Settled {
+		fmt.Fprintf(w, "settled, %d returned to the funder\n", m.Returned)
+	}
+}
+
+func printTradeRows(w io.Writer, trades []models.Trade) {
+	if len(trades) == 0 {
+		return
+	}
+	tw := table(w)
+	fmt.Fprintln(tw, "TIME\tMARKET\tOUTCOME\tPRICE\tQTY\tBUYER\tSELLER\tTAKER\t")
+	for _, t := range trades {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t\n", t.Timestamp.Local().Format(time.TimeOnly),
+			t.Symbol, t.Outcome, t.Price, t.Quantity, t.Buyer, t.Seller, t.Taker)
+	}
+	tw.Flush()
+}
+
+// printLadder draws the book as a YES price ladder, highest price on top.
+// Sells of YES rest on the YES side and are asks; buys of YES rest as NO at
+// the complementary price and are bids. Read upside down it is the NO ladder,
+// a NO price being 10 minus the YES price.
+func printLadder(w io.Writer, symbol string, book models.Pricing) {
+	widest := 1
+	for price := 1; price < models.ContractPrice; price++ {
+		widest = max(widest, book.Yes[price].Total, book.No[models.ContractPrice-price].Total)
+	}
+
+	fmt.Fprintf(w, "%s\n", symbol)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tBIDS\tYES\tNO\tASKS\t")
+	for price := models.ContractPrice - 1; price >= 1; price-- {
+		bid := book.No[models.ContractPrice-price].Total
+		ask := book.Yes[price].Total
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n",
+			bar(bid, widest, true), orBlank(bid), price, models.ContractPrice-price, orBlank(ask), bar(ask, widest, false))
+	}
+	tw.Flush()
+}
+
+// bar is a depth bar up to 20 wide, bids grow to the left
+func bar(size, widest int, left bool) string {
+	const width = 20
+	n := (size*width + widest - 1) / widest
+	if left {
+		return strings.Repeat(" ", width-n) + strings.Repeat("#", n)
+	}
+	return strings.Repeat("#", n)
+}
+
+func orBlank(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprint(n)
+}
@@ -1,37 +1,107 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	"github.com/sahilrush/src/controllers"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/services"
+	"github.com/sahilrush/src/tracing"
+	"github.com/sahilrush/src/transport"
 )
 
 func main() {
 
-	r := gin.Default()
-
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{"message": "Probo-Backend"})
-	})
-
-	r.POST("/user/create", controllers.CreateUser)
-	r.POST("/onramp/inr", controllers.OnrampUser)
-	r.GET("/balance/inr", controllers.GetBalances)
-	r.GET("/balance/inr/:userId", controllers.GetUserBalance)
-	r.POST("/symbol/create", controllers.CreateSymbol)
-	r.GET("/orderbook/:symbol", controllers.ViewOrderbook)
-	r.GET("/orderbook/getorder", controllers.GetOrderBooks)
-	r.GET("/getUserStock/:userId", controllers.GetUserStock)
-	r.GET("/getStocks", controllers.GetStocks)
-	r.POST("/sellyes", controllers.SellYes)
-	r.POST("/sellno", controllers.SellNo)
-	r.POST("/buyyes", controllers.BuyYes)
-	r.POST("/buyno", controllers.BuyNo)
-	//viewOrderbook
-	r.Run(":8080")
-}
+	if err := config.Load(); err != nil {
+		logging.Fatal("invalid configuration", "error", err)
+	}
+	logging.Setup(os.Stderr, config.Current.Log.Level, config.Current.Log.Format)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "opnify-api")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
+	}
+
+	t, err := services.NewTransport()
+	if err != nil {
+		logging.Fatal("failed to create transport", "error", err)
+	}
+
+	limiter, err := services.NewLimiter()
+	if err != nil {
+		logging.Fatal("failed to create rate limiter", "error", err)
+	}
+
+	engineCtx, stopEngine := context.WithCancel(context.Background())
+	engineDone := make(chan struct{})
+
+	// subscribe before the engine starts so its first heartbeat is not missed
+	health, err := services.NewHealth(engineCtx, t)
+	if err != nil {
+		logging.Fatal("failed to subscribe to engine heartbeats", "error", err)
+	}
 
+	// with the in-process transport the engine runs inside this binary
+	if _, ok := t.(*transport.InProc); ok {
+		go func() {
+			defer close(engineDone)
+			if err := services.RunEngine(engineCtx, t); err != nil {
+				logging.Fatal("engine stopped", "error", err)
+			}
+		}()
+	} else {
+		close(engineDone)
+	}
 
+	services.RegisterQueueMetrics(t)
+	r := services.NewRouter(t, health, limiter)
 
-//redis pubsub queue and subscribe should be http.Error
-//(w, err.Error(), http.StatusInternalServerError)
-//it will push to redis queue and it will subscribe to channel
+	srv := &http.Server{Addr: config.Current.Server.Addr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("server stopped", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("shutting down, waiting for in-flight requests")
+
+	// fail readiness and keep serving until the load balancer has noticed,
+	// then stop accepting requests and let the ones waiting on the engine finish
+	health.Drain()
+	slog.Info("draining", "period", time.Duration(config.Current.Server.DrainPeriod))
+	time.Sleep(time.Duration(config.Current.Server.DrainPeriod))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Current.Server.ShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("shutdown cut short", "error", err)
+	}
+
+	// the in-process engine writes its snapshot before returning
+	stopEngine()
+	<-engineDone
+
+	if err := t.Close(); err != nil {
+		slog.Warn("failed to close transport", "error", err)
+	}
+	if limiter != nil {
+		if err := limiter.Close(); err != nil {
+			slog.Warn("failed to close rate limiter", "error", err)
+		}
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+}
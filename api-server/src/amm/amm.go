@@ -0,0 +1,232 @@
+// Package amm runs automated market makers that price a market with the
+// logarithmic market scoring rule (LMSR). A maker is seeded with a liquidity
+// parameter b; the cost of moving the shares it has sold from q to q' is
+// C(q') - C(q) where C(q) = b ln(e^(qYes/b) + e^(qNo/b)) contracts, so its
+// prices always add up to the contract price and its loss is bounded by
+// b ln 2 contracts, the subsidy its funder puts up front.
+//
+// The package only does the pricing and keeps the state of each maker; the
+// engine moves the INR and shares, through an account the maker holds like
+// a user. Like the rest of the engine state it is guarded by the engine lock.
+package amm
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/replay"
+)
+
+// Makers funded by the platform take the subsidy from and return what is left
+// to the platform rather than a user
+const (
+	FundedByCreator  = "creator"
+	FundedByPlatform = "platform"
+)
+
+const accountPrefix = "amm:"
+
+// epsilon absorbs floating point noise so a share costing exactly a whole
+// price is not rounded up to the next one
+const epsilon = 1e-9
+
+// Maker is the state of one market's market maker
+type Maker struct {
+	Symbol string `json:"symbol"`
+	// Account is the user id holding the maker's INR and shares
+	Account   string  `json:"account"`
+	Liquidity float64 `json:"liquidity"`
+	FundedBy  string  `json:"fundedBy"`
+	// Funder is the user who put up the subsidy, empty for the platform
+	Funder  string `json:"funder,omitempty"`
+	Subsidy int    `json:"subsidy"`
+	// NetYes and NetNo are the shares of each outcome the maker sold less the
+	// ones it bought back, the q of the cost function
+	NetYes    int       `json:"netYes"`
+	NetNo     int       `json:"netNo"`
+	Volume    int       `json:"volume"`
+	Notional  int       `json:"notional"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Returned is what the maker handed back to its funder when the market resolved
+	Settled  bool `json:"settled"`
+	Returned int  `json:"returned"`
+}
+
+// Makers is keyed by symbol, markets without one trade on their book only
+var Makers = map[string]Maker{}
+
+// Account returns the user id a market's maker trades as
+func Account(symbol string) string {
+	return accountPrefix + symbol
+}
+
+// IsAccount reports whether a user id belongs to a market maker
+func IsAccount(userId string) bool {
+	return strings.HasPrefix(userId, accountPrefix)
+}
+
+// Funding returns the INR a maker with the given liquidity needs up front:
+// its worst case loss, rounded up
+func Funding(liquidity float64) int {
+	return int(math.Ceil(models.ContractPrice*liquidity*math.Ln2 - epsilon))
+}
+
+// New returns a maker for a market with nothing sold yet
+func New(symbol string, liquidity float64, fundedBy, funder string) Maker {
+	return Maker{
+		Symbol:    symbol,
+		Account:   Account(symbol),
+		Liquidity: liquidity,
+		FundedBy:  fundedBy,
+		Funder:    funder,
+		Subsidy:   Funding(liquidity),
+		CreatedAt: replay.Now(),
+	}
+}
+
+// cost is the cost function in INR
+func (m Maker) cost(yes, no int) float64 {
+	a, b := float64(yes)/m.Liquidity, float64(no)/m.Liquidity
+	top := max(a, b)
+	return models.ContractPrice * m.Liquidity * (top + math.Log(math.Exp(a-top)+math.Exp(b-top)))
+}
+
+// Price is the marginal price of an outcome in INR, what an infinitely small
+// trade would pay. The two outcomes add up to the contract price.
+func (m Maker) Price(outcome string) float64 {
+	own, other := m.NetYes, m.NetNo
+	if outcome == "no" {
+		own, other = other, own
+	}
+	return models.ContractPrice / (1 + math.Exp(float64(other-own)/m.Liquidity))
+}
+
+// Fill is a run of shares the maker trades at one price
+type Fill struct {
+	Price    int `json:"price"`
+	Quantity int `json:"quantity"`
+}
+
+func appendFill(fills []Fill, price int) []Fill {
+	if n := len(fills); n > 0 && fills[n-1].Price == price {
+		fills[n-1].Quantity++
+		return fills
+	}
+	return append(fills, Fill{Price: price, Quantity: 1})
+}
+
+// Buy quotes a trader buying up to quantity shares of outcome at no more than
+// limit. Each share costs what it moves the cost function, rounded up to a
+// whole price; the maker stops before a share that would cost the contract
+// price. The maker is not changed.
+func (m Maker) Buy(outcome string, limit, quantity int) []Fill {
+	fills := []Fill{}
+	yes, no := m.NetYes, m.NetNo
+	for ; quantity > 0; quantity-- {
+		before := m.cost(yes, no)
+		if outcome == "yes" {
+			yes++
+		} else {
+			no++
+		}
+		price := max(int(math.Ceil(m.cost(yes, no)-before-epsilon)), 1)
+		if price > limit || price >= models.ContractPrice {
+			break
+		}
+		fills = appendFill(fills, price)
+	}
+	return fills
+}
+
+// Sell quotes a trader selling up to quantity shares of outcome for at least
+// limit. Each share pays what it moves the cost function, rounded down; the
+// maker stops before a share that would pay nothing.
+func (m Maker) Sell(outcome string, limit, quantity int) []Fill {
+	fills := []Fill{}
+	yes, no := m.NetYes, m.NetNo
+	for ; quantity > 0; quantity-- {
+		before := m.cost(yes, no)
+		if outcome == "yes" {
+			yes--
+		} else {
+			no--
+		}
+		price := int(math.Floor(before - m.cost(yes, no) + epsilon))
+		if price < limit || price < 1 {
+			break
+		}
+		fills = appendFill(fills, price)
+	}
+	return fills
+}
+
+// Trade moves the maker's state by a trader buying (positive quantity) or
+// selling (negative) shares of outcome for notional INR
+func (m *Maker) Trade(outcome string, quantity, notional int) {
+	if outcome == "yes" {
+		m.NetYes += quantity
+	} else {
+		m.NetNo += quantity
+	}
+	m.Volume += max(quantity, -quantity)
+	m.Notional += notional
+}
+
+// MakerQuote is the price of the maker's next share of an outcome each way,
+// 0 when it would not trade that way
+type MakerQuote struct {
+	Bid int `json:"bid"`
+	Ask int `json:"ask"`
+}
+
+// Quote returns what the maker pays for and asks for one share of outcome
+func (m Maker) Quote(outcome string) MakerQuote {
+	q := MakerQuote{}
+	if fills := m.Buy(outcome, models.ContractPrice-1, 1); len(fills) > 0 {
+		q.Ask = fills[0].Price
+	}
+	if fills := m.Sell(outcome, 1, 1); len(fills) > 0 {
+		q.Bid = fills[0].Price
+	}
+	return q
+}
+
+// Status is a maker with its quotes and what it is worth
+type Status struct {
+	Maker Maker `json:"maker"`
+	// Prices are the marginal prices of each outcome in INR
+	Prices struct {
+		Yes float64 `json:"yes"`
+		No  float64 `json:"no"`
+	} `json:"prices"`
+	Yes  MakerQuote `json:"yes"`
+	No   MakerQuote `json:"no"`
+	Cash int        `json:"cash"`
+	// Holdings are the shares the maker bought back and holds, never both
+	// outcomes since it redeems pairs
+	Holdings struct {
+		Yes int `json:"yes"`
+		No  int `json:"no"`
+	} `json:"holdings"`
+	// Value is the cash plus the holdings at the marginal prices, or what was
+	// returned once the market resolved. PnL is the value less the subsidy.
+	Value float64 `json:"value"`
+	Pnl   float64 `json:"pnl"`
+}
+
+// Status values the maker given the INR and shares its account holds
+func (m Maker) Status(cash, yes, no int) Status {
+	s := Status{Maker: m, Cash: cash}
+	s.Holdings.Yes, s.Holdings.No = yes, no
+	if m.Settled {
+		s.Value = float64(m.Returned)
+	} else {
+		s.Prices.Yes, s.Prices.No = m.Price("yes"), m.Price("no")
+		s.Yes, s.No = m.Quote("yes"), m.Quote("no")
+		s.Value = float64(cash) + float64(yes)*s.Prices.Yes + float64(no)*s.Prices.No
+	}
+	s.Pnl = s.Value - float64(m.Subsidy)
+	return s
+}
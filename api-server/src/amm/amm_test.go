@@ -0,0 +1,187 @@
+package amm_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/models"
+)
+
+func TestAccount(t *testing.T) {
+	if got := amm.Account("BTC"); got != "amm:BTC" {
+		t.Errorf("Account(BTC) = %s", got)
+	}
+	tests := []struct {
+		userId string
+		want   bool
+	}{
+		{amm.Account("BTC"), true},
+		{"amm:", true},
+		{"alice", false},
+		{"", false},
+		{"xamm:BTC", false},
+		{"AMM:BTC", false},
+	}
+	for _, tt := range tests {
+		if got := amm.IsAccount(tt.userId); got != tt.want {
+			t.Errorf("IsAccount(%q) = %v, want %v", tt.userId, got, tt.want)
+		}
+	}
+}
+
+func TestFunding(t *testing.T) {
+	tests := []struct {
+		liquidity float64
+		want      int
+	}{
+		{0, 0},
+		{1, 7},
+		{10, 70},
+		{100, 694},
+	}
+	for _, tt := range tests {
+		if got := amm.Funding(tt.liquidity); got != tt.want {
+			t.Errorf("Funding(%v) = %d, want %d", tt.liquidity, got, tt.want)
+		}
+	}
+	if maker := amm.New("BTC", 10, amm.FundedByPlatform, ""); maker.Subsidy != 70 || maker.Account != "amm:BTC" {
+		t.Errorf("New = %+v", maker)
+	}
+}
+
+// maker returns a maker with b = 10 that has sold yes and no shares
+func maker(yes, no int) amm.Maker {
+	m := amm.New("BTC", 10, amm.FundedByCreator, "alice")
+	m.NetYes, m.NetNo = yes, no
+	return m
+}
+
+func TestBuy(t *testing.T) {
+	tests := []struct {
+		name     string
+		maker    amm.Maker
+		outcome  string
+		limit    int
+		quantity int
+		want     []amm.Fill
+	}{
+		{"prices rise as it sells", maker(0, 0), "yes", 9, 5, []amm.Fill{{6, 4}, {7, 1}}},
+		{"stops at the limit", maker(0, 0), "yes", 6, 50, []amm.Fill{{6, 4}}},
+		{"never at the contract price", maker(0, 0), "yes", 9, 100, []amm.Fill{{6, 4}, {7, 4}, {8, 6}, {9, 8}}},
+		{"limit below the first share", maker(0, 0), "no", 5, 5, []amm.Fill{}},
+		{"a lopsided market", maker(30, 0), "yes", 9, 5, []amm.Fill{}},
+		{"more liquidity moves slower", amm.New("BTC", 100, amm.FundedByPlatform, ""), "yes", 9, 20, []amm.Fill{{6, 20}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.maker
+			if got := tt.maker.Buy(tt.outcome, tt.limit, tt.quantity); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Buy = %v, want %v", got, tt.want)
+			}
+			if tt.maker != before {
+				t.Error("Buy changed the maker")
+			}
+		})
+	}
+}
+
+func TestSell(t *testing.T) {
+	tests := []struct {
+		name     string
+		maker    amm.Maker
+		outcome  string
+		limit    int
+		quantity int
+		want     []amm.Fill
+	}{
+		{"prices fall as it buys", maker(5, 0), "yes", 1, 10, []amm.Fill{{6, 1}, {5, 4}, {4, 4}, {3, 1}}},
+		{"stops at the limit", maker(5, 0), "yes", 5, 10, []amm.Fill{{6, 1}, {5, 4}}},
+		{"never for nothing", maker(30, 0), "no", 1, 3, []amm.Fill{}},
+		{"nothing asked", maker(5, 0), "yes", 1, 0, []amm.Fill{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.maker.Sell(tt.outcome, tt.limit, tt.quantity); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sell = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRoundingFavoursTheMaker buys and sells back shares: rounding every
+// share against the trader means a round trip never makes money
+func TestRoundingFavoursTheMaker(t *testing.T) {
+	total := func(fills []amm.Fill) (quantity, notional int) {
+		for _, fill := range fills {
+			quantity += fill.Quantity
+			notional += fill.Price * fill.Quantity
+		}
+		return quantity, notional
+	}
+	for _, outcome := range []string{"yes", "no"} {
+		for size := 1; size <= 30; size++ {
+			m := maker(3, 7)
+			bought, paid := total(m.Buy(outcome, models.ContractPrice-1, size))
+			m.Trade(outcome, bought, paid)
+			sold, received := total(m.Sell(outcome, 1, bought))
+			if sold == bought && received > paid {
+				t.Errorf("%s x%d: paid %d, sold back for %d", outcome, size, paid, received)
+			}
+		}
+	}
+}
+
+func TestTradeAndPrice(t *testing.T) {
+	m := maker(0, 0)
+	if yes, no := m.Price("yes"), m.Price("no"); yes != 5 || no != 5 {
+		t.Fatalf("fresh prices = %v/%v, want 5/5", yes, no)
+	}
+
+	m.Trade("yes", 5, 32)
+	m.Trade("no", 2, 11)
+	m.Trade("yes", -1, -6)
+	if m.NetYes != 4 || m.NetNo != 2 || m.Volume != 8 || m.Notional != 37 {
+		t.Errorf("maker after trades = %+v", m)
+	}
+	yes, no := m.Price("yes"), m.Price("no")
+	if yes <= 5 || math.Abs(yes+no-models.ContractPrice) > 1e-9 {
+		t.Errorf("prices = %v/%v, want YES above 5 and the two adding up to %d", yes, no, models.ContractPrice)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name    string
+		maker   amm.Maker
+		outcome string
+		want    amm.MakerQuote
+	}{
+		{"fresh", maker(0, 0), "yes", amm.MakerQuote{Bid: 4, Ask: 6}},
+		{"after buying", maker(5, 0), "yes", amm.MakerQuote{Bid: 6, Ask: 7}},
+		{"too lopsided to sell", maker(30, 0), "yes", amm.MakerQuote{Bid: 9}},
+		{"too lopsided to buy", maker(30, 0), "no", amm.MakerQuote{Ask: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.maker.Quote(tt.outcome); got != tt.want {
+				t.Errorf("Quote = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	m := maker(0, 0)
+	s := m.Status(70, 2, 0)
+	if s.Value != 80 || s.Pnl != 10 || s.Yes.Ask != 6 {
+		t.Errorf("open status = %+v, want value 80 and pnl 10", s)
+	}
+
+	m.Settled, m.Returned = true, 50
+	s = m.Status(0, 0, 0)
+	if s.Value != 50 || s.Pnl != -20 || s.Yes != (amm.MakerQuote{}) {
+		t.Errorf("settled status = %+v, want value 50, pnl -20 and no quotes", s)
+	}
+}
@@ -0,0 +1,146 @@
+package apierr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code identifies an error for clients, codes never change once published
+type Code string
+
+const (
+	InvalidRequest   Code = "INVALID_REQUEST"
+	PriceOutOfRange  Code = "PRICE_OUT_OF_RANGE"
+	InvalidQuantity  Code = "INVALID_QUANTITY"
+	InvalidSignature Code = "INVALID_SIGNATURE"
+	NotFound         Code = "NOT_FOUND"
+
+	UserNotFound       Code = "USER_NOT_FOUND"
+	UserExists         Code = "USER_EXISTS"
+	MarketNotFound     Code = "MARKET_NOT_FOUND"
+	MarketExists       Code = "MARKET_EXISTS"
+	MarketResolved     Code = "MARKET_RESOLVED"
+	DepositNotFound    Code = "DEPOSIT_NOT_FOUND"
+	WithdrawalNotFound Code = "WITHDRAWAL_NOT_FOUND"
+	WithdrawalSettled  Code = "WITHDRAWAL_SETTLED"
+	OrderNotFound      Code = "ORDER_NOT_FOUND"
+
+	DuplicateClientOrderID Code = "DUPLICATE_CLIENT_ORDER_ID"
+	OrderNotOpen           Code = "ORDER_NOT_OPEN"
+
+	InsufficientBalance Code = "INSUFFICIENT_BALANCE"
+	InsufficientShares  Code = "INSUFFICIENT_SHARES"
+	SubsidyBudget       Code = "SUBSIDY_BUDGET_EXCEEDED"
+
+	// Pre-trade risk checks
+	MaxOrderQuantity Code = "MAX_ORDER_QUANTITY_EXCEEDED"
+	MaxNotional      Code = "MAX_NOTIONAL_EXCEEDED"
+	PositionLimit    Code = "POSITION_LIMIT_EXCEEDED"
+	MaxOpenOrders    Code = "MAX_OPEN_ORDERS_EXCEEDED"
+	PriceOutsideBand Code = "PRICE_OUTSIDE_BAND"
+
+	IdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED"
+	LedgerMismatch       Code = "LEDGER_MISMATCH"
+	PaymentFailed        Code = "PAYMENT_FAILED"
+	RateLimited          Code = "RATE_LIMITED"
+
+	EngineTimeout     Code = "ENGINE_TIMEOUT"
+	EngineUnavailable Code = "ENGINE_UNAVAILABLE"
+	Internal          Code = "INTERNAL"
+)
+
+var statuses = map[Code]int{
+	InvalidRequest:   http.StatusBadRequest,
+	PriceOutOfRange:  http.StatusBadRequest,
+	InvalidQuantity:  http.StatusBadRequest,
+	InvalidSignature: http.StatusUnauthorized,
+	NotFound:         http.StatusNotFound,
+
+	UserNotFound:       http.StatusNotFound,
+	UserExists:         http.StatusConflict,
+	MarketNotFound:     http.StatusNotFound,
+	MarketExists:       http.StatusConflict,
+	MarketResolved:     http.StatusConflict,
+	DepositNotFound:    http.StatusNotFound,
+	WithdrawalNotFound: http.StatusNotFound,
+	WithdrawalSettled:  http.StatusConflict,
+	OrderNotFound:      http.StatusNotFound,
+
+	DuplicateClientOrderID: http.StatusConflict,
+	OrderNotOpen:           http.StatusConflict,
+
+	InsufficientBalance: http.StatusUnprocessableEntity,
+	InsufficientShares:  http.StatusUnprocessableEntity,
+	SubsidyBudget:       http.StatusUnprocessableEntity,
+
+	MaxOrderQuantity: http.StatusUnprocessableEntity,
+	MaxNotional:      http.StatusUnprocessableEntity,
+	PositionLimit:    http.StatusUnprocessableEntity,
+	MaxOpenOrders:    http.StatusUnprocessableEntity,
+	PriceOutsideBand: http.StatusUnprocessableEntity,
+
+	IdempotencyKeyReused: http.StatusUnprocessableEntity,
+	LedgerMismatch:       http.StatusConflict,
+	PaymentFailed:        http.StatusBadGateway,
+	RateLimited:          http.StatusTooManyRequests,
+
+	EngineTimeout:     http.StatusGatewayTimeout,
+	EngineUnavailable: http.StatusServiceUnavailable,
+	Internal:          http.StatusInternalServerError,
+}
+
+// Status is the HTTP status a code is answered with
+func (code Code) Status() int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error a client can act on. Message is for people, Details
+// carries the values behind it, e.g. the available and required balance.
+type Error struct {
+	Code    Code        `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// With returns a copy of the error carrying details
+func (e *Error) With(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// From returns the *Error in err's chain, anything else is an internal error
+// whose text is not shown to clients
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return New(Internal, "Internal error")
+}
+
+// Is reports whether err carries code
+func Is(err error, code Code) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
@@ -0,0 +1,124 @@
+package apierr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		code   apierr.Code
+		status int
+	}{
+		{apierr.InvalidRequest, http.StatusBadRequest},
+		{apierr.PriceOutOfRange, http.StatusBadRequest},
+		{apierr.InvalidSignature, http.StatusUnauthorized},
+		{apierr.UserNotFound, http.StatusNotFound},
+		{apierr.MarketNotFound, http.StatusNotFound},
+		{apierr.UserExists, http.StatusConflict},
+		{apierr.InsufficientBalance, http.StatusUnprocessableEntity},
+		{apierr.PositionLimit, http.StatusUnprocessableEntity},
+		{apierr.RateLimited, http.StatusTooManyRequests},
+		{apierr.EngineTimeout, http.StatusGatewayTimeout},
+		{apierr.EngineUnavailable, http.StatusServiceUnavailable},
+		{apierr.Internal, http.StatusInternalServerError},
+		{apierr.Code("NOT_A_CODE"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := apierr.New(tt.code, "").Status(); got != tt.status {
+			t.Errorf("%s answers with %d, want %d", tt.code, got, tt.status)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	base := apierr.New(apierr.InsufficientBalance, "Insufficient balance")
+	detailed := base.With(map[string]int{"available": 5, "required": 9})
+	if base.Details != nil {
+		t.Errorf("With changed the error it was called on: %+v", base)
+	}
+	wrapped := fmt.Errorf("placing order: %w", detailed)
+
+	tests := []struct {
+		name string
+		err  error
+		want *apierr.Error
+	}{
+		{"coded", detailed, detailed},
+		{"wrapped", wrapped, detailed},
+		{"plain", errors.New("disk full at /var/lib/opnify"), apierr.New(apierr.Internal, "Internal error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := apierr.From(tt.err)
+			if got.Code != tt.want.Code || got.Message != tt.want.Message || fmt.Sprint(got.Details) != fmt.Sprint(tt.want.Details) {
+				t.Errorf("From = %+v, want %+v", got, tt.want)
+			}
+			if !apierr.Is(tt.err, tt.want.Code) && tt.want.Code != apierr.Internal {
+				t.Errorf("Is(%v, %s) = false", tt.err, tt.want.Code)
+			}
+		})
+	}
+	if apierr.Is(errors.New("plain"), apierr.Internal) || apierr.Is(wrapped, apierr.UserNotFound) {
+		t.Error("Is matched an error without that code")
+	}
+}
+
+// TestEnvelope checks every way an error reaches a client gives the same
+// envelope: a handler responding, a handler panicking, an unknown route and
+// a reply built by the engine outside gin
+func TestEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	savedWriter := gin.DefaultErrorWriter
+	t.Cleanup(func() { gin.DefaultErrorWriter = savedWriter })
+	gin.DefaultErrorWriter = io.Discard
+
+	router := gin.New()
+	router.Use(apierr.Recovery())
+	router.NoRoute(apierr.NoRoute)
+	// Responding stops the chain, the second handler never writes
+	router.GET("/balance", func(c *gin.Context) {
+		apierr.Respond(c, apierr.Newf(apierr.UserNotFound, "User %s not found", "bob").With(gin.H{"userId": "bob"}))
+	}, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("nil map")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/balance", http.StatusNotFound, `{"success":false,"message":"User bob not found","error":{"code":"USER_NOT_FOUND","message":"User bob not found","details":{"userId":"bob"}}}`},
+		{"/panic", http.StatusInternalServerError, `{"success":false,"message":"Internal error","error":{"code":"INTERNAL","message":"Internal error"}}`},
+		{"/missing", http.StatusNotFound, `{"success":false,"message":"Route not found","error":{"code":"NOT_FOUND","message":"Route not found"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status || rec.Body.String() != tt.body {
+				t.Errorf("answered %d %s, want %d %s", rec.Code, rec.Body, tt.status, tt.body)
+			}
+		})
+	}
+
+	status, body := apierr.Body(fmt.Errorf("engine: %w", apierr.New(apierr.MarketNotFound, "Market not found")))
+	var envelope apierr.Response
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusNotFound || envelope.Success || envelope.Error == nil || envelope.Error.Code != apierr.MarketNotFound {
+		t.Errorf("engine reply %d %s", status, body)
+	}
+}
@@ -0,0 +1,44 @@
+package apierr
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response is the envelope every failed request is answered with. Message
+// repeats the error message for clients that only read the envelope.
+type Response struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Error   *Error `json:"error"`
+}
+
+func response(e *Error) Response {
+	return Response{Success: false, Message: e.Message, Error: e}
+}
+
+// Respond answers the request with err and stops the handler chain
+func Respond(c *gin.Context, err error) {
+	e := From(err)
+	c.AbortWithStatusJSON(e.Status(), response(e))
+}
+
+// Body is the envelope for err as JSON, for replies built outside gin
+func Body(err error) (int, []byte) {
+	e := From(err)
+	body, _ := json.Marshal(response(e))
+	return e.Status(), body
+}
+
+// Recovery answers a request whose handler panicked with an internal error
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		Respond(c, New(Internal, "Internal error"))
+	})
+}
+
+// NoRoute answers requests for paths nothing is registered on
+func NoRoute(c *gin.Context) {
+	Respond(c, New(NotFound, "Route not found"))
+}
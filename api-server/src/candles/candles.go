@@ -0,0 +1,140 @@
+// Package candles aggregates trades into OHLCV candles per market, outcome and
+// interval. Candles are derived from the trade log: the engine adds every
+// trade as it happens and rebuilds them from the log when it restores state.
+// Like the rest of the engine state they are guarded by the engine lock.
+package candles
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sahilrush/src/models"
+)
+
+// Interval is a candle length clients ask for by name
+type Interval struct {
+	Name   string
+	Length time.Duration
+}
+
+var Intervals = []Interval{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// ParseInterval looks an interval up by name
+func ParseInterval(name string) (Interval, bool) {
+	for _, interval := range Intervals {
+		if interval.Name == name {
+			return interval, true
+		}
+	}
+	return Interval{}, false
+}
+
+// Candle covers the trades from Start up to the start of the next candle.
+// Prices are those of the candle's outcome, Volume is in shares and Notional
+// in INR. Intervals without trades have no candle.
+type Candle struct {
+	Start    time.Time `json:"start"`
+	Open     int       `json:"open"`
+	High     int       `json:"high"`
+	Low      int       `json:"low"`
+	Close    int       `json:"close"`
+	Volume   int       `json:"volume"`
+	Notional int       `json:"notional"`
+	Trades   int       `json:"trades"`
+}
+
+// Series is the reply of a candle query
+type Series struct {
+	Symbol   string   `json:"symbol"`
+	Outcome  string   `json:"outcome"`
+	Interval string   `json:"interval"`
+	Candles  []Candle `json:"candles"`
+}
+
+type key struct {
+	symbol, outcome, interval string
+}
+
+// series holds the candles of each key oldest first
+var series = map[key][]Candle{}
+
+// Add folds a trade into the candles of both outcomes: a YES fill at a price
+// is a NO fill at the contract price minus it
+func Add(trade models.Trade) {
+	other := "yes"
+	if trade.Outcome == "yes" {
+		other = "no"
+	}
+	for _, interval := range Intervals {
+		add(key{trade.Symbol, trade.Outcome, interval.Name}, interval, trade.Timestamp, trade.Price, trade.Quantity)
+		add(key{trade.Symbol, other, interval.Name}, interval, trade.Timestamp, models.ContractPrice-trade.Price, trade.Quantity)
+	}
+}
+
+func add(k key, interval Interval, at time.Time, price, quantity int) {
+	start := at.UTC().Truncate(interval.Length)
+	candles := series[k]
+
+	// Trades arrive in order, so the candle is nearly always the last one
+	i := len(candles)
+	if i == 0 || candles[i-1].Start.Before(start) {
+		series[k] = append(candles, Candle{Start: start, Open: price, High: price, Low: price, Close: price,
+			Volume: quantity, Notional: price * quantity, Trades: 1})
+		return
+	}
+	i = sort.Search(len(candles), func(i int) bool { return !candles[i].Start.Before(start) })
+	if !candles[i].Start.Equal(start) {
+		candles = append(candles, Candle{})
+		copy(candles[i+1:], candles[i:])
+		candles[i] = Candle{Start: start, Open: price, High: price, Low: price, Close: price}
+	} else {
+		c := &candles[i]
+		c.High = max(c.High, price)
+		c.Low = min(c.Low, price)
+		c.Close = price
+	}
+	candles[i].Volume += quantity
+	candles[i].Notional += price * quantity
+	candles[i].Trades++
+	series[k] = candles
+}
+
+// Rebuild replaces every candle with ones built from the trade log
+func Rebuild(trades []models.Trade) {
+	clear(series)
+	for _, trade := range trades {
+		Add(trade)
+	}
+}
+
+// Query returns the candles of a market outcome starting in [from, to), a zero
+// from or to leaves that end open. At most limit candles are returned, the
+// latest ones when from is open and the earliest ones otherwise.
+func Query(symbol, outcome string, interval Interval, from, to time.Time, limit int) []Candle {
+	candles := series[key{symbol, outcome, interval.Name}]
+
+	lo, hi := 0, len(candles)
+	if !from.IsZero() {
+		lo = sort.Search(len(candles), func(i int) bool { return !candles[i].Start.Before(from) })
+	}
+	if !to.IsZero() {
+		hi = sort.Search(len(candles), func(i int) bool { return !candles[i].Start.Before(to) })
+	}
+	if lo >= hi {
+		return []Candle{}
+	}
+
+	if hi-lo > limit {
+		if from.IsZero() {
+			lo = hi - limit
+		} else {
+			hi = lo + limit
+		}
+	}
+	return append([]Candle{}, candles[lo:hi]...)
+}
@@ -0,0 +1,153 @@
+package candles_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/models"
+)
+
+var base = time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+func trade(at time.Duration, outcome string, price, quantity int) models.Trade {
+	return models.Trade{Symbol: "BTC", Outcome: outcome, Price: price, Quantity: quantity, Timestamp: base.Add(at)}
+}
+
+func interval(t *testing.T, name string) candles.Interval {
+	t.Helper()
+	interval, ok := candles.ParseInterval(name)
+	if !ok {
+		t.Fatalf("no %s interval", name)
+	}
+	return interval
+}
+
+func TestParseInterval(t *testing.T) {
+	for _, name := range []string{"1m", "5m", "1h", "1d"} {
+		if got, ok := candles.ParseInterval(name); !ok || got.Name != name {
+			t.Errorf("ParseInterval(%s) = %+v, %v", name, got, ok)
+		}
+	}
+	if _, ok := candles.ParseInterval("2m"); ok {
+		t.Error("ParseInterval accepted 2m")
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	t.Cleanup(func() { candles.Rebuild(nil) })
+
+	tests := []struct {
+		name     string
+		interval string
+		trades   []models.Trade
+		want     []candles.Candle
+	}{
+		{"one trade", "1m", []models.Trade{trade(30*time.Second, "yes", 6, 2)},
+			[]candles.Candle{{Start: base, Open: 6, High: 6, Low: 6, Close: 6, Volume: 2, Notional: 12, Trades: 1}}},
+		{"last instant stays in the candle", "1m", []models.Trade{
+			trade(0, "yes", 5, 1),
+			trade(time.Minute-time.Nanosecond, "yes", 7, 1),
+		}, []candles.Candle{{Start: base, Open: 5, High: 7, Low: 5, Close: 7, Volume: 2, Notional: 12, Trades: 2}}},
+		{"boundary opens the next candle", "1m", []models.Trade{
+			trade(59*time.Second, "yes", 5, 1),
+			trade(time.Minute, "yes", 7, 3),
+		}, []candles.Candle{
+			{Start: base, Open: 5, High: 5, Low: 5, Close: 5, Volume: 1, Notional: 5, Trades: 1},
+			{Start: base.Add(time.Minute), Open: 7, High: 7, Low: 7, Close: 7, Volume: 3, Notional: 21, Trades: 1},
+		}},
+		{"gaps have no candle", "5m", []models.Trade{
+			trade(time.Minute, "yes", 4, 1),
+			trade(17*time.Minute, "yes", 6, 1),
+		}, []candles.Candle{
+			{Start: base, Open: 4, High: 4, Low: 4, Close: 4, Volume: 1, Notional: 4, Trades: 1},
+			{Start: base.Add(15 * time.Minute), Open: 6, High: 6, Low: 6, Close: 6, Volume: 1, Notional: 6, Trades: 1},
+		}},
+		{"high and low", "1h", []models.Trade{
+			trade(time.Minute, "yes", 5, 1),
+			trade(2*time.Minute, "yes", 9, 1),
+			trade(3*time.Minute, "yes", 2, 1),
+			trade(4*time.Minute, "yes", 4, 1),
+		}, []candles.Candle{{Start: base, Open: 5, High: 9, Low: 2, Close: 4, Volume: 4, Notional: 20, Trades: 4}}},
+		{"NO trades price the YES side", "1h", []models.Trade{trade(time.Minute, "no", 3, 2)},
+			[]candles.Candle{{Start: base, Open: 7, High: 7, Low: 7, Close: 7, Volume: 2, Notional: 14, Trades: 1}}},
+		{"days start at midnight UTC", "1d", []models.Trade{
+			{Symbol: "BTC", Outcome: "yes", Price: 5, Quantity: 1, Timestamp: time.Date(2026, 3, 2, 23, 30, 0, 0, time.FixedZone("IST", 5*3600+1800))},
+		}, []candles.Candle{{Start: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), Open: 5, High: 5, Low: 5, Close: 5, Volume: 1, Notional: 5, Trades: 1}}},
+		{"a late trade fills in its candle", "1m", []models.Trade{
+			trade(0, "yes", 5, 1),
+			trade(2*time.Minute, "yes", 6, 1),
+			trade(time.Minute, "yes", 8, 1),
+		}, []candles.Candle{
+			{Start: base, Open: 5, High: 5, Low: 5, Close: 5, Volume: 1, Notional: 5, Trades: 1},
+			{Start: base.Add(time.Minute), Open: 8, High: 8, Low: 8, Close: 8, Volume: 1, Notional: 8, Trades: 1},
+			{Start: base.Add(2 * time.Minute), Open: 6, High: 6, Low: 6, Close: 6, Volume: 1, Notional: 6, Trades: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candles.Rebuild(tt.trades)
+			got := candles.Query("BTC", "yes", interval(t, tt.interval), time.Time{}, time.Time{}, 100)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candles = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBothOutcomes(t *testing.T) {
+	t.Cleanup(func() { candles.Rebuild(nil) })
+	candles.Rebuild([]models.Trade{trade(0, "yes", 6, 2), trade(time.Second, "no", 3, 1)})
+
+	yes := candles.Query("BTC", "yes", interval(t, "1m"), time.Time{}, time.Time{}, 10)
+	no := candles.Query("BTC", "no", interval(t, "1m"), time.Time{}, time.Time{}, 10)
+	if len(yes) != 1 || len(no) != 1 {
+		t.Fatalf("yes %+v, no %+v, want a candle each", yes, no)
+	}
+	if yes[0].Open != 6 || yes[0].Close != 7 || no[0].Open != 4 || no[0].Close != 3 {
+		t.Errorf("yes %+v, no %+v, want mirrored prices", yes[0], no[0])
+	}
+	if yes[0].Volume != no[0].Volume || yes[0].Trades != no[0].Trades {
+		t.Errorf("yes %+v, no %+v, want the same volume", yes[0], no[0])
+	}
+	if got := candles.Query("ETH", "yes", interval(t, "1m"), time.Time{}, time.Time{}, 10); len(got) != 0 {
+		t.Errorf("other market has candles %+v", got)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Cleanup(func() { candles.Rebuild(nil) })
+	var trades []models.Trade
+	for i := 0; i < 5; i++ {
+		trades = append(trades, trade(time.Duration(i)*time.Minute, "yes", i+1, 1))
+	}
+	candles.Rebuild(trades)
+	minute := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		limit    int
+		opens    []int
+	}{
+		{"everything", time.Time{}, time.Time{}, 10, []int{1, 2, 3, 4, 5}},
+		{"open from keeps the latest", time.Time{}, time.Time{}, 2, []int{4, 5}},
+		{"set from keeps the earliest", minute(1), time.Time{}, 2, []int{2, 3}},
+		{"from is inclusive, to exclusive", minute(1), minute(3), 10, []int{2, 3}},
+		{"from inside a candle skips it", minute(1).Add(time.Second), time.Time{}, 10, []int{3, 4, 5}},
+		{"empty range", minute(3), minute(3), 10, []int{}},
+		{"range after the trades", minute(9), time.Time{}, 10, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opens := []int{}
+			for _, c := range candles.Query("BTC", "yes", interval(t, "1m"), tt.from, tt.to, tt.limit) {
+				opens = append(opens, c.Open)
+			}
+			if !reflect.DeepEqual(opens, tt.opens) {
+				t.Errorf("opens = %v, want %v", opens, tt.opens)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+// Package client is a typed Go client for the Opnify API. Every method
+// returns the data of a successful reply; failures the API reports come back
+// as *apierr.Error with their code, so callers can use apierr.Is.
+//
+//	c := client.New("http://localhost:8080")
+//	order, err := c.PlaceOrder(ctx, models.OrderRequest{...})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/tickers"
+)
+
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	// OperatorSecret signs request bodies as the platform operator, which
+	// funding a market maker from the platform needs
+	OperatorSecret string
+}
+
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTP: http.DefaultClient}
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey makes the command sent with ctx safe to retry: the API
+// answers a repeat of the key with the first reply
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// envelope is the shape of every reply
+type envelope struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   *apierr.Error   `json:"error"`
+}
+
+// do sends body as JSON and decodes the data of the reply into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if c.OperatorSecret != "" {
+			req.Header.Set(payments.OperatorHeader, payments.Sign(c.OperatorSecret, payload))
+		}
+	}
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok {
+		req.Header.Set(engine.IdempotencyHeader, key)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var reply envelope
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s %s: %s: %w", method, path, res.Status, err)
+	}
+	if reply.Error != nil {
+		return reply.Error
+	}
+	if res.StatusCode >= http.StatusBadRequest || !reply.Success {
+		return fmt.Errorf("%s %s: %s: %s", method, path, res.Status, reply.Message)
+	}
+	if out == nil || len(reply.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Data, out)
+}
+
+func (c *Client) CreateUser(ctx context.Context, userId string) (models.UserBalance, error) {
+	var balance models.UserBalance
+	err := c.do(ctx, http.MethodPost, "/user/create", nil, models.CreateUser{UserId: userId}, &balance)
+	return balance, err
+}
+
+func (c *Client) Balance(ctx context.Context, userId string) (models.UserBalance, error) {
+	var balance models.UserBalance
+	err := c.do(ctx, http.MethodGet, "/balance/inr/"+url.PathEscape(userId), nil, nil, &balance)
+	return balance, err
+}
+
+func (c *Client) Balances(ctx context.Context) (map[string]models.UserBalance, error) {
+	var balances map[string]models.UserBalance
+	err := c.do(ctx, http.MethodGet, "/balance/inr", nil, nil, &balances)
+	return balances, err
+}
+
+// Holdings returns the shares a user holds, by market
+func (c *Client) Holdings(ctx context.Context, userId string) (map[string]models.Stocksymbol, error) {
+	var holdings map[string]models.Stocksymbol
+	err := c.do(ctx, http.MethodGet, "/getUserStock/"+url.PathEscape(userId), nil, nil, &holdings)
+	return holdings, err
+}
+
+func (c *Client) Portfolio(ctx context.Context, userId string) (models.Portfolio, error) {
+	var portfolio models.Portfolio
+	err := c.do(ctx, http.MethodGet, "/portfolio/"+url.PathEscape(userId), nil, nil, &portfolio)
+	return portfolio, err
+}
+
+// Stocks returns every holding by market and user
+func (c *Client) Stocks(ctx context.Context) (models.Stock, error) {
+	var stocks models.Stock
+	err := c.do(ctx, http.MethodGet, "/getStocks", nil, nil, &stocks)
+	return stocks, err
+}
+
+// Onramp opens a deposit intent, the balance is credited once the gateway confirms it
+func (c *Client) Onramp(ctx context.Context, userId string, amount int) (models.DepositIntent, error) {
+	var intent models.DepositIntent
+	err := c.do(ctx, http.MethodPost, "/onramp/inr", nil, models.OnrampUser{UserId: userId, Amount: amount}, &intent)
+	return intent, err
+}
+
+func (c *Client) DepositIntent(ctx context.Context, id string) (models.DepositIntent, error) {
+	var intent models.DepositIntent
+	err := c.do(ctx, http.MethodGet, "/onramp/inr/"+url.PathEscape(id), nil, nil, &intent)
+	return intent, err
+}
+
+func (c *Client) Offramp(ctx context.Context, userId string, amount int) (models.Withdrawal, error) {
+	var withdrawal models.Withdrawal
+	err := c.do(ctx, http.MethodPost, "/offramp/inr", nil, models.OfframpUser{UserId: userId, Amount: amount}, &withdrawal)
+	return withdrawal, err
+}
+
+func (c *Client) Withdrawal(ctx context.Context, id string) (models.Withdrawal, error) {
+	var withdrawal models.Withdrawal
+	err := c.do(ctx, http.MethodGet, "/offramp/inr/"+url.PathEscape(id), nil, nil, &withdrawal)
+	return withdrawal, err
+}
+
+// CreateMarket opens a market, the creator gets the initial YES and NO shares
+func (c *Client) CreateMarket(ctx context.Context, userId, symbol string) (models.Pricing, error) {
+	var book models.Pricing
+	err := c.do(ctx, http.MethodPost, "/symbol/create", nil, models.CreateSymbol{UserId: userId, Stock: symbol}, &book)
+	return book, err
+}
+
+// CreateMarketWithMaker creates a market seeded with an LMSR market maker
+func (c *Client) CreateMarketWithMaker(ctx context.Context, userId, symbol string, seed models.MakerSeed) (models.Pricing, error) {
+	var book models.Pricing
+	err := c.do(ctx, http.MethodPost, "/symbol/create", nil, models.CreateSymbol{UserId: userId, Stock: symbol, Amm: &seed}, &book)
+	return book, err
+}
+
+func (c *Client) ResolveMarket(ctx context.Context, symbol, outcome string) (models.Resolution, error) {
+	var resolution models.Resolution
+	err := c.do(ctx, http.MethodPost, "/symbol/resolve", nil, models.ResolveSymbol{Stock: symbol, Outcome: outcome}, &resolution)
+	return resolution, err
+}
+
+func (c *Client) Orderbook(ctx context.Context, symbol string) (models.Pricing, error) {
+	var book models.Pricing
+	err := c.do(ctx, http.MethodGet, "/orderbook/"+url.PathEscape(symbol), nil, nil, &book)
+	return book, err
+}
+
+func (c *Client) Orderbooks(ctx context.Context) (models.Orderbook, error) {
+	var books models.Orderbook
+	err := c.do(ctx, http.MethodGet, "/orderbook/getorder", nil, nil, &books)
+	return books, err
+}
+
+func (c *Client) Tickers(ctx context.Context) ([]tickers.Ticker, error) {
+	var all []tickers.Ticker
+	err := c.do(ctx, http.MethodGet, "/tickers", nil, nil, &all)
+	return all, err
+}
+
+// MarketMaker returns the state, quotes and PnL of a market's maker
+func (c *Client) MarketMaker(ctx context.Context, symbol string) (amm.Status, error) {
+	var status amm.Status
+	err := c.do(ctx, http.MethodGet, "/markets/"+url.PathEscape(symbol)+"/amm", nil, nil, &status)
+	return status, err
+}
+
+// CandleFilter picks the candles Candles returns, empty fields take the API's
+// defaults: YES, 1m and the most recent candles
+type CandleFilter struct {
+	Outcome  string
+	Interval string
+	From     time.Time
+	To       time.Time
+}
+
+func (c *Client) Candles(ctx context.Context, symbol string, filter CandleFilter) (candles.Series, error) {
+	query := url.Values{}
+	if filter.Outcome != "" {
+		query.Set("outcome", filter.Outcome)
+	}
+	if filter.Interval != "" {
+		query.Set("interval", filter.Interval)
+	}
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+
+	var series candles.Series
+	err := c.do(ctx, http.MethodGet, "/markets/"+url.PathEscape(symbol)+"/candles", query, nil, &series)
+	return series, err
+}
+
+func (c *Client) PlaceOrder(ctx context.Context, req models.OrderRequest) (models.Order, error) {
+	var order models.Order
+	err := c.do(ctx, http.MethodPost, "/v1/orders", nil, req, &order)
+	return order, err
+}
+
+func (c *Client) Order(ctx context.Context, id string) (models.Order, error) {
+	var order models.Order
+	err := c.do(ctx, http.MethodGet, "/v1/orders/"+url.PathEscape(id), nil, nil, &order)
+	return order, err
+}
+
+// OrderFilter narrows down Orders, UserId is required
+type OrderFilter struct {
+	UserId string
+	Symbol string
+	Status string
+}
+
+func (c *Client) Orders(ctx context.Context, filter OrderFilter) ([]models.Order, error) {
+	query := url.Values{"userId": {filter.UserId}}
+	if filter.Symbol != "" {
+		query.Set("symbol", filter.Symbol)
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+
+	var orders []models.Order
+	err := c.do(ctx, http.MethodGet, "/v1/orders", query, nil, &orders)
+	return orders, err
+}
+
+// CancelOrder cancels what is left of an open order of userId, ORDER_NOT_OPEN
+// when it was already filled or cancelled
+func (c *Client) CancelOrder(ctx context.Context, userId, id string) (models.Order, error) {
+	var order models.Order
+	err := c.do(ctx, http.MethodDelete, "/v1/orders/"+url.PathEscape(id), url.Values{"userId": {userId}}, nil, &order)
+	return order, err
+}
+
+// TradeFilter narrows down Trades. After is the ID of the last trade seen,
+// without it the most recent trades are returned.
+type TradeFilter struct {
+	Symbol string
+	After  string
+	Limit  int
+}
+
+func (c *Client) Trades(ctx context.Context, filter TradeFilter) ([]models.Trade, error) {
+	query := url.Values{}
+	if filter.Symbol != "" {
+		query.Set("symbol", filter.Symbol)
+	}
+	if filter.After != "" {
+		query.Set("after", filter.After)
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var trades []models.Trade
+	err := c.do(ctx, http.MethodGet, "/trades", query, nil, &trades)
+	return trades, err
+}
+
+// VerifyLedger returns an error with code LEDGER_MISMATCH when balances and journal disagree
+func (c *Client) VerifyLedger(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/ledger/verify", nil, nil, nil)
+}
@@ -0,0 +1,678 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/client"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/services"
+	"github.com/sahilrush/src/tickers"
+	"github.com/sahilrush/src/transport"
+)
+
+var api *client.Client
+
+const operatorSecret = "client-test-operator-secret"
+
+// TestMain runs the API server with the engine in process, as TRANSPORT=inproc does
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "opnify-client")
+	if err != nil {
+		panic(err)
+	}
+
+	cfg := config.Defaults()
+	cfg.Queue.Transport = "inproc"
+	cfg.RateLimit.Enabled = false
+	cfg.Engine.CommandLog = dir + "/commands.log"
+	cfg.Engine.SnapshotPath = dir + "/snapshot.json"
+	cfg.Payments.WebhookSecret = "client-test-webhook-secret"
+	cfg.Payments.PayoutSecret = "client-test-payout-secret"
+	cfg.Payments.PayoutProcessor = "fake"
+	cfg.Market.OperatorSecret = operatorSecret
+	// Traders are funded by their first order, as in a demo
+	cfg.Features.AutoBalance = true
+	config.Current = cfg
+	logging.Setup(io.Discard, "error", "text")
+	gin.SetMode(gin.TestMode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := transport.NewInProc()
+	health, err := services.NewHealth(ctx, t)
+	if err != nil {
+		panic(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- services.RunEngine(ctx, t) }()
+
+	server := httptest.NewServer(services.NewRouter(t, health, nil))
+	api = client.New(server.URL)
+
+	code := m.Run()
+
+	server.Close()
+	cancel()
+	<-done
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "LIFE"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+
+	ask, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "maker", Symbol: "LIFE", Side: "sell", Outcome: "yes", Price: 6, Quantity: 10, ClientOrderId: "ask-1",
+	})
+	if err != nil {
+		t.Fatalf("place ask: %v", err)
+	}
+	if ask.Status != models.OrderOpen || ask.Remaining != 10 || ask.Type != models.OrderLimit {
+		t.Fatalf("ask = %+v, want open limit order resting 10", ask)
+	}
+
+	bid, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "taker", Symbol: "LIFE", Side: "buy", Outcome: "yes", Price: 6, Quantity: 4,
+	})
+	if err != nil {
+		t.Fatalf("place bid: %v", err)
+	}
+	if bid.Status != models.OrderFilled || len(bid.Fills) != 1 || bid.Fills[0].Maker != "maker" {
+		t.Fatalf("bid = %+v, want one fill against maker", bid)
+	}
+
+	ask, err = api.Order(ctx, ask.ID)
+	if err != nil {
+		t.Fatalf("get ask: %v", err)
+	}
+	if ask.Status != models.OrderPartiallyFilled || ask.Filled != 4 || ask.Remaining != 6 {
+		t.Fatalf("ask after fill = %+v, want 4 filled and 6 resting", ask)
+	}
+
+	open, err := api.Orders(ctx, client.OrderFilter{UserId: "maker", Symbol: "LIFE", Status: models.OrderOpen})
+	if err != nil {
+		t.Fatalf("list orders: %v", err)
+	}
+	if len(open) != 1 || open[0].ID != ask.ID {
+		t.Fatalf("open orders = %+v, want the ask", open)
+	}
+
+	book, err := api.Orderbook(ctx, "LIFE")
+	if err != nil {
+		t.Fatalf("orderbook: %v", err)
+	}
+	if book.Yes[6].Total != 6 {
+		t.Fatalf("YES at 6 = %d, want 6", book.Yes[6].Total)
+	}
+
+	if _, err := api.ResolveMarket(ctx, "LIFE", "yes"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if ask, _ = api.Order(ctx, ask.ID); ask.Status != models.OrderCancelled {
+		t.Fatalf("ask after resolve = %s, want cancelled", ask.Status)
+	}
+	if err := api.VerifyLedger(ctx); err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+}
+
+// TestSameLevelOrders rests a sell and a buy of the other outcome at the same
+// book position, each has to keep its own entry and release its own lock
+func TestSameLevelOrders(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "both", "SAME"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+
+	ask, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "both", Symbol: "SAME", Side: "sell", Outcome: "yes", Price: 6, Quantity: 10})
+	if err != nil {
+		t.Fatalf("place ask: %v", err)
+	}
+	bid, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "both", Symbol: "SAME", Side: "buy", Outcome: "no", Price: 4, Quantity: 10})
+	if err != nil {
+		t.Fatalf("place bid: %v", err)
+	}
+
+	book, err := api.Orderbook(ctx, "SAME")
+	if err != nil {
+		t.Fatalf("orderbook: %v", err)
+	}
+	if level := book.Yes[6]; level.Total != 20 || len(level.Orders) != 2 {
+		t.Fatalf("YES at 6 = %+v, want two orders of 10", level)
+	}
+
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "lifter", Symbol: "SAME", Side: "buy", Outcome: "yes", Price: 6, Quantity: 20}); err != nil {
+		t.Fatalf("lift level: %v", err)
+	}
+	for _, id := range []string{ask.ID, bid.ID} {
+		if order, _ := api.Order(ctx, id); order.Status != models.OrderFilled || order.Filled != 10 {
+			t.Fatalf("order %s = %+v, want 10 filled", id, order)
+		}
+	}
+	balance, err := api.Balance(ctx, "both")
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if balance.Locked != 0 || balance.Balance < 0 {
+		t.Fatalf("balance = %+v, want nothing locked", balance)
+	}
+	if err := api.VerifyLedger(ctx); err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+}
+
+// TestTimePriority fills the orders resting at a price in the order they
+// arrived, whoever placed them
+func TestTimePriority(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "FIFO"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	bids := map[string]models.Order{}
+	for _, userId := range []string{"zed", "amy"} {
+		bid, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: userId, Symbol: "FIFO", Side: "buy", Outcome: "no", Price: 3, Quantity: 5})
+		if err != nil {
+			t.Fatalf("place %s bid: %v", userId, err)
+		}
+		bids[userId] = bid
+	}
+
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "lifter", Symbol: "FIFO", Side: "buy", Outcome: "yes", Price: 7, Quantity: 7}); err != nil {
+		t.Fatalf("lift level: %v", err)
+	}
+	tests := []struct {
+		userId    string
+		status    string
+		remaining int
+	}{
+		{"zed", models.OrderFilled, 0},
+		{"amy", models.OrderPartiallyFilled, 3},
+	}
+	for _, tt := range tests {
+		order, err := api.Order(ctx, bids[tt.userId].ID)
+		if err != nil {
+			t.Fatalf("order: %v", err)
+		}
+		if order.Status != tt.status || order.Remaining != tt.remaining {
+			t.Errorf("%s bid = %s with %d left, want %s with %d", tt.userId, order.Status, order.Remaining, tt.status, tt.remaining)
+		}
+	}
+}
+
+// TestBuyCoversTakerFee spends a whole balance: the funds check counts the
+// taker fee, and what rests after the fills is locked from what is left
+func TestBuyCoversTakerFee(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "FEES"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "maker", Symbol: "FEES", Side: "sell", Outcome: "yes", Price: 5, Quantity: 100}); err != nil {
+		t.Fatalf("place ask: %v", err)
+	}
+	// The first order opens the account with the initial balance
+	first, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "spender", Symbol: "FEES", Side: "buy", Outcome: "no", Price: 1, Quantity: 1})
+	if err != nil {
+		t.Fatalf("place first order: %v", err)
+	}
+	if _, err := api.CancelOrder(ctx, "spender", first.ID); err != nil {
+		t.Fatalf("cancel first order: %v", err)
+	}
+	user, err := api.Balance(ctx, "spender")
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if _, err := api.Offramp(ctx, "spender", user.Balance-1000); err != nil {
+		t.Fatalf("offramp: %v", err)
+	}
+
+	// 200 at 5 is the whole balance, the 1% taker fee does not fit
+	_, err = api.PlaceOrder(ctx, models.OrderRequest{UserId: "spender", Symbol: "FEES", Side: "buy", Outcome: "yes", Price: 5, Quantity: 200})
+	if !apierr.Is(err, apierr.InsufficientBalance) {
+		t.Fatalf("buy without room for the fee: err = %v, want INSUFFICIENT_BALANCE", err)
+	}
+
+	bid, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "spender", Symbol: "FEES", Side: "buy", Outcome: "yes", Price: 5, Quantity: 198})
+	if err != nil {
+		t.Fatalf("place bid: %v", err)
+	}
+	if bid.Filled != 100 || bid.Remaining != 98 {
+		t.Fatalf("bid = %+v, want 100 filled and 98 resting", bid)
+	}
+	balance, err := api.Balance(ctx, "spender")
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if want := (models.UserBalance{Balance: 5, Locked: 490}); balance.Balance != want.Balance || balance.Locked != want.Locked {
+		t.Fatalf("balance = %+v, want %d available and %d locked", balance, want.Balance, want.Locked)
+	}
+	if err := api.VerifyLedger(ctx); err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "ERRS"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	if _, err := api.CreateUser(ctx, "twice"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	order := models.OrderRequest{UserId: "maker", Symbol: "ERRS", Side: "sell", Outcome: "no", Price: 5, Quantity: 1, ClientOrderId: "dup"}
+	if _, err := api.PlaceOrder(ctx, order); err != nil {
+		t.Fatalf("place order: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code apierr.Code
+	}{
+		{"price above range", func() error {
+			_, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "u", Symbol: "ERRS", Side: "buy", Outcome: "yes", Price: 12, Quantity: 1})
+			return err
+		}, apierr.PriceOutOfRange},
+		{"unknown market", func() error {
+			_, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "u", Symbol: "NOPE", Side: "buy", Outcome: "yes", Price: 5, Quantity: 1})
+			return err
+		}, apierr.MarketNotFound},
+		{"more shares than held", func() error {
+			_, err := api.PlaceOrder(ctx, models.OrderRequest{UserId: "u", Symbol: "ERRS", Side: "sell", Outcome: "yes", Price: 5, Quantity: 1})
+			return err
+		}, apierr.InsufficientShares},
+		{"client order id reused", func() error {
+			_, err := api.PlaceOrder(ctx, order)
+			return err
+		}, apierr.DuplicateClientOrderID},
+		{"unknown order", func() error {
+			_, err := api.Order(ctx, "missing")
+			return err
+		}, apierr.OrderNotFound},
+		{"user exists", func() error {
+			_, err := api.CreateUser(ctx, "twice")
+			return err
+		}, apierr.UserExists},
+		{"unknown user", func() error {
+			_, err := api.Balance(ctx, "nobody")
+			return err
+		}, apierr.UserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !apierr.Is(err, tt.code) {
+				t.Fatalf("err = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "IDEM"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+
+	ctx = client.WithIdempotencyKey(ctx, "idem-1")
+	order := models.OrderRequest{UserId: "maker", Symbol: "IDEM", Side: "sell", Outcome: "yes", Price: 7, Quantity: 2}
+	first, err := api.PlaceOrder(ctx, order)
+	if err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	again, err := api.PlaceOrder(ctx, order)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("retry placed order %s, want the first one %s", again.ID, first.ID)
+	}
+}
+
+func TestCancelOrderAndTrades(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "CNCL"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "maker", Symbol: "CNCL", Side: "sell", Outcome: "yes", Price: 6, Quantity: 3,
+	}); err != nil {
+		t.Fatalf("place ask: %v", err)
+	}
+
+	// Fills 3 at 6 and rests 2 more as a bid, locking 2*6
+	bid, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "canceller", Symbol: "CNCL", Side: "buy", Outcome: "yes", Price: 6, Quantity: 5,
+	})
+	if err != nil {
+		t.Fatalf("place bid: %v", err)
+	}
+	before, err := api.Balance(ctx, "canceller")
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+
+	if _, err := api.CancelOrder(ctx, "maker", bid.ID); !apierr.Is(err, apierr.OrderNotFound) {
+		t.Fatalf("cancel by another user: err = %v, want %s", err, apierr.OrderNotFound)
+	}
+	cancelled, err := api.CancelOrder(ctx, "canceller", bid.ID)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if cancelled.Status != models.OrderCancelled || cancelled.Filled != 3 || cancelled.Remaining != 0 {
+		t.Fatalf("cancelled = %+v, want cancelled with 3 filled", cancelled)
+	}
+	if _, err := api.CancelOrder(ctx, "canceller", bid.ID); !apierr.Is(err, apierr.OrderNotOpen) {
+		t.Fatalf("second cancel: err = %v, want %s", err, apierr.OrderNotOpen)
+	}
+
+	after, err := api.Balance(ctx, "canceller")
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if after.Locked != before.Locked-12 || after.Balance != before.Balance+12 {
+		t.Fatalf("balance %+v after cancel, was %+v, want 12 unlocked", after, before)
+	}
+	book, err := api.Orderbook(ctx, "CNCL")
+	if err != nil {
+		t.Fatalf("orderbook: %v", err)
+	}
+	if len(book.Yes) != 0 || len(book.No) != 0 {
+		t.Fatalf("book = %+v, want empty", book)
+	}
+
+	trades, err := api.Trades(ctx, client.TradeFilter{Symbol: "CNCL"})
+	if err != nil {
+		t.Fatalf("trades: %v", err)
+	}
+	if len(trades) != 1 || trades[0].Buyer != "canceller" || trades[0].Quantity != 3 {
+		t.Fatalf("trades = %+v, want the one fill", trades)
+	}
+	newer, err := api.Trades(ctx, client.TradeFilter{Symbol: "CNCL", After: trades[0].ID})
+	if err != nil {
+		t.Fatalf("trades after cursor: %v", err)
+	}
+	if len(newer) != 0 {
+		t.Fatalf("trades after the last one = %+v, want none", newer)
+	}
+	if err := api.VerifyLedger(ctx); err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+}
+
+func TestPortfolio(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "seller", "PNL"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "seller", Symbol: "PNL", Side: "sell", Outcome: "yes", Price: 4, Quantity: 10,
+	}); err != nil {
+		t.Fatalf("place ask: %v", err)
+	}
+	// Buys 10 at 4 and sells 4 of them at 7
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "trader", Symbol: "PNL", Side: "buy", Outcome: "yes", Price: 4, Quantity: 10,
+	}); err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "bidder", Symbol: "PNL", Side: "buy", Outcome: "yes", Price: 7, Quantity: 4,
+	}); err != nil {
+		t.Fatalf("bid: %v", err)
+	}
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "trader", Symbol: "PNL", Side: "sell", Outcome: "yes", Price: 7, Quantity: 4,
+	}); err != nil {
+		t.Fatalf("sell: %v", err)
+	}
+
+	holdings, err := api.Holdings(ctx, "trader")
+	if err != nil {
+		t.Fatalf("holdings: %v", err)
+	}
+	if holdings["PNL"]["yes"].Quantity != 6 {
+		t.Fatalf("holdings = %+v, want 6 YES in PNL", holdings)
+	}
+
+	portfolio, err := api.Portfolio(ctx, "trader")
+	if err != nil {
+		t.Fatalf("portfolio: %v", err)
+	}
+	if len(portfolio.Positions) != 1 {
+		t.Fatalf("positions = %+v, want one", portfolio.Positions)
+	}
+	p := portfolio.Positions[0]
+	if p.Quantity != 6 || p.AvgPrice != 4 || p.Cost != 24 || p.RealizedPnl != 12 {
+		t.Fatalf("position = %+v, want 6 held at 4 and 12 realized", p)
+	}
+	if p.MarkSource != "last" || p.MarkPrice != 7 || p.Value != 42 || p.UnrealizedPnl != 18 {
+		t.Fatalf("position = %+v, want 6 marked at the last price 7", p)
+	}
+
+	if _, err := api.Portfolio(ctx, "nobody"); !apierr.Is(err, apierr.UserNotFound) {
+		t.Fatalf("unknown user: err = %v, want %s", err, apierr.UserNotFound)
+	}
+}
+
+func TestCandles(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "OHLC"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	for _, price := range []int{5, 7, 6} {
+		if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+			UserId: "maker", Symbol: "OHLC", Side: "sell", Outcome: "yes", Price: price, Quantity: 2,
+		}); err != nil {
+			t.Fatalf("place ask at %d: %v", price, err)
+		}
+		if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+			UserId: "candle-buyer", Symbol: "OHLC", Side: "buy", Outcome: "yes", Price: price, Quantity: 2,
+		}); err != nil {
+			t.Fatalf("buy at %d: %v", price, err)
+		}
+	}
+
+	// The trades may straddle a candle boundary, so check what adds up
+	for _, outcome := range []string{"yes", "no"} {
+		series, err := api.Candles(ctx, "OHLC", client.CandleFilter{Outcome: outcome, Interval: "1h"})
+		if err != nil {
+			t.Fatalf("%s candles: %v", outcome, err)
+		}
+		high, low, volume, trades := 0, models.ContractPrice, 0, 0
+		for _, candle := range series.Candles {
+			high, low = max(high, candle.High), min(low, candle.Low)
+			volume += candle.Volume
+			trades += candle.Trades
+		}
+		wantHigh, wantLow := 7, 5
+		if outcome == "no" {
+			wantHigh, wantLow = 5, 3
+		}
+		if high != wantHigh || low != wantLow || volume != 6 || trades != 3 {
+			t.Fatalf("%s candles = %+v, want high %d, low %d, 6 traded in 3 trades", outcome, series.Candles, wantHigh, wantLow)
+		}
+	}
+
+	future, err := api.Candles(ctx, "OHLC", client.CandleFilter{From: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("future candles: %v", err)
+	}
+	if len(future.Candles) != 0 {
+		t.Fatalf("candles from an hour ahead = %+v, want none", future.Candles)
+	}
+
+	if _, err := api.Candles(ctx, "OHLC", client.CandleFilter{Interval: "2m"}); !apierr.Is(err, apierr.InvalidRequest) {
+		t.Fatalf("unknown interval: err = %v, want %s", err, apierr.InvalidRequest)
+	}
+	if _, err := api.Candles(ctx, "NOPE", client.CandleFilter{}); !apierr.Is(err, apierr.MarketNotFound) {
+		t.Fatalf("unknown market: err = %v, want %s", err, apierr.MarketNotFound)
+	}
+}
+
+func TestTickers(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateMarket(ctx, "maker", "TICK"); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	ticker := func() tickers.Ticker {
+		all, err := api.Tickers(ctx)
+		if err != nil {
+			t.Fatalf("tickers: %v", err)
+		}
+		for _, ticker := range all {
+			if ticker.Symbol == "TICK" {
+				return ticker
+			}
+		}
+		t.Fatalf("no ticker for TICK in %+v", all)
+		return tickers.Ticker{}
+	}
+	seeded := ticker().OpenInterest
+
+	orders := []models.OrderRequest{
+		{UserId: "maker", Symbol: "TICK", Side: "sell", Outcome: "yes", Price: 6, Quantity: 5},
+		{UserId: "tick-yes", Symbol: "TICK", Side: "buy", Outcome: "yes", Price: 6, Quantity: 2},
+		// Rests as a YES bid at 5, then a NO buyer at 5 mints 3 pairs against it
+		{UserId: "tick-yes", Symbol: "TICK", Side: "buy", Outcome: "yes", Price: 5, Quantity: 4},
+		{UserId: "tick-no", Symbol: "TICK", Side: "buy", Outcome: "no", Price: 5, Quantity: 3},
+	}
+	for _, order := range orders {
+		if _, err := api.PlaceOrder(ctx, order); err != nil {
+			t.Fatalf("place %+v: %v", order, err)
+		}
+	}
+
+	got := ticker()
+	if got.LastPrice != 5 || got.Volume24h != 5 || got.Change24h != -1 || got.Traders != 3 {
+		t.Fatalf("ticker = %+v, want last 5, 5 traded, -1 on the day, 3 traders", got)
+	}
+	if got.Yes != (tickers.Quote{Bid: 5, Ask: 6}) || got.No != (tickers.Quote{Bid: 0, Ask: 5}) {
+		t.Fatalf("quotes = %+v / %+v, want YES 5/6 and NO -/5", got.Yes, got.No)
+	}
+	if got.OpenInterest != seeded+3 {
+		t.Fatalf("open interest = %d, want %d", got.OpenInterest, seeded+3)
+	}
+
+	if _, err := api.ResolveMarket(ctx, "TICK", "yes"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if got := ticker(); got.Resolved != "yes" || got.OpenInterest != 0 || got.Yes != (tickers.Quote{}) {
+		t.Fatalf("ticker after resolve = %+v, want resolved with no open interest or quotes", got)
+	}
+}
+
+func TestMarketMaker(t *testing.T) {
+	ctx := context.Background()
+	if _, err := api.CreateUser(ctx, "amm-broke"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	refused := []struct {
+		name string
+		seed models.MakerSeed
+		code apierr.Code
+	}{
+		{"no liquidity", models.MakerSeed{}, apierr.InvalidRequest},
+		{"unknown funder", models.MakerSeed{Liquidity: 10, FundedBy: "bank"}, apierr.InvalidRequest},
+		{"creator cannot fund", models.MakerSeed{Liquidity: 10}, apierr.InsufficientBalance},
+		{"platform funding needs the operator", models.MakerSeed{Liquidity: 10, FundedBy: "platform"}, apierr.InvalidSignature},
+	}
+	for _, tc := range refused {
+		if _, err := api.CreateMarketWithMaker(ctx, "amm-broke", "AMMX", tc.seed); !apierr.Is(err, tc.code) {
+			t.Errorf("%s: err = %v, want %s", tc.name, err, tc.code)
+		}
+	}
+
+	operator := client.New(api.BaseURL)
+	operator.OperatorSecret = operatorSecret
+	if _, err := operator.CreateMarketWithMaker(ctx, "maker", "AMM", models.MakerSeed{Liquidity: 100, FundedBy: "platform"}); err != nil {
+		t.Fatalf("create market: %v", err)
+	}
+	status, err := api.MarketMaker(ctx, "AMM")
+	if err != nil {
+		t.Fatalf("market maker: %v", err)
+	}
+	if status.Maker.Subsidy != 694 || status.Cash != 694 || status.Prices.Yes != 5 || status.Yes != (amm.MakerQuote{Bid: 4, Ask: 6}) {
+		t.Fatalf("seeded maker = %+v, want 694 subsidy in cash, YES at 5 quoted 4/6", status)
+	}
+
+	// Nobody moves the maker's money but the engine
+	if _, err := api.Offramp(ctx, "amm:AMM", 694); !apierr.Is(err, apierr.InvalidRequest) {
+		t.Fatalf("offramp from the maker: err = %v, want %s", err, apierr.InvalidRequest)
+	}
+	if _, err := api.Onramp(ctx, "amm:AMM", 100); !apierr.Is(err, apierr.InvalidRequest) {
+		t.Fatalf("onramp to the maker: err = %v, want %s", err, apierr.InvalidRequest)
+	}
+
+	// The maker quotes 6, so the ask resting at 5 fills first
+	if _, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "maker", Symbol: "AMM", Side: "sell", Outcome: "yes", Price: 5, Quantity: 3,
+	}); err != nil {
+		t.Fatalf("place ask: %v", err)
+	}
+	buy, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "amm-yes", Symbol: "AMM", Side: "buy", Outcome: "yes", Type: models.OrderMarket, Quantity: 10,
+	})
+	if err != nil {
+		t.Fatalf("place buy: %v", err)
+	}
+	if buy.Status != models.OrderFilled || len(buy.Fills) != 2 ||
+		buy.Fills[0].Maker != "maker" || buy.Fills[0].Price != 5 || buy.Fills[0].Quantity != 3 ||
+		buy.Fills[1].Maker != "amm:AMM" || buy.Fills[1].Price != 6 || buy.Fills[1].Quantity != 7 {
+		t.Fatalf("buy = %+v, want 3 at 5 from the book then 7 at 6 from the maker", buy)
+	}
+
+	// The maker minted 7 pairs for 70, sold the YES for 42 and keeps the NO
+	status, _ = api.MarketMaker(ctx, "AMM")
+	if status.Maker.NetYes != 7 || status.Holdings.No != 7 || status.Cash != 666 || status.Prices.Yes <= 5 {
+		t.Fatalf("maker after buy = %+v, want 7 YES sold, 7 NO held, 666 cash", status)
+	}
+
+	sell, err := api.PlaceOrder(ctx, models.OrderRequest{
+		UserId: "amm-yes", Symbol: "AMM", Side: "sell", Outcome: "yes", Type: models.OrderMarket, Quantity: 7,
+	})
+	if err != nil {
+		t.Fatalf("place sell: %v", err)
+	}
+	if sell.Status != models.OrderFilled || len(sell.Fills) != 1 || sell.Fills[0].Price != 5 {
+		t.Fatalf("sell = %+v, want 7 sold to the maker at 5", sell)
+	}
+
+	// Buying the YES back completes 7 pairs, which the maker redeems for 70
+	status, _ = api.MarketMaker(ctx, "AMM")
+	if status.Maker.NetYes != 0 || status.Holdings.Yes+status.Holdings.No != 0 || status.Cash != 701 || status.Pnl != 7 {
+		t.Fatalf("maker after sell = %+v, want flat with 701 cash and 7 profit", status)
+	}
+	if err := api.VerifyLedger(ctx); err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+	if report := engine.RunChecks("test"); !report.OK() {
+		t.Fatalf("invariants: %+v", report.Violations)
+	}
+
+	if _, err := api.ResolveMarket(ctx, "AMM", "no"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	status, _ = api.MarketMaker(ctx, "AMM")
+	if !status.Maker.Settled || status.Maker.Returned != 701 || status.Pnl != 7 {
+		t.Fatalf("maker after resolve = %+v, want 701 returned to the platform", status)
+	}
+	if balances, _ := api.Balances(ctx); balances["amm:AMM"] != (models.UserBalance{}) {
+		t.Fatalf("maker account still holds %+v", balances["amm:AMM"])
+	}
+	if report := engine.RunChecks("test"); !report.OK() {
+		t.Fatalf("invariants after resolve: %+v", report.Violations)
+	}
+}
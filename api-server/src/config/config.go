@@ -0,0 +1,529 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration reads as a Go duration string such as "10s" or "24h"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Server struct {
+	// Addr is where the API server listens
+	Addr string `json:"addr"`
+	// PublicURL is how the engine and gateways reach the API server
+	PublicURL string `json:"publicUrl"`
+	// InstanceID names this API server's reply channel, random when empty
+	InstanceID string `json:"instanceId"`
+	// DrainPeriod is how long the server keeps serving on SIGTERM with its
+	// readiness probe failing, so the load balancer stops sending it requests
+	// first. Make it longer than the probe interval.
+	DrainPeriod Duration `json:"drainPeriod"`
+	// ShutdownTimeout bounds how long in-flight requests get to finish on SIGTERM
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// TrustedProxies are the IPs and CIDRs of the proxies in front of the API
+	// server. Only they may name the client IP in X-Forwarded-For, none by default.
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+type Redis struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	TLS      bool   `json:"tls"`
+}
+
+type Queue struct {
+	// Transport is "redis" or "inproc"
+	Transport string `json:"transport"`
+	Stream    string `json:"stream"`
+	// MaxLen roughly caps how many entries the stream keeps
+	MaxLen       int64    `json:"maxLen"`
+	Group        string   `json:"group"`
+	ReplyPrefix  string   `json:"replyPrefix"`
+	ReplyTimeout Duration `json:"replyTimeout"`
+}
+
+type Engine struct {
+	// Consumer names this engine in the consumer group, the hostname when empty
+	Consumer  string   `json:"consumer"`
+	ClaimIdle Duration `json:"claimIdle"`
+
+	// IdempotencyWindow is how long replies are kept for retries and redeliveries
+	IdempotencyWindow Duration `json:"idempotencyWindow"`
+	// CommandLog is where every command is appended before it is acknowledged,
+	// the commands since the last snapshot are run again on start
+	CommandLog string `json:"commandLog"`
+	// SnapshotPath is where the engine state is written every SnapshotEvery
+	// commands and on shutdown, and read on start
+	SnapshotPath  string `json:"snapshotPath"`
+	SnapshotEvery int    `json:"snapshotEvery"`
+	// HeartbeatInterval is how often the engine tells API servers it is alive
+	HeartbeatInterval Duration `json:"heartbeatInterval"`
+	// MetricsAddr serves the engine binary's /metrics, empty turns it off
+	MetricsAddr string `json:"metricsAddr"`
+
+	InvariantInterval Duration `json:"invariantInterval"`
+	// Debug runs the invariant checker after every command
+	Debug bool `json:"debug"`
+}
+
+// Market holds the defaults new users and markets start with
+type Market struct {
+	// InitialBalance is granted to a user placing their first order without an account
+	InitialBalance int `json:"initialBalance"`
+	// InitialShares of each outcome go to the user creating a market
+	InitialShares int `json:"initialShares"`
+	// MaxMakerLiquidity caps the liquidity a market maker can be seeded with
+	MaxMakerLiquidity float64 `json:"maxMakerLiquidity"`
+	// OperatorSecret signs the platform operator's requests, the only ones
+	// allowed to fund a market maker from the platform. Empty means nobody can.
+	OperatorSecret string `json:"operatorSecret"`
+	// SubsidyBudget caps the INR the platform has in the makers of markets not
+	// resolved yet
+	SubsidyBudget int `json:"subsidyBudget"`
+}
+
+// Risk holds the thresholds of the pre-trade checks, zero disables a check
+type Risk struct {
+	MaxOrderQuantity int `json:"maxOrderQuantity"`
+	MaxNotional      int `json:"maxNotional"`
+	// MaxPosition caps the YES or NO shares a user holds in one market,
+	// counting what their open buys would add
+	MaxPosition   int `json:"maxPosition"`
+	MaxOpenOrders int `json:"maxOpenOrders"`
+	// PriceBand is how far a limit price may be from the last traded price
+	PriceBand int `json:"priceBand"`
+}
+
+type Payments struct {
+	// WebhookSecret is the key the gateway signs deposit callbacks with. It has
+	// no default: a deployment must set its own, at least minSecret long.
+	WebhookSecret string `json:"webhookSecret"`
+	// PayoutSecret is the key the payout rail signs withdrawal status
+	// callbacks with, required like WebhookSecret
+	PayoutSecret string `json:"payoutSecret"`
+	// StubGatewayAddr starts a local stub gateway on this address when set
+	StubGatewayAddr string `json:"stubGatewayAddr"`
+	// PayoutProcessor names the rail withdrawals are paid out through. It has
+	// no default either, a deployment picks one; "fake" completes every payout
+	// without moving any money and is only for development.
+	PayoutProcessor string `json:"payoutProcessor"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error
+	Level string `json:"level"`
+	// Format is text or json
+	Format string `json:"format"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout or otlp
+	Exporter string `json:"exporter"`
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+	// SampleRatio is the share of new traces recorded, between 0 and 1
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+// Rate is a token bucket: Burst requests at once, refilled at Rate per second
+type Rate struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Budget is the rate each user and each client IP gets for a class of routes
+type Budget struct {
+	User Rate `json:"user"`
+	IP   Rate `json:"ip"`
+}
+
+type RateLimit struct {
+	Enabled bool `json:"enabled"`
+	// Store is redis, memory, or auto to follow queue.transport. Only redis
+	// holds the limits across API server instances.
+	Store   string `json:"store"`
+	Prefix  string `json:"prefix"`
+	Orders  Budget `json:"orders"`
+	Cancels Budget `json:"cancels"`
+	Reads   Budget `json:"reads"`
+	Writes  Budget `json:"writes"`
+	// Callbacks is the budget of the payment gateway and payout rail, which
+	// name no user so only the IP budget applies
+	Callbacks Budget `json:"callbacks"`
+}
+
+// Features switch optional behaviour on and off
+type Features struct {
+	RiskChecks bool `json:"riskChecks"`
+	Fees       bool `json:"fees"`
+	// AutoBalance grants InitialBalance to a user placing their first order
+	// without an account. The grant can be withdrawn like any other money, so
+	// it is off by default and meant for demos.
+	AutoBalance bool `json:"autoBalance"`
+	// MarketMakers lets new markets be seeded with an LMSR market maker
+	MarketMakers bool `json:"marketMakers"`
+}
+
+type Config struct {
+	Server    Server    `json:"server"`
+	Redis     Redis     `json:"redis"`
+	Queue     Queue     `json:"queue"`
+	Engine    Engine    `json:"engine"`
+	Market    Market    `json:"market"`
+	Risk      Risk      `json:"risk"`
+	Payments  Payments  `json:"payments"`
+	Log       Log       `json:"log"`
+	Tracing   Tracing   `json:"tracing"`
+	RateLimit RateLimit `json:"rateLimit"`
+	Features  Features  `json:"features"`
+}
+
+// minSecret is the shortest signing key Validate accepts
+const minSecret = 16
+
+// Current is the configuration in use, Load replaces it
+var Current = Defaults()
+
+// Defaults returns the configuration used when nothing is set
+func Defaults() Config {
+	return Config{
+		Server: Server{
+			Addr:            ":8080",
+			PublicURL:       "http://localhost:8080",
+			DrainPeriod:     Duration(15 * time.Second),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Redis: Redis{
+			Addr: "localhost:6379",
+		},
+		Queue: Queue{
+			Transport:    "redis",
+			Stream:       "apiToEngine",
+			MaxLen:       100000,
+			Group:        "engine",
+			ReplyPrefix:  "engineReplies:",
+			ReplyTimeout: Duration(10 * time.Second),
+		},
+		Engine: Engine{
+			ClaimIdle:         Duration(30 * time.Second),
+			IdempotencyWindow: Duration(24 * time.Hour),
+			CommandLog:        "commands.log",
+			SnapshotPath:      "snapshot.json",
+			SnapshotEvery:     1000,
+			HeartbeatInterval: Duration(5 * time.Second),
+			MetricsAddr:       ":9091",
+			InvariantInterval: Duration(time.Minute),
+		},
+		Market: Market{
+			InitialBalance:    10000,
+			InitialShares:     100,
+			MaxMakerLiquidity: 1000,
+			SubsidyBudget:     10000,
+		},
+		Risk: Risk{
+			MaxOrderQuantity: 1000,
+			MaxNotional:      100000,
+			MaxPosition:      5000,
+			MaxOpenOrders:    50,
+			PriceBand:        3,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimit{
+			Enabled: true,
+			Store:   "auto",
+			Prefix:  "ratelimit:",
+			Orders:  Budget{User: Rate{10, 20}, IP: Rate{50, 100}},
+			Cancels: Budget{User: Rate{10, 20}, IP: Rate{50, 100}},
+			Reads:   Budget{User: Rate{20, 40}, IP: Rate{100, 200}},
+			Writes:  Budget{User: Rate{5, 10}, IP: Rate{20, 40}},
+			// A gateway retries refused callbacks, so a burst is only delayed
+			Callbacks: Budget{User: Rate{50, 100}, IP: Rate{50, 100}},
+		},
+		Features: Features{
+			RiskChecks:   true,
+			Fees:         true,
+			AutoBalance:  false,
+			MarketMakers: true,
+		},
+	}
+}
+
+// Load reads the defaults, then the JSON file named by CONFIG_FILE (or
+// config.json when it exists), then environment variables, and makes the
+// result Current if it is valid
+func Load() error {
+	cfg := Defaults()
+
+	path, required := os.Getenv("CONFIG_FILE"), true
+	if path == "" {
+		path, required = "config.json", false
+	}
+	if err := cfg.readFile(path, required); err != nil {
+		return err
+	}
+	if err := cfg.readEnv(); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	Current = cfg
+	return nil
+}
+
+func (cfg *Config) readFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// readEnv applies the environment variables that are set
+func (cfg *Config) readEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*dst = value
+		}
+	}
+	num := func(name string, dst *int) {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	flag := func(name string, dst *bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = b
+		}
+	}
+	ratio := func(name string, dst *float64) {
+		if value, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*dst = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	duration := func(name string, dst *Duration) {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = Duration(d)
+		}
+	}
+
+	str("LISTEN_ADDR", &cfg.Server.Addr)
+	str("PUBLIC_URL", &cfg.Server.PublicURL)
+	str("API_INSTANCE_ID", &cfg.Server.InstanceID)
+	duration("DRAIN_PERIOD", &cfg.Server.DrainPeriod)
+	duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+
+	str("REDIS_ADDR", &cfg.Redis.Addr)
+	str("REDIS_PASSWORD", &cfg.Redis.Password)
+	num("REDIS_DB", &cfg.Redis.DB)
+	flag("REDIS_TLS", &cfg.Redis.TLS)
+
+	str("TRANSPORT", &cfg.Queue.Transport)
+	str("ENGINE_STREAM", &cfg.Queue.Stream)
+	str("ENGINE_GROUP", &cfg.Queue.Group)
+	duration("ENGINE_REPLY_TIMEOUT", &cfg.Queue.ReplyTimeout)
+
+	str("ENGINE_CONSUMER", &cfg.Engine.Consumer)
+	duration("IDEMPOTENCY_WINDOW", &cfg.Engine.IdempotencyWindow)
+	str("ENGINE_COMMAND_LOG", &cfg.Engine.CommandLog)
+	str("ENGINE_SNAPSHOT", &cfg.Engine.SnapshotPath)
+	num("ENGINE_SNAPSHOT_EVERY", &cfg.Engine.SnapshotEvery)
+	duration("ENGINE_HEARTBEAT_INTERVAL", &cfg.Engine.HeartbeatInterval)
+	str("ENGINE_METRICS_ADDR", &cfg.Engine.MetricsAddr)
+	duration("INVARIANT_CHECK_INTERVAL", &cfg.Engine.InvariantInterval)
+	flag("ENGINE_DEBUG", &cfg.Engine.Debug)
+
+	num("INITIAL_BALANCE", &cfg.Market.InitialBalance)
+	num("INITIAL_SHARES", &cfg.Market.InitialShares)
+	ratio("MAX_MAKER_LIQUIDITY", &cfg.Market.MaxMakerLiquidity)
+	str("OPERATOR_SECRET", &cfg.Market.OperatorSecret)
+	num("SUBSIDY_BUDGET", &cfg.Market.SubsidyBudget)
+
+	num("RISK_MAX_ORDER_QUANTITY", &cfg.Risk.MaxOrderQuantity)
+	num("RISK_MAX_NOTIONAL", &cfg.Risk.MaxNotional)
+	num("RISK_MAX_POSITION", &cfg.Risk.MaxPosition)
+	num("RISK_MAX_OPEN_ORDERS", &cfg.Risk.MaxOpenOrders)
+	num("RISK_PRICE_BAND", &cfg.Risk.PriceBand)
+
+	str("PAYMENT_WEBHOOK_SECRET", &cfg.Payments.WebhookSecret)
+	str("PAYOUT_WEBHOOK_SECRET", &cfg.Payments.PayoutSecret)
+	str("STUB_GATEWAY_ADDR", &cfg.Payments.StubGatewayAddr)
+	str("PAYOUT_PROCESSOR", &cfg.Payments.PayoutProcessor)
+
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+
+	str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	str("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	flag("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	ratio("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+
+	flag("RATE_LIMIT_ENABLED", &cfg.RateLimit.Enabled)
+	str("RATE_LIMIT_STORE", &cfg.RateLimit.Store)
+
+	flag("FEATURE_RISK_CHECKS", &cfg.Features.RiskChecks)
+	flag("FEATURE_FEES", &cfg.Features.Fees)
+	flag("FEATURE_AUTO_BALANCE", &cfg.Features.AutoBalance)
+	flag("FEATURE_MARKET_MAKERS", &cfg.Features.MarketMakers)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting that cannot work
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Server.Addr != "", "server.addr is required")
+	check(strings.HasPrefix(cfg.Server.PublicURL, "http://") || strings.HasPrefix(cfg.Server.PublicURL, "https://"),
+		"server.publicUrl must be an http(s) URL, got %q", cfg.Server.PublicURL)
+	check(cfg.Server.DrainPeriod >= 0, "server.drainPeriod must not be negative")
+	check(cfg.Server.ShutdownTimeout >= cfg.Queue.ReplyTimeout,
+		"server.shutdownTimeout must be at least queue.replyTimeout so waiting requests can finish")
+	for _, proxy := range cfg.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil,
+			"server.trustedProxies must be IPs or CIDRs, got %q", proxy)
+	}
+
+	check(cfg.Queue.Transport == "redis" || cfg.Queue.Transport == "inproc",
+		"queue.transport must be redis or inproc, got %q", cfg.Queue.Transport)
+	if cfg.Queue.Transport == "redis" {
+		check(cfg.Redis.Addr != "" && strings.TrimSpace(cfg.Redis.Addr) == cfg.Redis.Addr,
+			"redis.addr must be a host:port without spaces, got %q", cfg.Redis.Addr)
+		check(cfg.Redis.DB >= 0, "redis.db must not be negative")
+		check(cfg.Queue.Stream != "", "queue.stream is required")
+		check(cfg.Queue.Group != "", "queue.group is required")
+		check(cfg.Queue.ReplyPrefix != "", "queue.replyPrefix is required")
+	}
+	check(cfg.Queue.MaxLen > 0, "queue.maxLen must be positive")
+	check(cfg.Queue.ReplyTimeout > 0, "queue.replyTimeout must be positive")
+
+	check(cfg.Engine.ClaimIdle > 0, "engine.claimIdle must be positive")
+	check(cfg.Engine.IdempotencyWindow > 0, "engine.idempotencyWindow must be positive")
+	check(cfg.Engine.InvariantInterval > 0, "engine.invariantInterval must be positive")
+	check(cfg.Engine.CommandLog != "", "engine.commandLog is required")
+	check(cfg.Engine.SnapshotPath != "", "engine.snapshotPath is required")
+	check(cfg.Engine.CommandLog != cfg.Engine.SnapshotPath, "engine.commandLog and engine.snapshotPath must differ")
+	check(cfg.Engine.SnapshotEvery > 0, "engine.snapshotEvery must be positive")
+	check(cfg.Engine.HeartbeatInterval > 0, "engine.heartbeatInterval must be positive")
+
+	check(cfg.Market.InitialBalance >= 0, "market.initialBalance must not be negative")
+	check(cfg.Market.InitialShares >= 0, "market.initialShares must not be negative")
+	check(cfg.Market.MaxMakerLiquidity >= 0, "market.maxMakerLiquidity must not be negative")
+	check(cfg.Market.OperatorSecret == "" || len(cfg.Market.OperatorSecret) >= minSecret,
+		"market.operatorSecret must be at least %d characters when set (OPERATOR_SECRET)", minSecret)
+	check(cfg.Market.SubsidyBudget >= 0, "market.subsidyBudget must not be negative")
+
+	check(cfg.Risk.MaxOrderQuantity >= 0 && cfg.Risk.MaxNotional >= 0 && cfg.Risk.MaxPosition >= 0 &&
+		cfg.Risk.MaxOpenOrders >= 0 && cfg.Risk.PriceBand >= 0, "risk limits must not be negative, zero switches a check off")
+
+	check(len(cfg.Payments.WebhookSecret) >= minSecret, "payments.webhookSecret must be set to at least %d characters (PAYMENT_WEBHOOK_SECRET)", minSecret)
+	check(len(cfg.Payments.PayoutSecret) >= minSecret, "payments.payoutSecret must be set to at least %d characters (PAYOUT_WEBHOOK_SECRET)", minSecret)
+	check(cfg.Payments.PayoutProcessor != "", "payments.payoutProcessor must name the payout rail (PAYOUT_PROCESSOR)")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(cfg.Log.Level)) == nil, "log.level must be debug, info, warn or error, got %q", cfg.Log.Level)
+	check(cfg.Log.Format == "text" || cfg.Log.Format == "json", "log.format must be text or json, got %q", cfg.Log.Format)
+
+	check(cfg.Tracing.Exporter == "none" || cfg.Tracing.Exporter == "stdout" || cfg.Tracing.Exporter == "otlp",
+		"tracing.exporter must be none, stdout or otlp, got %q", cfg.Tracing.Exporter)
+	check(cfg.Tracing.Exporter != "otlp" || cfg.Tracing.Endpoint != "", "tracing.endpoint is required for the otlp exporter")
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "tracing.sampleRatio must be between 0 and 1")
+
+	if cfg.RateLimit.Enabled {
+		limits := cfg.RateLimit
+		check(limits.Store == "auto" || limits.Store == "redis" || limits.Store == "memory",
+			"rateLimit.store must be auto, redis or memory, got %q", limits.Store)
+		budget := func(class string, b Budget) {
+			check(b.User.Rate > 0 && b.User.Burst > 0, "rateLimit.%s.user needs a positive rate and burst", class)
+			check(b.IP.Rate > 0 && b.IP.Burst > 0, "rateLimit.%s.ip needs a positive rate and burst", class)
+		}
+		budget("orders", limits.Orders)
+		budget("cancels", limits.Cancels)
+		budget("reads", limits.Reads)
+		budget("writes", limits.Writes)
+		budget("callbacks", limits.Callbacks)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,234 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sahilrush/src/config"
+)
+
+const (
+	webhookSecret = "webhook-secret-for-tests"
+	payoutSecret  = "payout-secret-for-tests"
+)
+
+// valid returns the defaults with the settings that have none filled in
+func valid() config.Config {
+	cfg := config.Defaults()
+	cfg.Payments.WebhookSecret = webhookSecret
+	cfg.Payments.PayoutSecret = payoutSecret
+	cfg.Payments.PayoutProcessor = "fake"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.Config)
+		want   []string
+	}{
+		{"valid", func(*config.Config) {}, nil},
+		{"no secrets", func(cfg *config.Config) {
+			cfg.Payments = config.Payments{}
+		}, []string{"PAYMENT_WEBHOOK_SECRET", "PAYOUT_WEBHOOK_SECRET", "PAYOUT_PROCESSOR"}},
+		{"short secret", func(cfg *config.Config) {
+			cfg.Payments.PayoutSecret = "fifteen-chars.."
+		}, []string{"payments.payoutSecret must be set to at least 16 characters"}},
+		{"secret at the minimum", func(cfg *config.Config) {
+			cfg.Payments.WebhookSecret = "sixteen-chars..."
+		}, nil},
+		{"unknown transport", func(cfg *config.Config) {
+			cfg.Queue.Transport = "kafka"
+		}, []string{`queue.transport must be redis or inproc, got "kafka"`}},
+		{"inproc skips redis", func(cfg *config.Config) {
+			cfg.Queue.Transport = "inproc"
+			cfg.Redis.Addr = ""
+		}, nil},
+		{"redis address with spaces", func(cfg *config.Config) {
+			cfg.Redis.Addr = " localhost:6379"
+		}, []string{"redis.addr must be a host:port without spaces"}},
+		{"negative drain period", func(cfg *config.Config) {
+			cfg.Server.DrainPeriod = config.Duration(-time.Second)
+		}, []string{"server.drainPeriod must not be negative"}},
+		{"shutdown shorter than a reply", func(cfg *config.Config) {
+			cfg.Server.ShutdownTimeout = config.Duration(time.Second)
+		}, []string{"server.shutdownTimeout must be at least queue.replyTimeout"}},
+		{"trusted proxy that is not an address", func(cfg *config.Config) {
+			cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.7", "lb.internal"}
+		}, []string{`server.trustedProxies must be IPs or CIDRs, got "lb.internal"`}},
+		{"negative risk limit", func(cfg *config.Config) {
+			cfg.Risk.PriceBand = -1
+		}, []string{"risk limits must not be negative"}},
+		{"log and snapshot in one file", func(cfg *config.Config) {
+			cfg.Engine.CommandLog = cfg.Engine.SnapshotPath
+		}, []string{"engine.commandLog and engine.snapshotPath must differ"}},
+		{"never snapshotting", func(cfg *config.Config) {
+			cfg.Engine.SnapshotEvery = 0
+		}, []string{"engine.snapshotEvery must be positive"}},
+		{"short operator secret", func(cfg *config.Config) {
+			cfg.Market.OperatorSecret = "operator"
+		}, []string{"market.operatorSecret must be at least 16 characters when set"}},
+		{"otlp without endpoint", func(cfg *config.Config) {
+			cfg.Tracing.Exporter, cfg.Tracing.Endpoint = "otlp", ""
+		}, []string{"tracing.endpoint is required for the otlp exporter"}},
+		{"sample ratio above one", func(cfg *config.Config) {
+			cfg.Tracing.SampleRatio = 1.5
+		}, []string{"tracing.sampleRatio must be between 0 and 1"}},
+		{"empty budget", func(cfg *config.Config) {
+			cfg.RateLimit.Writes.IP = config.Rate{}
+		}, []string{"rateLimit.writes.ip needs a positive rate and burst"}},
+		{"budgets ignored when disabled", func(cfg *config.Config) {
+			cfg.RateLimit.Enabled = false
+			cfg.RateLimit.Writes = config.Budget{}
+		}, nil},
+		{"every problem at once", func(cfg *config.Config) {
+			cfg.Log.Level, cfg.Log.Format = "loud", "xml"
+		}, []string{`log.level must be debug, info, warn or error, got "loud"`, `log.format must be text or json, got "xml"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate = nil, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want it to mention %q", err, want)
+				}
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; lines != len(tt.want) {
+				t.Errorf("Validate reported %d problems, want %d:\n%v", lines, len(tt.want), err)
+			}
+		})
+	}
+}
+
+// load runs Load from an empty directory with only the given environment
+// and config file, and puts Current back afterwards
+func load(t *testing.T, env map[string]string, file string) error {
+	t.Helper()
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("CONFIG_FILE", "")
+	if file != "" {
+		path := filepath.Join(dir, "test.json")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_FILE", path)
+	}
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", webhookSecret)
+	t.Setenv("PAYOUT_WEBHOOK_SECRET", payoutSecret)
+	t.Setenv("PAYOUT_PROCESSOR", "fake")
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	return config.Load()
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults need the secrets", func(t *testing.T) {
+		err := load(t, map[string]string{"PAYMENT_WEBHOOK_SECRET": "", "PAYOUT_WEBHOOK_SECRET": ""}, "")
+		if err == nil || !strings.Contains(err.Error(), "PAYMENT_WEBHOOK_SECRET") || !strings.Contains(err.Error(), "PAYOUT_WEBHOOK_SECRET") {
+			t.Errorf("Load = %v, want both secrets reported", err)
+		}
+	})
+
+	t.Run("defaults with the secrets, no config.json", func(t *testing.T) {
+		if err := load(t, nil, ""); err != nil {
+			t.Fatalf("Load = %v", err)
+		}
+		if want := valid(); !reflect.DeepEqual(config.Current, want) {
+			t.Errorf("Current = %+v, want the defaults", config.Current)
+		}
+	})
+
+	t.Run("environment overrides", func(t *testing.T) {
+		err := load(t, map[string]string{
+			"LISTEN_ADDR":          ":9000",
+			"TRANSPORT":            "inproc",
+			"REDIS_DB":             "2",
+			"IDEMPOTENCY_WINDOW":   "1h",
+			"MAX_MAKER_LIQUIDITY":  "250.5",
+			"FEATURE_FEES":         "false",
+			"TRACING_SAMPLE_RATIO": "0.25",
+			"TRUSTED_PROXIES":      "10.0.0.0/8, 192.168.1.7",
+			"RISK_MAX_POSITION":    "0",
+		}, "")
+		if err != nil {
+			t.Fatalf("Load = %v", err)
+		}
+		cfg := config.Current
+		if cfg.Server.Addr != ":9000" || cfg.Queue.Transport != "inproc" || cfg.Redis.DB != 2 ||
+			cfg.Engine.IdempotencyWindow != config.Duration(time.Hour) || cfg.Market.MaxMakerLiquidity != 250.5 ||
+			cfg.Features.Fees || cfg.Tracing.SampleRatio != 0.25 || cfg.Risk.MaxPosition != 0 ||
+			!reflect.DeepEqual(cfg.Server.TrustedProxies, []string{"10.0.0.0/8", "192.168.1.7"}) {
+			t.Errorf("Current = %+v", cfg)
+		}
+	})
+
+	t.Run("unparsable environment", func(t *testing.T) {
+		saved := config.Current
+		err := load(t, map[string]string{"REDIS_DB": "two", "ENGINE_DEBUG": "maybe", "SHUTDOWN_TIMEOUT": "soon"}, "")
+		for _, name := range []string{"REDIS_DB", "ENGINE_DEBUG", "SHUTDOWN_TIMEOUT"} {
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("Load = %v, want %s reported", err, name)
+			}
+		}
+		if !reflect.DeepEqual(config.Current, saved) {
+			t.Error("a failed Load replaced Current")
+		}
+	})
+
+	t.Run("file then environment", func(t *testing.T) {
+		file := `{"server":{"addr":":7000","shutdownTimeout":"45s"},"market":{"initialBalance":500},"rateLimit":{"store":"memory"}}`
+		if err := load(t, map[string]string{"INITIAL_BALANCE": "700"}, file); err != nil {
+			t.Fatalf("Load = %v", err)
+		}
+		cfg := config.Current
+		if cfg.Server.Addr != ":7000" || cfg.Server.ShutdownTimeout != config.Duration(45*time.Second) ||
+			cfg.RateLimit.Store != "memory" || cfg.Market.InitialBalance != 700 {
+			t.Errorf("Current = %+v", cfg)
+		}
+		if cfg.Market.InitialShares != 100 {
+			t.Errorf("initialShares = %d, want the default kept", cfg.Market.InitialShares)
+		}
+	})
+
+	t.Run("named file must exist", func(t *testing.T) {
+		err := load(t, map[string]string{"CONFIG_FILE": "missing.json"}, "")
+		if err == nil || !strings.Contains(err.Error(), "missing.json") {
+			t.Errorf("Load = %v, want the missing file reported", err)
+		}
+	})
+
+	t.Run("bad JSON", func(t *testing.T) {
+		err := load(t, nil, `{"server":{"shutdownTimeout":"forever"}}`)
+		if err == nil || !strings.Contains(err.Error(), "test.json") {
+			t.Errorf("Load = %v, want the file named", err)
+		}
+	})
+}
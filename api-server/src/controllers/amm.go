@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/replay"
+	"github.com/sahilrush/src/tickers"
+)
+
+// GetMarketMaker returns a market's maker with its quotes, holdings, subsidy and PnL
+func GetMarketMaker(c *gin.Context) {
+	symbol := c.Param("symbol")
+	if _, exists := models.Orderbooks[symbol]; !exists {
+		apierr.Respond(c, apierr.New(apierr.MarketNotFound, "Market does not exist").With(map[string]interface{}{
+			"symbol": symbol,
+		}))
+		return
+	}
+	maker, exists := amm.Makers[symbol]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.NotFound, "Market has no market maker"))
+		return
+	}
+
+	holdings := models.Stock_Balances[symbol][maker.Account]
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Market maker",
+		Data:    maker.Status(Users[maker.Account].Balance, holdings["yes"].Quantity, holdings["no"].Quantity),
+	})
+}
+
+// fromOperator tells whether body carries the platform operator's signature
+func fromOperator(c *gin.Context, body []byte) bool {
+	secret := config.Current.Market.OperatorSecret
+	return secret != "" && payments.Verify(secret, body, c.GetHeader(payments.OperatorHeader))
+}
+
+// platformSubsidy is what the platform has in the makers of markets not
+// resolved yet
+func platformSubsidy() int {
+	total := 0
+	for _, maker := range amm.Makers {
+		if maker.FundedBy == amm.FundedByPlatform && !maker.Settled {
+			total += maker.Subsidy
+		}
+	}
+	return total
+}
+
+// checkMakerSeed validates the market maker asked for with a new market
+// before anything is created. Only the operator can have the platform fund
+// it, and only within the subsidy budget.
+func checkMakerSeed(creator string, seed models.MakerSeed, operator bool) error {
+	if !config.Current.Features.MarketMakers {
+		return apierr.New(apierr.InvalidRequest, "Market makers are switched off")
+	}
+	if maxLiquidity := config.Current.Market.MaxMakerLiquidity; seed.Liquidity <= 0 || seed.Liquidity > maxLiquidity {
+		return apierr.New(apierr.InvalidRequest, "Market maker liquidity out of range").With(map[string]interface{}{
+			"liquidity": seed.Liquidity, "max": maxLiquidity,
+		})
+	}
+
+	switch seed.FundedBy {
+	case "", amm.FundedByCreator:
+		user, exists := Users[creator]
+		if !exists {
+			return apierr.New(apierr.UserNotFound, "User not found")
+		}
+		if funding := amm.Funding(seed.Liquidity); user.Balance < funding {
+			return insufficientBalance(funding, user.Balance)
+		}
+	case amm.FundedByPlatform:
+		if !operator {
+			return apierr.New(apierr.InvalidSignature, "Only the operator can fund a market maker from the platform")
+		}
+		budget, committed, funding := config.Current.Market.SubsidyBudget, platformSubsidy(), amm.Funding(seed.Liquidity)
+		if committed+funding > budget {
+			return apierr.New(apierr.SubsidyBudget, "Platform subsidy budget exceeded").With(map[string]interface{}{
+				"budget": budget, "committed": committed, "required": funding,
+			})
+		}
+	default:
+		return apierr.New(apierr.InvalidRequest, "fundedBy must be creator or platform")
+	}
+	return nil
+}
+
+// seedMaker gives a market a maker and moves its subsidy into the maker's account
+func seedMaker(symbol, creator string, seed models.MakerSeed) amm.Maker {
+	maker := amm.New(symbol, seed.Liquidity, amm.FundedByCreator, creator)
+	from := ledger.Available(creator)
+	if seed.FundedBy == amm.FundedByPlatform {
+		maker = amm.New(symbol, seed.Liquidity, amm.FundedByPlatform, "")
+		from = ledger.PlatformSubsidy
+	} else {
+		user := Users[creator]
+		user.Balance -= maker.Subsidy
+		Users[creator] = user
+	}
+
+	Users[maker.Account] = models.UserBalance{Balance: maker.Subsidy}
+	ledger.Transfer(ledger.KindSubsidy, symbol, from, ledger.Available(maker.Account), maker.Subsidy)
+	amm.Makers[symbol] = maker
+	return maker
+}
+
+// settleMaker hands what a resolved market's maker holds back to its funder.
+// Its winning shares must already be paid out.
+func settleMaker(symbol string) {
+	maker, exists := amm.Makers[symbol]
+	if !exists || maker.Settled {
+		return
+	}
+
+	returned := Users[maker.Account].Balance
+	to := ledger.PlatformSubsidy
+	if maker.FundedBy == amm.FundedByCreator {
+		to = ledger.Available(maker.Funder)
+		user := Users[maker.Funder]
+		user.Balance += returned
+		Users[maker.Funder] = user
+	}
+	ledger.Transfer(ledger.KindSubsidy, symbol, ledger.Available(maker.Account), to, returned)
+	delete(Users, maker.Account)
+
+	maker.Settled = true
+	maker.Returned = returned
+	amm.Makers[symbol] = maker
+}
+
+// match fills an order against the book and, when the market has a maker,
+// against the maker too. It walks the prices from the best one to the limit,
+// taking what rests on the book at each price before the maker's shares.
+func match(ctx context.Context, side, symbol, outcome, userId string, limit, quantity int) ([]models.Trade, int) {
+	if _, exists := amm.Makers[symbol]; !exists {
+		if side == "buy" {
+			return matchBuy(ctx, symbol, outcome, userId, limit, quantity)
+		}
+		return matchSell(ctx, symbol, outcome, userId, limit, quantity)
+	}
+
+	trades := []models.Trade{}
+	for step := 1; step < models.ContractPrice && quantity > 0; step++ {
+		var fromBook, fromMaker []models.Trade
+		if side == "buy" {
+			if step > limit {
+				break
+			}
+			fromBook, quantity = matchBuy(ctx, symbol, outcome, userId, step, quantity)
+			fromMaker, quantity = makerSells(symbol, outcome, userId, step, quantity)
+		} else {
+			price := models.ContractPrice - step
+			if price < limit {
+				break
+			}
+			fromBook, quantity = matchSell(ctx, symbol, outcome, userId, price, quantity)
+			fromMaker, quantity = makerBuys(symbol, outcome, userId, price, quantity)
+		}
+		trades = append(trades, fromBook...)
+		trades = append(trades, fromMaker...)
+	}
+	return trades, quantity
+}
+
+// makerSells fills a buy of outcome up to the limit price from the market
+// maker. The maker mints the pairs it needs shares for and keeps the other side.
+func makerSells(symbol, outcome, userId string, limit, quantity int) ([]models.Trade, int) {
+	maker := amm.Makers[symbol]
+	account := maker.Account
+	trades := []models.Trade{}
+
+	for _, fill := range maker.Buy(outcome, limit, quantity) {
+		cost := fill.Price * fill.Quantity
+		if Users[userId].Balance < cost {
+			break
+		}
+		short := fill.Quantity - getOutcome(symbol, account, outcome).Quantity
+		if short > 0 && Users[account].Balance+cost < short*models.ContractPrice {
+			break
+		}
+		trade := models.Trade{
+			ID:       replay.NewID(),
+			Symbol:   symbol,
+			Outcome:  outcome,
+			Price:    fill.Price,
+			Quantity: fill.Quantity,
+			Buyer:    userId,
+			Seller:   account,
+			Maker:    account,
+			Taker:    userId,
+		}
+
+		taker := Users[userId]
+		taker.Balance -= cost
+		Users[userId] = taker
+		mm := Users[account]
+		mm.Balance += cost
+		Users[account] = mm
+		ledger.Transfer(ledger.KindFill, trade.ID, ledger.Available(userId), ledger.Available(account), cost)
+
+		if short > 0 {
+			makerMint(symbol, account, short)
+		}
+		sold := getOutcome(symbol, account, outcome)
+		sold.Quantity -= fill.Quantity
+		setOutcome(symbol, account, outcome, sold)
+		makerMerge(symbol, account)
+
+		bought := getOutcome(symbol, userId, outcome)
+		bought.Quantity += fill.Quantity
+		setOutcome(symbol, userId, outcome, bought)
+		acquire(symbol, userId, outcome, fill.Quantity, fill.Price)
+
+		maker.Trade(outcome, fill.Quantity, cost)
+		quantity -= fill.Quantity
+		trades = append(trades, recordTrade(trade))
+	}
+
+	amm.Makers[symbol] = maker
+	return trades, quantity
+}
+
+// makerBuys fills a sell of outcome at or above the limit price from the
+// market maker, which redeems any pairs the shares it buys complete
+func makerBuys(symbol, outcome, userId string, limit, quantity int) ([]models.Trade, int) {
+	maker := amm.Makers[symbol]
+	account := maker.Account
+	trades := []models.Trade{}
+
+	for _, fill := range maker.Sell(outcome, limit, quantity) {
+		cost := fill.Price * fill.Quantity
+		if Users[account].Balance < cost {
+			break
+		}
+		trade := models.Trade{
+			ID:       replay.NewID(),
+			Symbol:   symbol,
+			Outcome:  outcome,
+			Price:    fill.Price,
+			Quantity: fill.Quantity,
+			Buyer:    account,
+			Seller:   userId,
+			Maker:    account,
+			Taker:    userId,
+		}
+
+		mm := Users[account]
+		mm.Balance -= cost
+		Users[account] = mm
+		seller := Users[userId]
+		seller.Balance += cost
+		Users[userId] = seller
+		ledger.Transfer(ledger.KindFill, trade.ID, ledger.Available(account), ledger.Available(userId), cost)
+
+		sold := getOutcome(symbol, userId, outcome)
+		sold.Quantity -= fill.Quantity
+		setOutcome(symbol, userId, outcome, sold)
+		dispose(symbol, userId, outcome, fill.Quantity, fill.Price)
+
+		bought := getOutcome(symbol, account, outcome)
+		bought.Quantity += fill.Quantity
+		setOutcome(symbol, account, outcome, bought)
+		makerMerge(symbol, account)
+
+		maker.Trade(outcome, -fill.Quantity, cost)
+		quantity -= fill.Quantity
+		trades = append(trades, recordTrade(trade))
+	}
+
+	amm.Makers[symbol] = maker
+	return trades, quantity
+}
+
+// makerMint has the maker pay the contract price into escrow for each new YES/NO pair
+func makerMint(symbol, account string, pairs int) {
+	mm := Users[account]
+	mm.Balance -= pairs * models.ContractPrice
+	Users[account] = mm
+	ledger.Transfer(ledger.KindMint, symbol, ledger.Available(account), ledger.Escrow(symbol), pairs*models.ContractPrice)
+
+	for _, outcome := range []string{"yes", "no"} {
+		held := getOutcome(symbol, account, outcome)
+		held.Quantity += pairs
+		setOutcome(symbol, account, outcome, held)
+	}
+	tickers.Mint(symbol, pairs)
+}
+
+// makerMerge redeems the YES/NO pairs the maker holds both sides of for the
+// contract price each, so it never holds both outcomes
+func makerMerge(symbol, account string) {
+	yes, no := getOutcome(symbol, account, "yes"), getOutcome(symbol, account, "no")
+	pairs := min(yes.Quantity, no.Quantity)
+	if pairs <= 0 {
+		return
+	}
+	yes.Quantity -= pairs
+	no.Quantity -= pairs
+	setOutcome(symbol, account, "yes", yes)
+	setOutcome(symbol, account, "no", no)
+
+	mm := Users[account]
+	mm.Balance += pairs * models.ContractPrice
+	Users[account] = mm
+	ledger.Transfer(ledger.KindMerge, symbol, ledger.Escrow(symbol), ledger.Available(account), pairs*models.ContractPrice)
+	tickers.Mint(symbol, -pairs)
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+func TestChargeFeeExemptsMakers(t *testing.T) {
+	tests := []struct {
+		name   string
+		userId string
+		free   bool
+	}{
+		{"trader", "fee-trader", false},
+		{"market maker", amm.Account("FEES"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fund(tt.userId, 1000)
+			revenue := models.PlatformRevenue.Total
+
+			fee := fillFee("FEES", tt.userId, fees.Taker, 0, 500)
+			if (fee == 0) != tt.free {
+				t.Fatalf("fee = %d, want free %v", fee, tt.free)
+			}
+			if charged := chargeFee("FEES", tt.userId, fees.Taker, fee); charged != fee {
+				t.Fatalf("charged %d of a fee of %d", charged, fee)
+			}
+			if Users[tt.userId].Balance != 1000-fee || models.PlatformRevenue.Total != revenue+fee {
+				t.Errorf("balance %d, revenue %d after a fee of %d", Users[tt.userId].Balance, models.PlatformRevenue.Total, fee)
+			}
+			verifyLedger(t)
+		})
+	}
+}
+
+// TestPlatformFunding seeds platform funded makers: only with the operator's
+// signature, and only while what the platform has in unresolved markets stays
+// within the budget. A maker with b = 10 costs 70.
+func TestPlatformFunding(t *testing.T) {
+	const secret = "amm-operator-secret"
+	saved := config.Current.Market
+	t.Cleanup(func() { config.Current.Market = saved })
+	config.Current.Market.OperatorSecret = secret
+	config.Current.Market.SubsidyBudget = platformSubsidy() + 150
+	fund("platform-creator", 100)
+
+	create := func(symbol, signWith string) reply {
+		body, _ := json.Marshal(models.CreateSymbol{UserId: "platform-creator", Stock: symbol,
+			Amm: &models.MakerSeed{Liquidity: 10, FundedBy: amm.FundedByPlatform}})
+		header := http.Header{}
+		if signWith != "" {
+			header.Set(payments.OperatorHeader, payments.Sign(signWith, body))
+		}
+		return call(t, CreateSymbol, body, header)
+	}
+	steps := []struct {
+		name     string
+		symbol   string
+		signWith string
+		code     apierr.Code
+	}{
+		{"unsigned", "PLATFORM1", "", apierr.InvalidSignature},
+		{"signed with another key", "PLATFORM1", "not-the-operator-secret", apierr.InvalidSignature},
+		{"operator", "PLATFORM1", secret, ""},
+		{"operator again", "PLATFORM2", secret, ""},
+		{"over the budget", "PLATFORM3", secret, apierr.SubsidyBudget},
+	}
+	for _, step := range steps {
+		if r := create(step.symbol, step.signWith); r.code() != step.code {
+			t.Fatalf("%s: code = %q, want %q", step.name, r.code(), step.code)
+		}
+	}
+	if _, exists := models.Orderbooks["PLATFORM3"]; exists {
+		t.Error("market over the budget was created")
+	}
+
+	// Resolving a market hands its maker's money back and frees the budget
+	if r := call(t, ResolveSymbol, models.ResolveSymbol{Stock: "PLATFORM1", Outcome: "yes"}, nil); !r.Success {
+		t.Fatalf("resolve: %+v", r.Error)
+	}
+	if r := create("PLATFORM3", secret); !r.Success {
+		t.Errorf("after resolving: %+v", r.Error)
+	}
+	verifyLedger(t)
+
+	// Without a secret configured nobody is the operator, not even a body
+	// signed with the empty key
+	config.Current.Market.OperatorSecret = ""
+	body, _ := json.Marshal(models.CreateSymbol{UserId: "platform-creator", Stock: "PLATFORM4",
+		Amm: &models.MakerSeed{Liquidity: 10, FundedBy: amm.FundedByPlatform}})
+	header := http.Header{payments.OperatorHeader: {payments.Sign("", body)}}
+	if r := call(t, CreateSymbol, body, header); r.code() != apierr.InvalidSignature {
+		t.Errorf("no operator secret: code = %q", r.code())
+	}
+}
+
+// TestMarketMakerMoneyMovement trades against a creator funded maker through
+// to resolution, checking where every INR goes on the way. The maker quotes
+// with b = 10, so its subsidy is 70.
+func TestMarketMakerMoneyMovement(t *testing.T) {
+	const symbol, creator, trader = "AMMFLOW", "amm-creator", "amm-trader"
+	account := amm.Account(symbol)
+	fund(creator, 1000)
+	fund(trader, 1000)
+
+	r := call(t, CreateSymbol, models.CreateSymbol{UserId: creator, Stock: symbol, Amm: &models.MakerSeed{Liquidity: 10}}, nil)
+	if !r.Success {
+		t.Fatalf("create market: %+v", r.Error)
+	}
+	if Users[creator].Balance != 930 || Users[account].Balance != 70 {
+		t.Fatalf("creator has %d and the maker %d, want the subsidy of 70 moved", Users[creator].Balance, Users[account].Balance)
+	}
+
+	holds := func(outcome string) int { return models.Stock_Balances[symbol][account][outcome].Quantity }
+	steps := []struct {
+		name   string
+		order  models.OrderRequest
+		filled int
+		// paid is what the trader pays (or, selling, gets) before fees
+		paid     int
+		cash     int
+		yes, no  int
+		netYes   int
+		notional int
+	}{
+		// Sells 6x4 and 7x1, minting the 5 pairs it has no YES for and
+		// keeping their NO: 70 + 31 - 50
+		{"trader buys", models.OrderRequest{UserId: trader, Symbol: symbol, Side: "buy", Outcome: "yes", Price: 7, Quantity: 5},
+			5, 31, 51, 0, 5, 5, 31},
+		// Buys back 6x1 and 5x1, then redeems the 2 pairs they complete:
+		// 51 - 11 + 20
+		{"trader sells", models.OrderRequest{UserId: trader, Symbol: symbol, Side: "sell", Outcome: "yes", Price: 5, Quantity: 2},
+			2, -11, 60, 0, 3, 3, 42},
+		// Asks more than the maker bids, so it rests on the book instead
+		{"trader asks above the maker's bid", models.OrderRequest{UserId: trader, Symbol: symbol, Side: "sell", Outcome: "yes", Price: 6, Quantity: 1},
+			0, 0, 60, 0, 3, 3, 42},
+	}
+	for _, step := range steps {
+		before := Users[trader].Balance
+		feesBefore := models.FeesPaid[symbol][trader]
+
+		r := call(t, PlaceOrder, step.order, nil)
+		if !r.Success {
+			t.Fatalf("%s: %+v", step.name, r.Error)
+		}
+		var order models.Order
+		json.Unmarshal(r.Data, &order)
+		if order.Filled != step.filled {
+			t.Errorf("%s: filled %d, want %d", step.name, order.Filled, step.filled)
+		}
+
+		fee := models.FeesPaid[symbol][trader] - feesBefore
+		locked := 0
+		if step.order.Side == "buy" {
+			locked = order.Remaining * step.order.Price
+		}
+		if paid := before - Users[trader].Balance - fee - locked; paid != step.paid {
+			t.Errorf("%s: trader paid %d, want %d", step.name, paid, step.paid)
+		}
+		if step.filled > 0 && fee == 0 {
+			t.Errorf("%s: trader paid no taker fee", step.name)
+		}
+		if Users[account].Balance != step.cash || holds("yes") != step.yes || holds("no") != step.no {
+			t.Errorf("%s: maker holds %d INR, %d YES, %d NO, want %d, %d, %d",
+				step.name, Users[account].Balance, holds("yes"), holds("no"), step.cash, step.yes, step.no)
+		}
+		if maker := amm.Makers[symbol]; maker.NetYes != step.netYes || maker.Notional != step.notional {
+			t.Errorf("%s: maker = %+v", step.name, maker)
+		}
+		if paidFees := models.FeesPaid[symbol][account]; paidFees != 0 {
+			t.Errorf("%s: maker paid %d in fees", step.name, paidFees)
+		}
+		verifyLedger(t)
+	}
+
+	// NO wins: the maker's 3 NO pay 30 without a settlement fee, then the
+	// maker hands its 90 back to the creator and its account is closed
+	creatorBefore := Users[creator].Balance
+	r = call(t, ResolveSymbol, models.ResolveSymbol{Stock: symbol, Outcome: "no"}, nil)
+	if !r.Success {
+		t.Fatalf("resolve: %+v", r.Error)
+	}
+	var resolution models.Resolution
+	json.Unmarshal(r.Data, &resolution)
+
+	if resolution.Payouts[account] != 30 {
+		t.Errorf("maker payout = %d, want 30", resolution.Payouts[account])
+	}
+	if got, want := Users[creator].Balance, creatorBefore+resolution.Payouts[creator]+90; got != want {
+		t.Errorf("creator balance = %d, want %d with the maker's 90 back", got, want)
+	}
+	if maker := amm.Makers[symbol]; !maker.Settled || maker.Returned != 90 {
+		t.Errorf("maker = %+v, want settled with 90 returned", maker)
+	}
+	if _, open := Users[account]; open {
+		t.Error("maker account still has a balance")
+	}
+	verifyLedger(t)
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/models"
+)
+
+const maxCandles = 1000
+
+// GetCandles returns the OHLCV candles of a market outcome, YES unless
+// ?outcome=no. ?interval= is 1m, 5m, 1h or 1d (1m by default); ?from= and
+// ?to= take RFC 3339 times or Unix seconds and bound the candle start times.
+func GetCandles(c *gin.Context) {
+	symbol := c.Param("symbol")
+	if _, exists := models.Orderbooks[symbol]; !exists {
+		apierr.Respond(c, apierr.New(apierr.MarketNotFound, "Market does not exist").With(map[string]interface{}{
+			"symbol": symbol,
+		}))
+		return
+	}
+
+	outcome := c.DefaultQuery("outcome", "yes")
+	if outcome != "yes" && outcome != "no" {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "outcome must be yes or no"))
+		return
+	}
+
+	interval, ok := candles.ParseInterval(c.DefaultQuery("interval", "1m"))
+	if !ok {
+		names := []string{}
+		for _, interval := range candles.Intervals {
+			names = append(names, interval.Name)
+		}
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Unknown interval").With(map[string]interface{}{
+			"intervals": names,
+		}))
+		return
+	}
+
+	from, err := parseTime(c.Query("from"))
+	if err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "from must be an RFC 3339 time or Unix seconds"))
+		return
+	}
+	to, err := parseTime(c.Query("to"))
+	if err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "to must be an RFC 3339 time or Unix seconds"))
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "from must be before to"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Candles",
+		Data: candles.Series{
+			Symbol:   symbol,
+			Outcome:  outcome,
+			Interval: interval.Name,
+			Candles:  candles.Query(symbol, outcome, interval, from, to, maxCandles),
+		},
+	})
+}
+
+// parseTime reads an RFC 3339 time or Unix seconds, empty is the zero time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+func TestMain(m *testing.M) {
+	cfg := config.Defaults()
+	cfg.Payments.WebhookSecret = "controllers-webhook-secret"
+	cfg.Payments.PayoutSecret = "controllers-payout-secret"
+	config.Current = cfg
+	payments.Payouts = &payments.FakeProcessor{Mode: models.WithdrawalCompleted}
+	logging.Setup(io.Discard, "error", "text")
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// reply is the envelope a handler answered with
+type reply struct {
+	status  int
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Error   *apierr.Error   `json:"error"`
+}
+
+// code is the error code of the reply, empty when it succeeded
+func (r reply) code() apierr.Code {
+	if r.Error == nil {
+		return ""
+	}
+	return r.Error.Code
+}
+
+// call runs a handler on a request carrying body and headers
+func call(t *testing.T, handler gin.HandlerFunc, body interface{}, header http.Header, params ...gin.Param) reply {
+	t.Helper()
+	raw, ok := body.([]byte)
+	if !ok {
+		raw, _ = json.Marshal(body)
+	}
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	c.Request.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		c.Request.Header[key] = values
+	}
+	c.Params = params
+	handler(c)
+
+	var r reply
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+		t.Fatalf("decoding reply %q: %v", rec.Body.String(), err)
+	}
+	r.status = rec.Code
+	return r
+}
+
+// fund gives a user INR the way a deposit would, journal included
+func fund(userId string, amount int) {
+	user := Users[userId]
+	user.Balance += amount
+	Users[userId] = user
+	ledger.Transfer(ledger.KindOnramp, userId, ledger.External, ledger.Available(userId), amount)
+}
+
+// verifyLedger fails the test when a stored balance disagrees with the journal
+func verifyLedger(t *testing.T) {
+	t.Helper()
+	if mismatches := ledger.Verify(); len(mismatches) > 0 {
+		t.Fatalf("ledger mismatches: %+v", mismatches)
+	}
+}
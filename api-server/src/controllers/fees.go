@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/models"
+)
+
+// GetFees reports the platform revenue account with a breakdown per market
+func GetFees(c *gin.Context) {
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Fees collected",
+		Data: map[string]interface{}{
+			"platform": models.PlatformRevenue,
+			"markets":  models.MarketRevenue,
+			"schedule": map[string]interface{}{
+				"default": fees.DefaultSchedule,
+				"markets": fees.MarketSchedules,
+				"tiers":   fees.TierSchedules,
+			},
+		},
+	})
+}
+
+// SetFeeSchedule sets the schedule of a market, of a tier, or the default one
+func SetFeeSchedule(c *gin.Context) {
+	var payload models.FeeScheduleUpdate
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid payload"))
+		return
+	}
+
+	if err := payload.Schedule.Validate(); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, err.Error()))
+		return
+	}
+
+	switch {
+	case payload.Market != "" && payload.Tier != "":
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Set either a market or a tier schedule, not both"))
+		return
+	case payload.Market != "":
+		fees.MarketSchedules[payload.Market] = payload.Schedule
+	case payload.Tier != "":
+		fees.TierSchedules[payload.Tier] = payload.Schedule
+	default:
+		fees.DefaultSchedule = payload.Schedule
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Fee schedule updated",
+		Data:    payload.Schedule,
+	})
+}
+
+// SetUserTier places a user in a fee tier
+func SetUserTier(c *gin.Context) {
+	var payload models.UserTier
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid payload"))
+		return
+	}
+
+	if err := checkUserId(payload.UserId); err != nil {
+		apierr.Respond(c, err)
+		return
+	}
+	fees.UserTiers[payload.UserId] = payload.Tier
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "User tier updated",
+		Data:    payload,
+	})
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/models"
+)
+
+// TestMakerFeeLocked rests buys that lock all the maker has, then fills them
+// in pieces. The maker fee comes out of the INR locked with the order and
+// rounds over the whole order, 1% of 500 being 5 however it fills.
+func TestMakerFeeLocked(t *testing.T) {
+	const symbol, maker, taker = "MAKERFEE", "fee-maker", "fee-taker"
+	onePercent := fees.Rate{Basis: fees.Notional, Amount: 100}
+	fees.MarketSchedules[symbol] = fees.Schedule{Maker: onePercent, Taker: onePercent, Settlement: onePercent}
+	defer delete(fees.MarketSchedules, symbol)
+	fund(maker, 505)
+	fund(taker, 10000)
+	if r := call(t, CreateSymbol, models.CreateSymbol{UserId: maker, Stock: symbol}, nil); !r.Success {
+		t.Fatalf("create market: %+v", r.Error)
+	}
+
+	place := func(order models.OrderRequest) models.Order {
+		t.Helper()
+		r := call(t, PlaceOrder, order, nil)
+		if !r.Success {
+			t.Fatalf("place %+v: %+v", order, r.Error)
+		}
+		var placed models.Order
+		json.Unmarshal(r.Data, &placed)
+		return placed
+	}
+	// fill has the taker buy NO against the maker's resting YES bid
+	fill := func(price, quantity int) models.Trade {
+		t.Helper()
+		order := place(models.OrderRequest{UserId: taker, Symbol: symbol, Side: "buy", Outcome: "no", Price: price, Quantity: quantity})
+		if len(order.Fills) != 1 {
+			t.Fatalf("taker got %d fills, want 1", len(order.Fills))
+		}
+		return order.Fills[0]
+	}
+
+	bid := place(models.OrderRequest{UserId: maker, Symbol: symbol, Side: "buy", Outcome: "yes", Price: 5, Quantity: 100})
+	if user := Users[maker]; bid.Remaining != 100 || user.Balance != 0 || user.Locked != 505 {
+		t.Fatalf("resting bid %+v left the maker with %+v, want 500 and its fee of 5 locked", bid, user)
+	}
+	steps := []struct {
+		quantity int
+		fee      int
+		locked   int
+	}{
+		{30, 1, 354},
+		{30, 2, 202},
+		{40, 2, 0},
+	}
+	paid := 0
+	for i, step := range steps {
+		trade := fill(5, step.quantity)
+		paid += trade.MakerFee
+		if trade.MakerFee != step.fee || Users[maker].Locked != step.locked || Users[maker].Balance != 0 {
+			t.Errorf("fill %d: maker fee %d, maker %+v, want a fee of %d and %d locked", i+1, trade.MakerFee, Users[maker], step.fee, step.locked)
+		}
+		verifyLedger(t)
+	}
+	if paid != 5 || models.FeesPaid[symbol][maker] != 5 {
+		t.Errorf("maker paid %d in fees, %d recorded, want 5", paid, models.FeesPaid[symbol][maker])
+	}
+
+	// Cancelling hands back what is left of the fee with the rest of the bid:
+	// a fill of 30 at 4 pays 1, the 2 locked for 50 less the 1 the last 20 owe
+	fund(maker, 202)
+	bid = place(models.OrderRequest{UserId: maker, Symbol: symbol, Side: "buy", Outcome: "yes", Price: 4, Quantity: 50})
+	if trade := fill(6, 30); trade.MakerFee != 1 {
+		t.Errorf("partial fill: maker fee %d, want 1", trade.MakerFee)
+	}
+	if released := releaseOrder(models.PlacedOrders[bid.ID]); released != 20 {
+		t.Fatalf("released %d, want 20", released)
+	}
+	if user := Users[maker]; user.Balance != 81 || user.Locked != 0 {
+		t.Errorf("after cancelling the maker has %+v, want 80 and the fee of 1 back", user)
+	}
+	verifyLedger(t)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/models"
+)
+
+// GetInvariantReport returns the latest invariant report and recent failures,
+// ?run=true checks the state again before answering
+func GetInvariantReport(c *gin.Context) {
+	if c.Query("run") == "true" {
+		engine.RunChecks("report")
+	}
+
+	latest, failures := engine.Reports()
+	status := http.StatusOK
+	if !latest.OK() {
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, models.UserResponse{
+		Success: latest.OK(),
+		Message: "Invariant report",
+		Data: map[string]interface{}{
+			"latest":   latest,
+			"failures": failures,
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+)
+
+// GetJournal returns the journal, ?account= narrows it to the entries touching one account
+func GetJournal(c *gin.Context) {
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Journal entries",
+		Data:    ledger.Entries(c.Query("account")),
+	})
+}
+
+// GetLedgerAccounts returns every account balance derived from the journal
+func GetLedgerAccounts(c *gin.Context) {
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Ledger accounts",
+		Data:    ledger.Balances(),
+	})
+}
+
+// VerifyLedger checks the stored balances against the journal
+func VerifyLedger(c *gin.Context) {
+	mismatches := ledger.Verify()
+	if len(mismatches) > 0 {
+		apierr.Respond(c, apierr.New(apierr.LedgerMismatch, "Balances do not match the journal").With(mismatches))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Balances match the journal",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,403 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/replay"
+	"github.com/sahilrush/src/tickers"
+	"github.com/sahilrush/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// opposite returns the other outcome of a market
+func opposite(outcome string) string {
+	if outcome == "yes" {
+		return "no"
+	}
+	return "yes"
+}
+
+// bookSide returns the price levels resting on the given outcome of a symbol
+func bookSide(symbol, outcome string) map[int]models.OrderType {
+	pricing, ok := models.Orderbooks[symbol]
+	if !ok {
+		pricing = models.Pricing{
+			Yes: make(map[int]models.OrderType),
+			No:  make(map[int]models.OrderType),
+		}
+		models.Orderbooks[symbol] = pricing
+	}
+	if outcome == "yes" {
+		return pricing.Yes
+	}
+	return pricing.No
+}
+
+// sortedLevels returns the prices of a book side in ascending order
+func sortedLevels(side map[int]models.OrderType) []int {
+	prices := getKeys(side)
+	sort.Ints(prices)
+	return prices
+}
+
+// getOutcome reads a user's holding, creating the maps on the way if needed
+func getOutcome(symbol, userId, outcome string) models.OutCome {
+	if _, ok := models.Stock_Balances[symbol]; !ok {
+		models.Stock_Balances[symbol] = models.User{}
+	}
+	if _, ok := models.Stock_Balances[symbol][userId]; !ok {
+		models.Stock_Balances[symbol][userId] = models.Stocksymbol{}
+	}
+	return models.Stock_Balances[symbol][userId][outcome]
+}
+
+func setOutcome(symbol, userId, outcome string, value models.OutCome) {
+	getOutcome(symbol, userId, outcome)
+	models.Stock_Balances[symbol][userId][outcome] = value
+}
+
+// feeExempt reports whether a user pays no fees: nobody does with fees
+// switched off, and market makers never do
+func feeExempt(userId string) bool {
+	return !config.Current.Features.Fees || amm.IsAccount(userId)
+}
+
+// fillFee is what a user owes in a role on a fill of notional by an order that
+// already filled before, see fees.Fill
+func fillFee(symbol, userId string, kind fees.Kind, before, notional int) int {
+	if feeExempt(userId) {
+		return 0
+	}
+	return fees.Fill(symbol, userId, kind, before, notional)
+}
+
+// makerFee is what a resting order owes on a fill of qty at its price that
+// leaves left of it resting. It rounds from the unfilled end of the order, so
+// the fee locked for the rest is always what the rest will owe.
+func makerFee(symbol, userId string, price, qty, left int) int {
+	return fillFee(symbol, userId, fees.Maker, price*left, price*qty)
+}
+
+// takerFilled is the notional the order being placed has filled so far, its
+// taker fee rounds over all of its fills. placeOrder resets it, the engine
+// lock keeps one order matching at a time.
+var takerFilled int
+
+// chargeFee takes a fee from the user's available balance and credits the
+// platform. A taker's buy was checked for its fee and a seller pays out of the
+// proceeds, which cover any rate in basis points; only a flat fee above them
+// is cut to what the seller has.
+func chargeFee(symbol, userId string, kind fees.Kind, fee int) int {
+	user := Users[userId]
+	fee = min(fee, user.Balance)
+	if fee <= 0 {
+		return 0
+	}
+	user.Balance -= fee
+	Users[userId] = user
+	ledger.Transfer(ledger.KindFee, symbol, ledger.Available(userId), ledger.PlatformFees, fee)
+	creditFee(symbol, userId, kind, fee)
+	return fee
+}
+
+// chargeLockedFee takes the maker fee of a fill against a resting buy from
+// the fee locked with it. The order never pays more than it locked, even if
+// the schedule went up while it rested; what is left once it is filled is
+// unlocked.
+func chargeLockedFee(symbol string, order *models.Orders, fee int) int {
+	fee = min(fee, order.FeeLocked)
+	order.FeeLocked -= fee
+	if order.Quantity == 0 {
+		unlockFee(symbol, order)
+	}
+	if fee <= 0 {
+		return 0
+	}
+	user := Users[order.UserId]
+	user.Locked -= fee
+	Users[order.UserId] = user
+	ledger.Transfer(ledger.KindFee, symbol, ledger.Locked(order.UserId), ledger.PlatformFees, fee)
+	creditFee(symbol, order.UserId, fees.Maker, fee)
+	return fee
+}
+
+// unlockFee hands the fee still locked with a resting buy back
+func unlockFee(symbol string, order *models.Orders) {
+	if order.FeeLocked <= 0 {
+		return
+	}
+	user := Users[order.UserId]
+	user.Locked -= order.FeeLocked
+	user.Balance += order.FeeLocked
+	Users[order.UserId] = user
+	ledger.Transfer(ledger.KindUnlock, symbol, ledger.Locked(order.UserId), ledger.Available(order.UserId), order.FeeLocked)
+	order.FeeLocked = 0
+}
+
+// creditFee books a fee paid to the platform revenue account
+func creditFee(symbol, userId string, kind fees.Kind, fee int) {
+	payFee(symbol, userId, fee)
+
+	market := models.MarketRevenue[symbol]
+	switch kind {
+	case fees.Maker:
+		market.Maker += fee
+		models.PlatformRevenue.Maker += fee
+	case fees.Taker:
+		market.Taker += fee
+		models.PlatformRevenue.Taker += fee
+	case fees.Settlement:
+		market.Settlement += fee
+		models.PlatformRevenue.Settlement += fee
+	}
+	market.Total += fee
+	models.PlatformRevenue.Total += fee
+	models.MarketRevenue[symbol] = market
+}
+
+// recordTrade charges the taker their fee and appends the fill to the trade
+// log. The caller has charged the maker.
+func recordTrade(trade models.Trade) models.Trade {
+	notional := trade.Price * trade.Quantity
+	trade.Timestamp = replay.Now()
+	trade.TakerFee = chargeFee(trade.Symbol, trade.Taker, fees.Taker, fillFee(trade.Symbol, trade.Taker, fees.Taker, takerFilled, notional))
+	takerFilled += notional
+
+	if _, ok := models.LastTradedPrice[trade.Symbol]; !ok {
+		models.LastTradedPrice[trade.Symbol] = map[string]int{}
+	}
+	models.LastTradedPrice[trade.Symbol][trade.Outcome] = trade.Price
+	models.LastTradedPrice[trade.Symbol][opposite(trade.Outcome)] = models.ContractPrice - trade.Price
+
+	models.Trades = append(models.Trades, trade)
+	candles.Add(trade)
+	tickers.Trade(trade)
+	ordersFilled.With(trade.Symbol).Inc()
+	tradeVolume.With(trade.Symbol).Add(float64(trade.Quantity))
+	tradeNotional.With(trade.Symbol).Add(float64(notional))
+	return trade
+}
+
+// startMatch opens the span of one matching pass
+func startMatch(ctx context.Context, name, symbol, outcome string, limit, quantity int) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, trace.WithAttributes(
+		attribute.String(logging.Symbol, symbol),
+		attribute.String("outcome", outcome),
+		attribute.Int("limit", limit),
+		attribute.Int("quantity", quantity),
+	))
+}
+
+// endMatch records every fill as an event and closes the span
+func endMatch(span trace.Span, trades []models.Trade, remaining int) {
+	for _, trade := range trades {
+		span.AddEvent("fill", trace.WithAttributes(
+			attribute.String(logging.TradeID, trade.ID),
+			attribute.Int("price", trade.Price),
+			attribute.Int("quantity", trade.Quantity),
+		))
+	}
+	span.SetAttributes(attribute.Int("fills", len(trades)), attribute.Int("remaining", remaining))
+	span.End()
+}
+
+// matchBuy fills a buy of outcome up to the limit price against resting orders on
+// the same side of the book. Plain sell orders transfer shares, inverse orders
+// (buyers of the opposite outcome) mint a new YES/NO pair. The taker pays from
+// their available balance; it returns the fills and the unfilled quantity.
+func matchBuy(ctx context.Context, symbol, outcome, userId string, limit, quantity int) ([]models.Trade, int) {
+	_, span := startMatch(ctx, "match buy", symbol, outcome, limit, quantity)
+	trades := []models.Trade{}
+	defer func() { endMatch(span, trades, quantity) }()
+	side := bookSide(symbol, outcome)
+
+	for _, price := range sortedLevels(side) {
+		if price > limit || quantity == 0 {
+			break
+		}
+		level := side[price]
+		resting := level.Orders[:0]
+
+		for _, order := range level.Orders {
+			owner := order.UserId
+			if quantity == 0 || owner == userId {
+				resting = append(resting, order)
+				continue
+			}
+			// The balance was checked for the whole order, this only keeps
+			// the taker from going negative
+			qty := min(quantity, order.Quantity, Users[userId].Balance/price)
+			if qty == 0 {
+				resting = append(resting, order)
+				continue
+			}
+
+			taker := Users[userId]
+			taker.Balance -= price * qty
+			Users[userId] = taker
+
+			bought := getOutcome(symbol, userId, outcome)
+			bought.Quantity += qty
+			setOutcome(symbol, userId, outcome, bought)
+			acquire(symbol, userId, outcome, qty, price)
+
+			trade := models.Trade{
+				ID:           replay.NewID(),
+				Symbol:       symbol,
+				Outcome:      outcome,
+				Price:        price,
+				Quantity:     qty,
+				Buyer:        userId,
+				Seller:       owner,
+				Maker:        owner,
+				Taker:        userId,
+				MakerOrderId: order.OrderId,
+			}
+
+			if order.Type == "sell" {
+				sold := getOutcome(symbol, owner, outcome)
+				sold.Locked -= qty
+				setOutcome(symbol, owner, outcome, sold)
+				dispose(symbol, owner, outcome, qty, price)
+
+				maker := Users[owner]
+				maker.Balance += price * qty
+				Users[owner] = maker
+
+				ledger.Transfer(ledger.KindFill, trade.ID, ledger.Available(userId), ledger.Available(owner), price*qty)
+			} else {
+				// The resting order is a buyer of the other outcome who locked their side
+				maker := Users[owner]
+				maker.Locked -= (models.ContractPrice - price) * qty
+				Users[owner] = maker
+
+				minted := getOutcome(symbol, owner, opposite(outcome))
+				minted.Quantity += qty
+				setOutcome(symbol, owner, opposite(outcome), minted)
+				acquire(symbol, owner, opposite(outcome), qty, models.ContractPrice-price)
+
+				// Both payments back the new YES/NO pair until the market settles
+				ledger.Record(ledger.KindFill, trade.ID,
+					ledger.Posting{Account: ledger.Available(userId), Amount: -price * qty},
+					ledger.Posting{Account: ledger.Locked(owner), Amount: -(models.ContractPrice - price) * qty},
+					ledger.Posting{Account: ledger.Escrow(symbol), Amount: models.ContractPrice * qty},
+				)
+				tickers.Mint(symbol, qty)
+			}
+
+			// The maker pays on its own price: a seller out of the proceeds, a
+			// buyer from the fee it locked
+			order.Quantity -= qty
+			if order.Type == "sell" {
+				trade.MakerFee = chargeFee(symbol, owner, fees.Maker, makerFee(symbol, owner, price, qty, order.Quantity))
+			} else {
+				fee := makerFee(symbol, owner, models.ContractPrice-price, qty, order.Quantity)
+				trade.MakerFee = chargeLockedFee(symbol, &order, fee)
+			}
+			level.Total -= qty
+			quantity -= qty
+			if order.Quantity > 0 {
+				resting = append(resting, order)
+			}
+
+			trades = append(trades, recordTrade(trade))
+		}
+		level.Orders = resting
+
+		if len(level.Orders) == 0 {
+			delete(side, price)
+		} else {
+			side[price] = level
+		}
+	}
+
+	return trades, quantity
+}
+
+// matchSell fills a sell of outcome at or above the limit price against buyers of
+// that outcome, which rest as inverse orders on the opposite side of the book.
+// The shares are taken from the seller's available quantity.
+func matchSell(ctx context.Context, symbol, outcome, userId string, limit, quantity int) ([]models.Trade, int) {
+	_, span := startMatch(ctx, "match sell", symbol, outcome, limit, quantity)
+	trades := []models.Trade{}
+	defer func() { endMatch(span, trades, quantity) }()
+	side := bookSide(symbol, opposite(outcome))
+
+	for _, level := range sortedLevels(side) {
+		price := models.ContractPrice - level
+		if price < limit || quantity == 0 {
+			break
+		}
+		orders := side[level]
+		resting := orders.Orders[:0]
+
+		for _, order := range orders.Orders {
+			owner := order.UserId
+			if quantity == 0 || owner == userId || order.Type == "sell" {
+				resting = append(resting, order)
+				continue
+			}
+			qty := min(quantity, order.Quantity)
+			tradeId := replay.NewID()
+
+			buyer := Users[owner]
+			buyer.Locked -= price * qty
+			Users[owner] = buyer
+
+			seller := Users[userId]
+			seller.Balance += price * qty
+			Users[userId] = seller
+			ledger.Transfer(ledger.KindFill, tradeId, ledger.Locked(owner), ledger.Available(userId), price*qty)
+
+			sold := getOutcome(symbol, userId, outcome)
+			sold.Quantity -= qty
+			setOutcome(symbol, userId, outcome, sold)
+			dispose(symbol, userId, outcome, qty, price)
+
+			bought := getOutcome(symbol, owner, outcome)
+			bought.Quantity += qty
+			setOutcome(symbol, owner, outcome, bought)
+			acquire(symbol, owner, outcome, qty, price)
+
+			order.Quantity -= qty
+			orders.Total -= qty
+			quantity -= qty
+			fee := chargeLockedFee(symbol, &order, makerFee(symbol, owner, price, qty, order.Quantity))
+			if order.Quantity > 0 {
+				resting = append(resting, order)
+			}
+
+			trades = append(trades, recordTrade(models.Trade{
+				ID:           tradeId,
+				Symbol:       symbol,
+				Outcome:      outcome,
+				Price:        price,
+				Quantity:     qty,
+				Buyer:        owner,
+				Seller:       userId,
+				Maker:        owner,
+				Taker:        userId,
+				MakerOrderId: order.OrderId,
+				MakerFee:     fee,
+			}))
+		}
+		orders.Orders = resting
+
+		if len(orders.Orders) == 0 {
+			delete(side, level)
+		} else {
+			side[level] = orders
+		}
+	}
+
+	return trades, quantity
+}
@@ -0,0 +1,16 @@
+package controllers
+
+import "github.com/sahilrush/src/metrics"
+
+var (
+	ordersPlaced = metrics.NewCounterVec("opnify_orders_placed_total",
+		"Orders accepted by the engine after the pre-trade checks.", "market", "side", "outcome")
+	ordersCancelled = metrics.NewCounterVec("opnify_orders_cancelled_total",
+		"Resting orders cancelled, e.g. when a market resolves.", "market")
+	ordersFilled = metrics.NewCounterVec("opnify_orders_filled_total",
+		"Fills, one per resting order matched against.", "market")
+	tradeVolume = metrics.NewCounterVec("opnify_trade_volume_contracts_total",
+		"Contracts traded.", "market")
+	tradeNotional = metrics.NewCounterVec("opnify_trade_notional_inr_total",
+		"INR paid for traded contracts.", "market")
+)
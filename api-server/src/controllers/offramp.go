@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/replay"
+)
+
+// OfframpUser moves money from the available balance into the pending withdrawal
+// bucket and hands it to the payout processor
+func OfframpUser(c *gin.Context) {
+	var payload models.OfframpUser
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request data"))
+		return
+	}
+
+	if payload.Amount <= 0 {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Amount must be greater than zero"))
+		return
+	}
+
+	user, err := lookupUser(payload.UserId)
+	if err != nil {
+		apierr.Respond(c, err)
+		return
+	}
+
+	if user.Balance < payload.Amount {
+		apierr.Respond(c, insufficientBalance(payload.Amount, user.Balance))
+		return
+	}
+
+	user.Balance -= payload.Amount
+	user.PendingWithdrawal += payload.Amount
+	Users[payload.UserId] = user
+
+	now := replay.Now()
+	withdrawal := models.Withdrawal{
+		ID:        replay.NewID(),
+		UserId:    payload.UserId,
+		Amount:    payload.Amount,
+		Status:    models.WithdrawalPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	models.Withdrawals[withdrawal.ID] = withdrawal
+	ledger.Transfer(ledger.KindWithdrawal, withdrawal.ID, ledger.Available(payload.UserId), ledger.Pending(payload.UserId), payload.Amount)
+
+	// A replayed withdrawal takes the rail's answer from the command log, it
+	// must not be paid out twice
+	result := replay.Value(func() payments.Result { return payments.Payouts.Payout(withdrawal) })
+	withdrawal = settleWithdrawal(withdrawal.ID, result)
+
+	logging.From(c).Info("withdrawal requested", logging.UserID, payload.UserId, "withdrawal", withdrawal.ID,
+		"amount", withdrawal.Amount, "status", withdrawal.Status)
+
+	// The balance is already back when the payout processor refused the payout
+	if withdrawal.Status == models.WithdrawalFailed {
+		apierr.Respond(c, apierr.New(apierr.PaymentFailed, "Withdrawal failed").With(withdrawal))
+		return
+	}
+
+	status := http.StatusOK
+	if withdrawal.Status == models.WithdrawalPending {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, models.UserResponse{
+		Success: true,
+		Message: "Withdrawal " + withdrawal.Status,
+		Data:    withdrawal,
+	})
+}
+
+// GetWithdrawal returns the current status of a withdrawal
+func GetWithdrawal(c *gin.Context) {
+	withdrawal, exists := models.Withdrawals[c.Param("withdrawalId")]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.WithdrawalNotFound, "Withdrawal not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Withdrawal " + withdrawal.Status,
+		Data:    withdrawal,
+	})
+}
+
+// UpdateWithdrawal is called by the payout rail to confirm or fail a pending
+// withdrawal. Like the gateway's webhook it must be signed, with the payout secret.
+func UpdateWithdrawal(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request data"))
+		return
+	}
+
+	if !payments.Verify(config.Current.Payments.PayoutSecret, body, c.GetHeader(payments.SignatureHeader)) {
+		apierr.Respond(c, apierr.New(apierr.InvalidSignature, "Invalid signature"))
+		return
+	}
+
+	var payload models.WithdrawalUpdate
+	if err := json.Unmarshal(body, &payload); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request data"))
+		return
+	}
+
+	if payload.Status != models.WithdrawalCompleted && payload.Status != models.WithdrawalFailed {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Status must be completed or failed"))
+		return
+	}
+
+	withdrawal, exists := models.Withdrawals[c.Param("withdrawalId")]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.WithdrawalNotFound, "Withdrawal not found"))
+		return
+	}
+
+	if withdrawal.Status != models.WithdrawalPending {
+		apierr.Respond(c, apierr.New(apierr.WithdrawalSettled, "Withdrawal already "+withdrawal.Status).With(withdrawal))
+		return
+	}
+
+	withdrawal = settleWithdrawal(withdrawal.ID, payments.Result{
+		Status:    payload.Status,
+		Reference: payload.Reference,
+		Reason:    payload.Reason,
+	})
+	logging.From(c).Info("withdrawal settled", logging.UserID, withdrawal.UserId, "withdrawal", withdrawal.ID,
+		"status", withdrawal.Status)
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Withdrawal " + withdrawal.Status,
+		Data:    withdrawal,
+	})
+}
+
+// settleWithdrawal applies a payout result. Completed payouts leave the pending
+// bucket for good, failed ones go back to the available balance.
+func settleWithdrawal(id string, result payments.Result) models.Withdrawal {
+	withdrawal := models.Withdrawals[id]
+	if result.Reference != "" {
+		withdrawal.Reference = result.Reference
+	}
+	withdrawal.Reason = result.Reason
+	withdrawal.UpdatedAt = replay.Now()
+
+	user := Users[withdrawal.UserId]
+	switch result.Status {
+	case models.WithdrawalCompleted:
+		user.PendingWithdrawal -= withdrawal.Amount
+		withdrawal.Status = models.WithdrawalCompleted
+		ledger.Transfer(ledger.KindWithdrawalPayout, id, ledger.Pending(withdrawal.UserId), ledger.External, withdrawal.Amount)
+	case models.WithdrawalFailed:
+		user.PendingWithdrawal -= withdrawal.Amount
+		user.Balance += withdrawal.Amount
+		withdrawal.Status = models.WithdrawalFailed
+		ledger.Transfer(ledger.KindWithdrawalFailed, id, ledger.Pending(withdrawal.UserId), ledger.Available(withdrawal.UserId), withdrawal.Amount)
+	}
+	Users[withdrawal.UserId] = user
+
+	models.Withdrawals[id] = withdrawal
+	return withdrawal
+}
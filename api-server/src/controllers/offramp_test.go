@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+// payoutRail sets the processor OfframpUser pays withdrawals out with
+func payoutRail(t *testing.T, processor payments.Processor) {
+	saved := payments.Payouts
+	payments.Payouts = processor
+	t.Cleanup(func() { payments.Payouts = saved })
+}
+
+func TestOfframpUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		processor *payments.FakeProcessor
+		amount    int
+		status    string
+		code      apierr.Code
+		httpCode  int
+		balance   int
+		pending   int
+	}{
+		{"completed", &payments.FakeProcessor{Mode: models.WithdrawalCompleted}, 40, models.WithdrawalCompleted, "", http.StatusOK, 60, 0},
+		{"pending", &payments.FakeProcessor{Mode: models.WithdrawalPending}, 40, models.WithdrawalPending, "", http.StatusAccepted, 60, 40},
+		{"failed", &payments.FakeProcessor{Mode: models.WithdrawalFailed}, 40, models.WithdrawalFailed, apierr.PaymentFailed, 0, 100, 0},
+		{"over the rail limit", &payments.FakeProcessor{FailAbove: 30}, 40, models.WithdrawalFailed, apierr.PaymentFailed, 0, 100, 0},
+		{"more than available", &payments.FakeProcessor{}, 101, "", apierr.InsufficientBalance, 0, 100, 0},
+		{"nothing", &payments.FakeProcessor{}, 0, "", apierr.InvalidRequest, 0, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payoutRail(t, tt.processor)
+			userId := "offramp-" + tt.name
+			fund(userId, 100)
+
+			r := call(t, OfframpUser, models.OfframpUser{UserId: userId, Amount: tt.amount}, nil)
+			if r.code() != tt.code {
+				t.Fatalf("code = %q, want %q", r.code(), tt.code)
+			}
+			if tt.httpCode != 0 && r.status != tt.httpCode {
+				t.Errorf("status = %d, want %d", r.status, tt.httpCode)
+			}
+			if tt.status != "" {
+				var withdrawal models.Withdrawal
+				data := r.Data
+				if r.Error != nil {
+					data, _ = json.Marshal(r.Error.Details)
+				}
+				json.Unmarshal(data, &withdrawal)
+				if withdrawal.Status != tt.status || models.Withdrawals[withdrawal.ID].Status != tt.status {
+					t.Errorf("withdrawal = %+v, want %s", withdrawal, tt.status)
+				}
+			}
+			if user := Users[userId]; user.Balance != tt.balance || user.PendingWithdrawal != tt.pending {
+				t.Errorf("balance = %+v, want %d available and %d pending", user, tt.balance, tt.pending)
+			}
+			verifyLedger(t)
+		})
+	}
+}
+
+func TestOfframpMarketMakerAccount(t *testing.T) {
+	r := call(t, OfframpUser, models.OfframpUser{UserId: "amm:ANY", Amount: 1}, nil)
+	if r.code() != apierr.InvalidRequest {
+		t.Fatalf("code = %q, want %q", r.code(), apierr.InvalidRequest)
+	}
+}
+
+// TestNoGrantToWithdraw places an order for a user without an account: by
+// default no balance is granted, so there is nothing to withdraw
+func TestNoGrantToWithdraw(t *testing.T) {
+	payoutRail(t, &payments.FakeProcessor{Mode: models.WithdrawalCompleted})
+	const userId = "offramp-grant"
+	fund("grant-creator", 100)
+	if r := call(t, CreateSymbol, models.CreateSymbol{UserId: "grant-creator", Stock: "GRANT"}, nil); !r.Success {
+		t.Fatalf("create market: %+v", r.Error)
+	}
+	order := models.OrderRequest{UserId: userId, Symbol: "GRANT", Side: "buy", Outcome: "yes", Price: 5, Quantity: 1}
+	if r := call(t, PlaceOrder, order, nil); r.code() != apierr.UserNotFound {
+		t.Fatalf("order code = %q, want %q", r.code(), apierr.UserNotFound)
+	}
+	if r := call(t, OfframpUser, models.OfframpUser{UserId: userId, Amount: 1}, nil); r.code() != apierr.UserNotFound {
+		t.Errorf("withdrawal code = %q, want %q", r.code(), apierr.UserNotFound)
+	}
+	if _, ok := Users[userId]; ok {
+		t.Error("user was granted a balance")
+	}
+	verifyLedger(t)
+}
+
+// TestUpdateWithdrawal walks a pending withdrawal through the payout rail's
+// callbacks. Each step runs on what the previous ones left.
+func TestUpdateWithdrawal(t *testing.T) {
+	payoutRail(t, &payments.FakeProcessor{Mode: models.WithdrawalPending})
+
+	open := func(userId string) string {
+		fund(userId, 100)
+		r := call(t, OfframpUser, models.OfframpUser{UserId: userId, Amount: 70}, nil)
+		var withdrawal models.Withdrawal
+		if err := json.Unmarshal(r.Data, &withdrawal); err != nil || withdrawal.Status != models.WithdrawalPending {
+			t.Fatalf("opening withdrawal: %+v", r)
+		}
+		return withdrawal.ID
+	}
+	paid, refused := open("payout-paid"), open("payout-refused")
+
+	signed := func(secret string, update models.WithdrawalUpdate) ([]byte, http.Header) {
+		body, _ := json.Marshal(update)
+		return body, http.Header{payments.SignatureHeader: {payments.Sign(secret, body)}}
+	}
+	secret := "controllers-payout-secret"
+	completed := models.WithdrawalUpdate{Status: models.WithdrawalCompleted, Reference: "utr-1"}
+	failed := models.WithdrawalUpdate{Status: models.WithdrawalFailed, Reason: "account closed"}
+
+	tests := []struct {
+		name    string
+		id      string
+		secret  string
+		update  models.WithdrawalUpdate
+		code    apierr.Code
+		userId  string
+		balance int
+		pending int
+	}{
+		{"unsigned", paid, "", completed, apierr.InvalidSignature, "payout-paid", 30, 70},
+		{"signed with the webhook secret", paid, "controllers-webhook-secret", completed, apierr.InvalidSignature, "payout-paid", 30, 70},
+		{"unknown status", paid, secret, models.WithdrawalUpdate{Status: models.WithdrawalPending}, apierr.InvalidRequest, "payout-paid", 30, 70},
+		{"unknown withdrawal", "missing", secret, completed, apierr.WithdrawalNotFound, "payout-paid", 30, 70},
+		{"completed", paid, secret, completed, "", "payout-paid", 30, 0},
+		{"completed twice", paid, secret, completed, apierr.WithdrawalSettled, "payout-paid", 30, 0},
+		{"failed after completing", paid, secret, failed, apierr.WithdrawalSettled, "payout-paid", 30, 0},
+		{"failed", refused, secret, failed, "", "payout-refused", 100, 0},
+		{"completed after failing", refused, secret, completed, apierr.WithdrawalSettled, "payout-refused", 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, header := signed(tt.secret, tt.update)
+			if tt.secret == "" {
+				header = nil
+			}
+			r := call(t, UpdateWithdrawal, body, header, gin.Param{Key: "withdrawalId", Value: tt.id})
+			if r.code() != tt.code {
+				t.Fatalf("code = %q, want %q", r.code(), tt.code)
+			}
+			if user := Users[tt.userId]; user.Balance != tt.balance || user.PendingWithdrawal != tt.pending {
+				t.Errorf("balance = %+v, want %d available and %d pending", user, tt.balance, tt.pending)
+			}
+			verifyLedger(t)
+		})
+	}
+
+	if w := models.Withdrawals[paid]; w.Status != models.WithdrawalCompleted || w.Reference != "utr-1" {
+		t.Errorf("paid withdrawal = %+v, want completed with the rail's reference", w)
+	}
+	if w := models.Withdrawals[refused]; w.Status != models.WithdrawalFailed || w.Reason != "account closed" {
+		t.Errorf("refused withdrawal = %+v, want failed with the rail's reason", w)
+	}
+}
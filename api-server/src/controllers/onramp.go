@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/replay"
+)
+
+// OnrampWebhook is called by the payment gateway. Only callbacks with a valid
+// signature that have not been seen before settle a deposit intent.
+func OnrampWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request data"))
+		return
+	}
+
+	if !payments.Verify(config.Current.Payments.WebhookSecret, body, c.GetHeader(payments.SignatureHeader)) {
+		apierr.Respond(c, apierr.New(apierr.InvalidSignature, "Invalid signature"))
+		return
+	}
+
+	var event models.GatewayEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.EventId == "" || event.IntentId == "" {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid event payload"))
+		return
+	}
+
+	// The gateway retries until it gets a 2xx, so a duplicate is acknowledged but ignored
+	if models.ProcessedWebhooks[event.EventId] {
+		c.JSON(http.StatusOK, models.UserResponse{
+			Success: true,
+			Message: "Event already processed",
+			Data:    models.DepositIntents[event.IntentId],
+		})
+		return
+	}
+
+	intent, exists := models.DepositIntents[event.IntentId]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.DepositNotFound, "Deposit intent not found"))
+		return
+	}
+
+	if intent.Status != models.DepositCreated {
+		models.ProcessedWebhooks[event.EventId] = true
+		c.JSON(http.StatusOK, models.UserResponse{
+			Success: true,
+			Message: "Deposit intent already " + intent.Status,
+			Data:    intent,
+		})
+		return
+	}
+
+	if event.Amount != intent.Amount {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Amount does not match the deposit intent"))
+		return
+	}
+
+	switch event.Status {
+	case models.DepositSucceeded:
+		user := Users[intent.UserId]
+		user.Balance += intent.Amount
+		Users[intent.UserId] = user
+		ledger.Transfer(ledger.KindOnramp, intent.ID, ledger.External, ledger.Available(intent.UserId), intent.Amount)
+	case models.DepositFailed:
+	default:
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Unknown payment status"))
+		return
+	}
+
+	intent.Status = event.Status
+	intent.UpdatedAt = replay.Now()
+	models.DepositIntents[intent.ID] = intent
+	models.ProcessedWebhooks[event.EventId] = true
+	logging.From(c).Info("deposit settled", logging.UserID, intent.UserId, "intent", intent.ID,
+		"status", intent.Status, "amount", intent.Amount)
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Deposit intent " + intent.Status,
+		Data:    intent,
+	})
+}
+
+// GetDepositIntent returns the current status of a deposit intent
+func GetDepositIntent(c *gin.Context) {
+	intent, exists := models.DepositIntents[c.Param("intentId")]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.DepositNotFound, "Deposit intent not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Deposit intent " + intent.Status,
+		Data:    intent,
+	})
+}
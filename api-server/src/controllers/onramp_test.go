@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+// TestOnrampWebhook sends the gateway's callbacks for two deposit intents in
+// turn. Each step runs on what the previous ones left, so retries and
+// replays must not credit a deposit twice.
+func TestOnrampWebhook(t *testing.T) {
+	secret := "controllers-webhook-secret"
+	for id, userId := range map[string]string{"int-paid": "depositor", "int-refused": "refused-depositor"} {
+		Users[userId] = models.UserBalance{}
+		models.DepositIntents[id] = models.DepositIntent{ID: id, UserId: userId, Amount: 250, Status: models.DepositCreated}
+	}
+
+	event := func(eventId, intentId string, amount int, status string) models.GatewayEvent {
+		return models.GatewayEvent{EventId: eventId, IntentId: intentId, Amount: amount, Status: status}
+	}
+	paid := event("evt-1", "int-paid", 250, models.DepositSucceeded)
+
+	tests := []struct {
+		name    string
+		secret  string
+		event   interface{}
+		code    apierr.Code
+		message string
+		balance int
+		status  string
+	}{
+		{"unsigned", "", paid, apierr.InvalidSignature, "", 0, models.DepositCreated},
+		{"signed with the payout secret", "controllers-payout-secret", paid, apierr.InvalidSignature, "", 0, models.DepositCreated},
+		{"not an event", secret, []byte(`{"eventId":`), apierr.InvalidRequest, "", 0, models.DepositCreated},
+		{"no event id", secret, event("", "int-paid", 250, models.DepositSucceeded), apierr.InvalidRequest, "", 0, models.DepositCreated},
+		{"unknown intent", secret, event("evt-0", "int-missing", 250, models.DepositSucceeded), apierr.DepositNotFound, "", 0, models.DepositCreated},
+		{"wrong amount", secret, event("evt-2", "int-paid", 2500, models.DepositSucceeded), apierr.InvalidRequest, "", 0, models.DepositCreated},
+		{"unknown status", secret, event("evt-3", "int-paid", 250, "refunded"), apierr.InvalidRequest, "", 0, models.DepositCreated},
+		{"succeeded", secret, paid, "", "Deposit intent succeeded", 250, models.DepositSucceeded},
+		{"same event again", secret, paid, "", "Event already processed", 250, models.DepositSucceeded},
+		{"new event for a settled intent", secret, event("evt-4", "int-paid", 250, models.DepositFailed), "", "Deposit intent already succeeded", 250, models.DepositSucceeded},
+		{"that event again", secret, event("evt-4", "int-paid", 250, models.DepositFailed), "", "Event already processed", 250, models.DepositSucceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, ok := tt.event.([]byte)
+			if !ok {
+				body, _ = json.Marshal(tt.event)
+			}
+			var header http.Header
+			if tt.secret != "" {
+				header = http.Header{payments.SignatureHeader: {payments.Sign(tt.secret, body)}}
+			}
+
+			r := call(t, OnrampWebhook, body, header)
+			if r.code() != tt.code {
+				t.Fatalf("code = %q, want %q", r.code(), tt.code)
+			}
+			if tt.message != "" && r.Message != tt.message {
+				t.Errorf("message = %q, want %q", r.Message, tt.message)
+			}
+			if got := Users["depositor"].Balance; got != tt.balance {
+				t.Errorf("balance = %d, want %d", got, tt.balance)
+			}
+			if got := models.DepositIntents["int-paid"].Status; got != tt.status {
+				t.Errorf("intent status = %s, want %s", got, tt.status)
+			}
+			verifyLedger(t)
+		})
+	}
+
+	refused := event("evt-5", "int-refused", 250, models.DepositFailed)
+	body, _ := json.Marshal(refused)
+	header := http.Header{payments.SignatureHeader: {payments.Sign(secret, body)}}
+	if r := call(t, OnrampWebhook, body, header); r.code() != "" || r.Message != "Deposit intent failed" {
+		t.Fatalf("failed payment: %+v", r)
+	}
+	if user := Users["refused-depositor"]; user.Balance != 0 {
+		t.Errorf("refused deposit credited %d", user.Balance)
+	}
+	verifyLedger(t)
+}
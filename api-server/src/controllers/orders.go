@@ -0,0 +1,503 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/replay"
+	"github.com/sahilrush/src/risk"
+	"github.com/sahilrush/src/tickers"
+	"github.com/sahilrush/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PlaceOrder places an order and answers with it and the fills it got
+func PlaceOrder(c *gin.Context) {
+	var payload models.OrderRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid payload").With(err.Error()))
+		return
+	}
+
+	order, err := placeOrder(c, payload)
+	if err != nil {
+		apierr.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.UserResponse{
+		Success: true,
+		Message: "Order " + order.Status,
+		Data:    order,
+	})
+}
+
+// GetOrder returns an order with every fill it got so far
+func GetOrder(c *gin.Context) {
+	order, exists := models.PlacedOrders[c.Param("orderId")]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.OrderNotFound, "Order not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Order " + order.Status,
+		Data:    order,
+	})
+}
+
+// ListOrders returns a user's orders oldest first, ?symbol= and ?status=
+// narrow them down; status=open also matches partially filled orders
+func ListOrders(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "userId is required"))
+		return
+	}
+	symbol, status := c.Query("symbol"), c.Query("status")
+
+	orders := []models.Order{}
+	for _, id := range models.UserOrders[userId] {
+		order := models.PlacedOrders[id]
+		if symbol != "" && order.Symbol != symbol {
+			continue
+		}
+		if status == models.OrderOpen && !order.Open() || status != "" && status != models.OrderOpen && order.Status != status {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Orders",
+		Data:    orders,
+	})
+}
+
+// CancelOrder takes what is left of an open order off the book and releases
+// the shares or INR locked for it, ?userId= must be the order's owner
+func CancelOrder(c *gin.Context) {
+	order, exists := models.PlacedOrders[c.Param("orderId")]
+	if !exists || order.UserId != c.Query("userId") {
+		apierr.Respond(c, apierr.New(apierr.OrderNotFound, "Order not found"))
+		return
+	}
+	if !order.Open() {
+		apierr.Respond(c, apierr.New(apierr.OrderNotOpen, "Order is already "+order.Status).With(order))
+		return
+	}
+
+	released := releaseOrder(order)
+	order.Remaining = 0
+	order.Status = models.OrderCancelled
+	order.UpdatedAt = replay.Now()
+	models.PlacedOrders[order.ID] = order
+	ordersCancelled.With(order.Symbol).Inc()
+	tickers.Book(order.Symbol, models.Orderbooks[order.Symbol])
+
+	logging.From(c).Info("order cancelled", logging.UserID, order.UserId, logging.Symbol, order.Symbol,
+		logging.OrderID, order.ID, "released", released)
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Order cancelled",
+		Data:    order,
+	})
+}
+
+// ListTrades returns trades oldest first. Without ?after= it returns the most
+// recent ones, with the ID of a trade the ones that came after it, so polling
+// with the last ID seen follows the trade log. ?symbol= keeps one market and
+// ?limit= caps the number returned, 100 by default.
+func ListTrades(c *gin.Context) {
+	symbol, after := c.Query("symbol"), c.Query("after")
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 1000 {
+			apierr.Respond(c, apierr.New(apierr.InvalidRequest, "limit must be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+
+	start := 0
+	if after != "" {
+		start = -1
+		for i := len(models.Trades) - 1; i >= 0; i-- {
+			if models.Trades[i].ID == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			apierr.Respond(c, apierr.New(apierr.NotFound, "Trade not found").With(map[string]interface{}{
+				"after": after,
+			}))
+			return
+		}
+	}
+
+	trades := []models.Trade{}
+	for _, trade := range models.Trades[start:] {
+		if symbol == "" || trade.Symbol == symbol {
+			trades = append(trades, trade)
+		}
+	}
+	if after == "" && len(trades) > limit {
+		trades = trades[len(trades)-limit:]
+	}
+	if len(trades) > limit {
+		trades = trades[:limit]
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Trades",
+		Data:    trades,
+	})
+}
+
+// validateOrder checks the request on its own, before looking at any state
+func validateOrder(req models.OrderRequest) error {
+	if req.UserId == "" || req.Symbol == "" {
+		return apierr.New(apierr.InvalidRequest, "userId and symbol are required")
+	}
+	if err := checkUserId(req.UserId); err != nil {
+		return err
+	}
+	if req.Side != "buy" && req.Side != "sell" {
+		return apierr.New(apierr.InvalidRequest, "side must be buy or sell")
+	}
+	if req.Outcome != "yes" && req.Outcome != "no" {
+		return apierr.New(apierr.InvalidRequest, "outcome must be yes or no")
+	}
+	if req.Quantity <= 0 {
+		return apierr.New(apierr.InvalidQuantity, "Quantity must be greater than zero")
+	}
+
+	switch req.Type {
+	case models.OrderLimit:
+		if req.Price <= 0 || req.Price >= models.ContractPrice {
+			return apierr.Newf(apierr.PriceOutOfRange, "Price must be between 1 and %d", models.ContractPrice-1).With(map[string]interface{}{
+				"price": req.Price, "min": 1, "max": models.ContractPrice - 1,
+			})
+		}
+	case models.OrderMarket:
+		if req.Price != 0 {
+			return apierr.New(apierr.InvalidRequest, "Market orders take no price")
+		}
+	default:
+		return apierr.New(apierr.InvalidRequest, "type must be limit or market")
+	}
+	return nil
+}
+
+// placeOrder runs an order through validation, the risk checks and the book:
+// it fills what it can, rests the rest of a limit order and cancels the rest
+// of a market order. Nothing changes when it returns an error.
+func placeOrder(c *gin.Context, req models.OrderRequest) (models.Order, error) {
+	if req.Type == "" {
+		req.Type = models.OrderLimit
+	}
+	if err := validateOrder(req); err != nil {
+		return models.Order{}, err
+	}
+	if _, exists := models.Orderbooks[req.Symbol]; !exists {
+		return models.Order{}, apierr.New(apierr.MarketNotFound, "Market does not exist").With(map[string]interface{}{
+			"symbol": req.Symbol,
+		})
+	}
+	if req.ClientOrderId != "" {
+		if existing, ok := findClientOrder(req.UserId, req.ClientOrderId); ok {
+			return models.Order{}, apierr.New(apierr.DuplicateClientOrderID, "clientOrderId was already used").With(existing)
+		}
+	}
+
+	// A market order takes any price, the worst one bounds its cost
+	limit := req.Price
+	if req.Type == models.OrderMarket {
+		limit = 1
+		if req.Side == "buy" {
+			limit = models.ContractPrice - 1
+		}
+	}
+
+	if err := checkRisk(c.Request.Context(), risk.Order{
+		UserId:   req.UserId,
+		Symbol:   req.Symbol,
+		Outcome:  req.Outcome,
+		Side:     req.Side,
+		Type:     req.Type,
+		Price:    limit,
+		Quantity: req.Quantity,
+	}); err != nil {
+		return models.Order{}, err
+	}
+
+	if req.Side == "buy" {
+		user, exists := Users[req.UserId]
+		if !exists && !config.Current.Features.AutoBalance {
+			return models.Order{}, apierr.New(apierr.UserNotFound, "User not found")
+		}
+		if !exists {
+			// New users start with the configured balance
+			user = models.UserBalance{Balance: config.Current.Market.InitialBalance}
+			Users[req.UserId] = user
+			ledger.Transfer(ledger.KindGrant, req.UserId, ledger.External, ledger.Available(req.UserId), user.Balance)
+		}
+		// The fee comes out of the same balance: the taker fee on what fills
+		// now, the maker fee locked with what rests
+		notional := limit * req.Quantity
+		fee := fillFee(req.Symbol, req.UserId, fees.Taker, 0, notional)
+		if req.Type == models.OrderLimit {
+			fee = max(fee, fillFee(req.Symbol, req.UserId, fees.Maker, 0, notional))
+		}
+		if cost := notional + fee; user.Balance < cost {
+			return models.Order{}, insufficientBalance(cost, user.Balance)
+		}
+	} else {
+		held := models.Stock_Balances[req.Symbol][req.UserId][req.Outcome]
+		if held.Quantity < req.Quantity {
+			return models.Order{}, insufficientShares(held, req.Quantity)
+		}
+	}
+
+	ordersPlaced.With(req.Symbol, req.Side, req.Outcome).Inc()
+	takerFilled = 0
+	trades, remaining := match(c.Request.Context(), req.Side, req.Symbol, req.Outcome, req.UserId, limit, req.Quantity)
+	for _, trade := range trades {
+		creditMaker(trade)
+	}
+
+	now := replay.Now()
+	order := models.Order{
+		ID:            replay.NewID(),
+		ClientOrderId: req.ClientOrderId,
+		UserId:        req.UserId,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Outcome:       req.Outcome,
+		Type:          req.Type,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		Filled:        req.Quantity - remaining,
+		Fills:         trades,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	// The taker and the maker fee round apart, which can leave a little less
+	// than the rest of a buy needs locked; what cannot be locked is cancelled
+	if req.Side == "buy" && req.Type == models.OrderLimit {
+		remaining = lockable(req.Symbol, req.UserId, req.Price, remaining)
+	}
+
+	switch {
+	case order.Filled == order.Quantity:
+		order.Status = models.OrderFilled
+	case req.Type == models.OrderMarket, remaining == 0:
+		order.Status = models.OrderCancelled
+	default:
+		order.Remaining = remaining
+		restOrder(order)
+		order.Status = models.OrderOpen
+		if order.Filled > 0 {
+			order.Status = models.OrderPartiallyFilled
+		}
+	}
+
+	models.PlacedOrders[order.ID] = order
+	models.UserOrders[order.UserId] = append(models.UserOrders[order.UserId], order.ID)
+	tickers.Book(order.Symbol, models.Orderbooks[order.Symbol])
+	logOrder(c, order)
+	return order, nil
+}
+
+// checkRisk runs the pre-trade checks. With risk checks switched off only
+// orders on resolved markets are refused.
+func checkRisk(ctx context.Context, order risk.Order) error {
+	_, span := tracing.Start(ctx, "risk checks", trace.WithAttributes(
+		attribute.String(logging.UserID, order.UserId),
+		attribute.String(logging.Symbol, order.Symbol),
+	))
+	defer span.End()
+
+	var rejection *apierr.Error
+	if config.Current.Features.RiskChecks {
+		rejection = risk.Validate(order)
+	} else {
+		rejection = risk.MarketOpen(order)
+	}
+	if rejection == nil {
+		return nil
+	}
+	span.SetAttributes(attribute.String("risk.rejection", string(rejection.Code)))
+	return rejection
+}
+
+// findClientOrder looks up a user's order by the ID the client gave it
+func findClientOrder(userId, clientOrderId string) (models.Order, bool) {
+	for _, id := range models.UserOrders[userId] {
+		if order := models.PlacedOrders[id]; order.ClientOrderId == clientOrderId {
+			return order, true
+		}
+	}
+	return models.Order{}, false
+}
+
+// bookPosition is where the unfilled part of an order rests: a sell on its own
+// outcome at its price, a buy as an inverse order on the other outcome at the
+// complementary price
+func bookPosition(side, outcome string, price int) (string, int) {
+	if side == "sell" {
+		return outcome, price
+	}
+	return opposite(outcome), models.ContractPrice - price
+}
+
+// restOrder puts the unfilled rest of an order on the book as an entry of its
+// own and locks what backs it: the shares of a sell, the INR of a buy
+func restOrder(order models.Order) {
+	symbol, userId, side, outcome := order.Symbol, order.UserId, order.Side, order.Outcome
+	price, quantity := order.Price, order.Remaining
+	bookOutcome, level := bookPosition(side, outcome, price)
+	book := bookSide(symbol, bookOutcome)
+
+	entry := book[level]
+	resting := models.Orders{OrderId: order.ID, UserId: userId, Quantity: quantity, Type: "inverse",
+		FeeLocked: fillFee(symbol, userId, fees.Maker, 0, price*quantity)}
+	if side == "sell" {
+		resting.Type, resting.FeeLocked = "sell", 0
+	}
+	entry.Orders = append(entry.Orders, resting)
+	entry.Total += quantity
+	book[level] = entry
+
+	if side == "sell" {
+		held := getOutcome(symbol, userId, outcome)
+		held.Quantity -= quantity
+		held.Locked += quantity
+		setOutcome(symbol, userId, outcome, held)
+		return
+	}
+
+	// A buy also locks the maker fee it will owe, so it pays it from the
+	// locked INR however much of its balance is tied up elsewhere
+	lock := price*quantity + resting.FeeLocked
+	user := Users[userId]
+	user.Balance -= lock
+	user.Locked += lock
+	Users[userId] = user
+	ledger.Transfer(ledger.KindLock, symbol, ledger.Available(userId), ledger.Locked(userId), lock)
+}
+
+// lockable is how much of the rest of a buy at price the user can lock
+// together with its maker fee
+func lockable(symbol, userId string, price, remaining int) int {
+	balance := Users[userId].Balance
+	return sort.Search(remaining+1, func(n int) bool {
+		return price*n+fillFee(symbol, userId, fees.Maker, 0, price*n) > balance
+	}) - 1
+}
+
+// releaseOrder takes the rest of an order off the book and unlocks what backs
+// it, the reverse of restOrder. It returns the quantity taken off.
+func releaseOrder(order models.Order) int {
+	bookOutcome, level := bookPosition(order.Side, order.Outcome, order.Price)
+	book := bookSide(order.Symbol, bookOutcome)
+
+	entry, ok := book[level]
+	if !ok {
+		return 0
+	}
+	quantity, feeLocked := 0, 0
+	for i, resting := range entry.Orders {
+		if resting.OrderId == order.ID {
+			quantity, feeLocked = min(order.Remaining, resting.Quantity), resting.FeeLocked
+			entry.Orders = slices.Delete(entry.Orders, i, i+1)
+			break
+		}
+	}
+	entry.Total -= quantity
+	if len(entry.Orders) == 0 {
+		delete(book, level)
+	} else {
+		book[level] = entry
+	}
+
+	if order.Side == "sell" {
+		held := getOutcome(order.Symbol, order.UserId, order.Outcome)
+		held.Locked -= quantity
+		held.Quantity += quantity
+		setOutcome(order.Symbol, order.UserId, order.Outcome, held)
+		return quantity
+	}
+
+	refund := order.Price*quantity + feeLocked
+	user := Users[order.UserId]
+	user.Locked -= refund
+	user.Balance += refund
+	Users[order.UserId] = user
+	ledger.Transfer(ledger.KindUnlock, order.Symbol, ledger.Locked(order.UserId), ledger.Available(order.UserId), refund)
+	return quantity
+}
+
+// creditMaker adds a fill to the resting order it was made against. Fills
+// from a market maker have no order to credit.
+func creditMaker(trade models.Trade) {
+	order, exists := models.PlacedOrders[trade.MakerOrderId]
+	if !exists {
+		return
+	}
+
+	order.Filled += trade.Quantity
+	order.Remaining -= trade.Quantity
+	order.Fills = append(order.Fills, trade)
+	order.Status = models.OrderPartiallyFilled
+	if order.Remaining == 0 {
+		order.Status = models.OrderFilled
+	}
+	order.UpdatedAt = trade.Timestamp
+	models.PlacedOrders[order.ID] = order
+}
+
+// insufficientBalance reports an order costing more than the available balance
+func insufficientBalance(required, available int) error {
+	return apierr.New(apierr.InsufficientBalance, "Insufficient balance").With(map[string]interface{}{
+		"required":  required,
+		"available": available,
+	})
+}
+
+// insufficientShares reports a sell for more shares than the user holds
+func insufficientShares(held models.OutCome, requested int) error {
+	return apierr.New(apierr.InsufficientShares, "Insufficient stock quantity").With(map[string]interface{}{
+		"available": held.Quantity,
+		"requested": requested,
+		"locked":    held.Locked,
+	})
+}
+
+// logOrder records an accepted order and the fills it produced
+func logOrder(c *gin.Context, order models.Order) {
+	logger := logging.From(c).With(logging.UserID, order.UserId, logging.Symbol, order.Symbol, logging.OrderID, order.ID)
+	for _, trade := range order.Fills {
+		logger.Debug("fill", logging.TradeID, trade.ID, "price", trade.Price, "quantity", trade.Quantity, "maker", trade.Maker)
+	}
+	logger.Info("order placed", "side", order.Side, "outcome", order.Outcome, "type", order.Type, "price", order.Price,
+		"quantity", order.Quantity, "filled", order.Filled, "resting", order.Remaining, "status", order.Status)
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tickers"
+)
+
+// GetPortfolio lists every market the user holds shares in, has open orders
+// in or took profit in, with the average entry price, the value at the mark
+// price, realized and unrealized PnL and what open orders commit
+func GetPortfolio(c *gin.Context) {
+	userId := c.Param("userId")
+	balance, exists := Users[userId]
+
+	positions := map[[2]string]*models.Position{}
+	position := func(symbol, outcome string) *models.Position {
+		key := [2]string{symbol, outcome}
+		if positions[key] == nil {
+			positions[key] = &models.Position{Symbol: symbol, Outcome: outcome}
+		}
+		return positions[key]
+	}
+
+	for symbol, users := range models.Stock_Balances {
+		for outcome, held := range users[userId] {
+			if held.Quantity+held.Locked > 0 {
+				p := position(symbol, outcome)
+				p.Quantity, p.Locked = held.Quantity, held.Locked
+			}
+		}
+	}
+	for symbol, users := range models.CostBasis {
+		for outcome, basis := range users[userId] {
+			if basis.Quantity > 0 || basis.Realized != 0 {
+				p := position(symbol, outcome)
+				p.Cost, p.RealizedPnl = basis.Cost, basis.Realized
+			}
+		}
+	}
+
+	totals := models.PortfolioTotals{}
+	for _, id := range models.UserOrders[userId] {
+		order := models.PlacedOrders[id]
+		if !order.Open() {
+			continue
+		}
+		p := position(order.Symbol, order.Outcome)
+		if order.Side == "buy" {
+			p.OpenBuy += order.Remaining
+			p.OpenBuyCost += order.Price * order.Remaining
+		} else {
+			p.OpenSell += order.Remaining
+		}
+		totals.OpenOrders++
+	}
+
+	// A user with shares but no INR account still has a portfolio, only
+	// someone the engine has nothing on is unknown
+	if !exists && len(positions) == 0 && len(models.UserOrders[userId]) == 0 {
+		apierr.Respond(c, apierr.New(apierr.UserNotFound, "User not found"))
+		return
+	}
+
+	portfolio := models.Portfolio{UserId: userId, Balance: balance, Positions: []models.Position{}}
+	for _, p := range positions {
+		markPosition(p)
+		totals.Cost += p.Cost
+		totals.Value += p.Value
+		totals.RealizedPnl += p.RealizedPnl
+		totals.UnrealizedPnl += p.UnrealizedPnl
+		totals.OpenBuyCost += p.OpenBuyCost
+		portfolio.Positions = append(portfolio.Positions, *p)
+	}
+	sort.Slice(portfolio.Positions, func(i, j int) bool {
+		a, b := portfolio.Positions[i], portfolio.Positions[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.Outcome > b.Outcome
+	})
+
+	for _, users := range models.FeesPaid {
+		totals.Fees += users[userId]
+	}
+	totals.NetPnl = float64(totals.RealizedPnl) + totals.UnrealizedPnl - float64(totals.Fees)
+	portfolio.Totals = totals
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Portfolio",
+		Data:    portfolio,
+	})
+}
+
+// markPosition fills in the average price, mark price, value and unrealized
+// PnL of a position whose quantities and cost are set
+func markPosition(p *models.Position) {
+	p.Resolved = models.ResolvedMarkets[p.Symbol]
+	held := p.Quantity + p.Locked
+	if held == 0 {
+		return
+	}
+	p.AvgPrice = float64(p.Cost) / float64(held)
+
+	if last, ok := models.LastTradedPrice[p.Symbol][p.Outcome]; ok {
+		p.MarkPrice, p.MarkSource = float64(last), "last"
+	} else if quote := bookQuote(p.Symbol, p.Outcome); quote.Bid > 0 && quote.Ask > 0 {
+		p.MarkPrice, p.MarkSource = float64(quote.Bid+quote.Ask)/2, "mid"
+	} else {
+		p.Value = float64(p.Cost)
+		return
+	}
+	p.Value = p.MarkPrice * float64(held)
+	p.UnrealizedPnl = p.Value - float64(p.Cost)
+}
+
+// bookQuote returns the best bid and ask of an outcome from its market's ticker
+func bookQuote(symbol, outcome string) tickers.Quote {
+	ticker, _ := tickers.Get(symbol, time.Now())
+	if outcome == "no" {
+		return ticker.No
+	}
+	return ticker.Yes
+}
+
+// getBasis reads a user's cost basis, creating the maps on the way if needed
+func getBasis(symbol, userId, outcome string) models.Basis {
+	if _, ok := models.CostBasis[symbol]; !ok {
+		models.CostBasis[symbol] = map[string]map[string]models.Basis{}
+	}
+	if _, ok := models.CostBasis[symbol][userId]; !ok {
+		models.CostBasis[symbol][userId] = map[string]models.Basis{}
+	}
+	return models.CostBasis[symbol][userId][outcome]
+}
+
+func setBasis(symbol, userId, outcome string, value models.Basis) {
+	getBasis(symbol, userId, outcome)
+	models.CostBasis[symbol][userId][outcome] = value
+}
+
+// acquire adds shares the user got at price to their cost basis
+func acquire(symbol, userId, outcome string, quantity, price int) {
+	basis := getBasis(symbol, userId, outcome)
+	basis.Quantity += quantity
+	basis.Cost += quantity * price
+	setBasis(symbol, userId, outcome, basis)
+}
+
+// dispose takes shares the user sold or had settled at price out of their
+// cost basis at the average cost and books the difference as realized profit.
+// Shares held from before costs were tracked count as free.
+func dispose(symbol, userId, outcome string, quantity, price int) {
+	basis := getBasis(symbol, userId, outcome)
+	covered := min(quantity, basis.Quantity)
+	cost := 0
+	if covered > 0 {
+		cost = basis.Cost * covered / basis.Quantity
+	}
+	basis.Quantity -= covered
+	basis.Cost -= cost
+	basis.Realized += quantity*price - cost
+	setBasis(symbol, userId, outcome, basis)
+}
+
+// payFee records a fee the user paid in a market
+func payFee(symbol, userId string, fee int) {
+	if _, ok := models.FeesPaid[symbol]; !ok {
+		models.FeesPaid[symbol] = map[string]int{}
+	}
+	models.FeesPaid[symbol][userId] += fee
+}
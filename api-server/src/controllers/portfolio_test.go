@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/models"
+)
+
+func TestDispose(t *testing.T) {
+	type lot struct{ quantity, price int }
+	tests := []struct {
+		name     string
+		acquired []lot
+		disposed []lot
+		want     models.Basis
+	}{
+		{"at the average cost", []lot{{2, 4}, {2, 6}}, []lot{{2, 7}}, models.Basis{Quantity: 2, Cost: 10, Realized: 4}},
+		{"everything", []lot{{3, 5}}, []lot{{3, 5}}, models.Basis{}},
+		{"at a loss", []lot{{2, 6}}, []lot{{2, 1}}, models.Basis{Realized: -10}},
+		{"rounding keeps the cost with the shares left", []lot{{1, 4}, {2, 3}}, []lot{{1, 5}}, models.Basis{Quantity: 2, Cost: 7, Realized: 2}},
+		{"untracked shares are free", []lot{{1, 5}}, []lot{{3, 6}}, models.Basis{Realized: 13}},
+		{"nothing tracked", nil, []lot{{2, 4}}, models.Basis{Realized: 8}},
+		{"winning shares settle at the contract price", []lot{{4, 6}}, []lot{{4, models.ContractPrice}}, models.Basis{Realized: 16}},
+		{"losing shares expire worthless", []lot{{4, 6}}, []lot{{4, 0}}, models.Basis{Realized: -24}},
+		{"realized adds up", []lot{{4, 5}}, []lot{{1, 7}, {1, 3}, {2, 5}}, models.Basis{Realized: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			symbol := "DISPOSE-" + tt.name
+			t.Cleanup(func() { delete(models.CostBasis, symbol) })
+			for _, l := range tt.acquired {
+				acquire(symbol, "alice", "yes", l.quantity, l.price)
+			}
+			for _, l := range tt.disposed {
+				dispose(symbol, "alice", "yes", l.quantity, l.price)
+			}
+			if got := models.CostBasis[symbol]["alice"]["yes"]; got != tt.want {
+				t.Errorf("basis = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// portfolio fetches a user's portfolio keyed by symbol/outcome
+func portfolio(t *testing.T, userId string) (map[string]models.Position, models.PortfolioTotals) {
+	t.Helper()
+	r := call(t, GetPortfolio, nil, nil, gin.Param{Key: "userId", Value: userId})
+	if !r.Success {
+		t.Fatalf("portfolio of %s: %+v", userId, r.Error)
+	}
+	var p models.Portfolio
+	json.Unmarshal(r.Data, &p)
+	positions := map[string]models.Position{}
+	for _, position := range p.Positions {
+		positions[position.Symbol+"/"+position.Outcome] = position
+	}
+	return positions, p.Totals
+}
+
+// TestPortfolioAtResolution follows a buyer and the market's creator through
+// a trade and the market resolving: the shares are paid out and only the
+// realized PnL is left
+func TestPortfolioAtResolution(t *testing.T) {
+	const symbol, creator, buyer = "PORTFOLIO", "portfolio-creator", "portfolio-buyer"
+	fund(creator, 100)
+	fund(buyer, 1000)
+	if r := call(t, CreateSymbol, models.CreateSymbol{UserId: creator, Stock: symbol}, nil); !r.Success {
+		t.Fatalf("create market: %+v", r.Error)
+	}
+	orders := []models.OrderRequest{
+		{UserId: creator, Symbol: symbol, Side: "sell", Outcome: "yes", Price: 6, Quantity: 10},
+		{UserId: buyer, Symbol: symbol, Side: "buy", Outcome: "yes", Price: 6, Quantity: 4},
+		{UserId: buyer, Symbol: symbol, Side: "buy", Outcome: "yes", Price: 6, Quantity: 3},
+	}
+	for _, order := range orders {
+		if r := call(t, PlaceOrder, order, nil); !r.Success {
+			t.Fatalf("order %+v: %+v", order, r.Error)
+		}
+	}
+
+	positions, totals := portfolio(t, buyer)
+	open := positions[symbol+"/yes"]
+	if open.Quantity != 7 || open.Cost != 42 || open.AvgPrice != 6 || open.MarkSource != "last" || open.Value != 42 {
+		t.Errorf("open position = %+v", open)
+	}
+	if _, totals := portfolio(t, creator); totals.OpenOrders != 1 {
+		t.Errorf("creator has %d open orders, want the rest of the sell", totals.OpenOrders)
+	}
+
+	if r := call(t, ResolveSymbol, models.ResolveSymbol{Stock: symbol, Outcome: "yes"}, nil); !r.Success {
+		t.Fatalf("resolve: %+v", r.Error)
+	}
+
+	tests := []struct {
+		name     string
+		userId   string
+		outcome  string
+		realized int
+	}{
+		// bought 7 at 6, each paid 10
+		{"buyer's winning shares", buyer, "yes", 28},
+		// sold 7 for 6 and had 93 paid out, all seeded for nothing
+		{"creator's winning shares", creator, "yes", 42 + 930},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, totals = portfolio(t, tt.userId)
+			p, ok := positions[symbol+"/"+tt.outcome]
+			if !ok {
+				t.Fatalf("no %s position in %+v", tt.outcome, positions)
+			}
+			if p.Quantity != 0 || p.Locked != 0 || p.Cost != 0 || p.Value != 0 || p.MarkSource != "" {
+				t.Errorf("settled position still holds shares: %+v", p)
+			}
+			if p.RealizedPnl != tt.realized || p.Resolved != "yes" {
+				t.Errorf("realized %d resolved %q, want %d yes", p.RealizedPnl, p.Resolved, tt.realized)
+			}
+			if totals.OpenOrders != 0 || totals.NetPnl != float64(totals.RealizedPnl-totals.Fees) {
+				t.Errorf("totals = %+v", totals)
+			}
+		})
+	}
+	// Losing shares seeded for nothing leave no position behind
+	if p, ok := positions[symbol+"/no"]; ok {
+		t.Errorf("creator's worthless NO shares left a position %+v", p)
+	}
+	verifyLedger(t)
+}
+
+// TestPortfolioWithoutBalance asks for the portfolio of users the engine
+// knows only from their shares, their realized PnL or their orders
+func TestPortfolioWithoutBalance(t *testing.T) {
+	const symbol = "NOBALANCE"
+	tests := []struct {
+		name   string
+		userId string
+		setup  func(userId string)
+		found  bool
+	}{
+		{"unknown", "nobody-at-all", func(string) {}, false},
+		{"shares", "shares-only", func(userId string) {
+			setOutcome(symbol, userId, "yes", models.OutCome{Quantity: 3})
+		}, true},
+		{"realized PnL", "pnl-only", func(userId string) {
+			dispose(symbol, userId, "no", 2, 4)
+		}, true},
+		{"orders", "orders-only", func(userId string) {
+			models.UserOrders[userId] = []string{"closed-order"}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(tt.userId)
+			if _, exists := Users[tt.userId]; exists {
+				t.Fatal("user has a balance")
+			}
+			r := call(t, GetPortfolio, nil, nil, gin.Param{Key: "userId", Value: tt.userId})
+			if r.Success != tt.found || !tt.found && r.code() != apierr.UserNotFound {
+				t.Errorf("success %v code %q, want found %v", r.Success, r.code(), tt.found)
+			}
+		})
+	}
+}
@@ -1,39 +1,56 @@
 package controllers
 
 import (
+	"bytes"
+	"io"
 	"net/http"
+	"sort"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
 	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/replay"
+	"github.com/sahilrush/src/tickers"
 )
 
 var STOCK_BALANCES = models.Stock_Balances
 var ORDERBOOKS = models.Orderbooks
 
 func CreateSymbol(c *gin.Context) {
-	var payload struct {
-		UserId string `json:"userId"  binding:"required"`
-		Stock  string `json:"stock"  binding:"required"`
-	}
+	var payload models.CreateSymbol
 
+	// The raw body is kept to check an operator's signature
+	body, err := c.GetRawData()
+	if err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid payload"))
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "Invalid payload",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid payload"))
 		return
 	}
 
 	// Check if the stock already exists
 	if _, exists := models.Orderbooks[payload.Stock]; exists {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "Stock already exists",
-			Data:    models.Orderbooks[payload.Stock],
-		})
+		apierr.Respond(c, apierr.New(apierr.MarketExists, "Stock already exists").With(models.Orderbooks[payload.Stock]))
 		return
 	}
+	if err := checkUserId(payload.UserId); err != nil {
+		apierr.Respond(c, err)
+		return
+	}
+	if payload.Amm != nil {
+		if err := checkMakerSeed(payload.UserId, *payload.Amm, fromOperator(c, body)); err != nil {
+			apierr.Respond(c, err)
+			return
+		}
+	}
 
 	// Initialize the orderbook for the stock
 	models.Orderbooks[payload.Stock] = models.Pricing{
@@ -48,10 +65,25 @@ func CreateSymbol(c *gin.Context) {
 
 	// Initialize the user's stock symbol if not present
 	if _, exists := models.Stock_Balances[payload.Stock][payload.UserId]; !exists {
+		shares := config.Current.Market.InitialShares
 		models.Stock_Balances[payload.Stock][payload.UserId] = map[string]models.OutCome{
-			"yes": {Quantity: 100, Locked: 0}, // Initialize with 100 units
-			"no":  {Quantity: 100, Locked: 0}, // Initialize with 100 units
+			"yes": {Quantity: shares, Locked: 0}, // Initialize with the configured units
+			"no":  {Quantity: shares, Locked: 0},
 		}
+		// The seeded pairs are backed in escrow like any minted pair
+		ledger.Transfer(ledger.KindMint, payload.Stock, ledger.External, ledger.Escrow(payload.Stock), shares*models.ContractPrice)
+		// and cost the creator nothing
+		acquire(payload.Stock, payload.UserId, "yes", shares, 0)
+		acquire(payload.Stock, payload.UserId, "no", shares, 0)
+		tickers.Mint(payload.Stock, shares)
+	}
+	tickers.List(payload.Stock)
+
+	logging.From(c).Info("market created", logging.Symbol, payload.Stock, logging.UserID, payload.UserId)
+	if payload.Amm != nil {
+		maker := seedMaker(payload.Stock, payload.UserId, *payload.Amm)
+		logging.From(c).Info("market maker seeded", logging.Symbol, payload.Stock,
+			"liquidity", maker.Liquidity, "fundedBy", maker.FundedBy, "subsidy", maker.Subsidy)
 	}
 
 	c.JSON(http.StatusOK, models.UserResponse{
@@ -62,14 +94,6 @@ func CreateSymbol(c *gin.Context) {
 }
 
 func GetOrderBooks(c *gin.Context) {
-	if len(ORDERBOOKS) == 0 {
-		c.JSON(http.StatusNotFound, models.UserResponse{
-			Success: false,
-			Message: "no orderbook available",
-			Data:    nil,
-		})
-		return
-	}
 	c.JSON(http.StatusOK, models.UserResponse{
 		Success: true,
 		Message: "Following orderbooks are available",
@@ -80,20 +104,12 @@ func GetOrderBooks(c *gin.Context) {
 func ViewOrderbook(c *gin.Context) {
 	symbol := c.Param("symbol")
 	if symbol == "" {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "Symbol is required",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Symbol is required"))
 		return
 	}
 	orderbook, exists := ORDERBOOKS[symbol]
 	if !exists {
-		c.JSON(http.StatusOK, models.UserResponse{
-			Success: false,
-			Message: "no orderbook found for given symbol",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.MarketNotFound, "no orderbook found for given symbol"))
 		return
 	}
 
@@ -105,14 +121,6 @@ func ViewOrderbook(c *gin.Context) {
 }
 
 func GetStocks(c *gin.Context) {
-	if len(STOCK_BALANCES) == 0 {
-		c.JSON(http.StatusOK, models.UserResponse{
-			Success: false,
-			Message: "No stocks are avaliable",
-			Data:    nil,
-		})
-		return
-	}
 	c.JSON(http.StatusOK, models.UserResponse{
 		Success: true,
 		Message: "these are the stocks",
@@ -123,21 +131,19 @@ func GetStocks(c *gin.Context) {
 func GetUserStock(c *gin.Context) {
 	userId := c.Param("userId")
 	if userId == "" {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "User Id is required",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "User Id is required"))
 		return
 	}
 
-	userStocks, exists := STOCK_BALANCES[userId]
-	if !exists {
-		c.JSON(http.StatusOK, models.UserResponse{
-			Success: false,
-			Message: "no stocks found for the given user",
-			Data:    nil,
-		})
+	// The balances are keyed by symbol first, collect the user's from every market
+	userStocks := map[string]models.Stocksymbol{}
+	for symbol, users := range STOCK_BALANCES {
+		if holdings, ok := users[userId]; ok {
+			userStocks[symbol] = holdings
+		}
+	}
+	if _, exists := Users[userId]; !exists && len(userStocks) == 0 {
+		apierr.Respond(c, apierr.New(apierr.UserNotFound, "User not found"))
 		return
 	}
 
@@ -147,3 +153,124 @@ func GetUserStock(c *gin.Context) {
 		Data:    userStocks,
 	})
 }
+
+// ResolveSymbol settles a market: resting orders are cancelled and refunded, every
+// winning share pays out the contract price minus the settlement fee, and losing
+// shares expire worthless.
+func ResolveSymbol(c *gin.Context) {
+	var payload models.ResolveSymbol
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid payload"))
+		return
+	}
+
+	if payload.Outcome != "yes" && payload.Outcome != "no" {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Outcome must be yes or no"))
+		return
+	}
+
+	if _, exists := models.Orderbooks[payload.Stock]; !exists {
+		apierr.Respond(c, apierr.New(apierr.MarketNotFound, "Stock does not exist"))
+		return
+	}
+
+	if outcome, resolved := models.ResolvedMarkets[payload.Stock]; resolved {
+		apierr.Respond(c, apierr.New(apierr.MarketResolved, "Market already resolved").With(map[string]interface{}{
+			"outcome": outcome,
+		}))
+		return
+	}
+
+	cancelAllOrders(payload.Stock)
+
+	// Holders are paid in a fixed order so the journal comes out the same when
+	// the command is replayed
+	holders := getKeys(models.Stock_Balances[payload.Stock])
+	sort.Strings(holders)
+
+	payouts := map[string]int{}
+	for _, userId := range holders {
+		holdings := models.Stock_Balances[payload.Stock][userId]
+		won := holdings[payload.Outcome]
+		shares := won.Quantity + won.Locked
+		if shares > 0 {
+			winnings := shares * models.ContractPrice
+			user := Users[userId]
+			user.Balance += winnings
+			Users[userId] = user
+			ledger.Transfer(ledger.KindSettlement, payload.Stock, ledger.Escrow(payload.Stock), ledger.Available(userId), winnings)
+
+			fee := 0
+			if !feeExempt(userId) {
+				fee = chargeFee(payload.Stock, userId, fees.Settlement, fees.Compute(payload.Stock, userId, fees.Settlement, winnings, winnings))
+			}
+			payouts[userId] = winnings - fee
+			if !amm.IsAccount(userId) {
+				dispose(payload.Stock, userId, payload.Outcome, shares, models.ContractPrice)
+			}
+		}
+		lost := holdings[opposite(payload.Outcome)]
+		if shares := lost.Quantity + lost.Locked; shares > 0 && !amm.IsAccount(userId) {
+			dispose(payload.Stock, userId, opposite(payload.Outcome), shares, 0)
+		}
+		delete(models.Stock_Balances[payload.Stock], userId)
+	}
+
+	settleMaker(payload.Stock)
+
+	models.ResolvedMarkets[payload.Stock] = payload.Outcome
+	tickers.Resolve(payload.Stock, payload.Outcome)
+	logging.From(c).Info("market resolved", logging.Symbol, payload.Stock, "outcome", payload.Outcome, "holders", len(payouts))
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Market resolved",
+		Data: models.Resolution{
+			Outcome: payload.Outcome,
+			Payouts: payouts,
+		},
+	})
+}
+
+// cancelAllOrders empties a symbol's book and returns locked shares and INR to their owners
+func cancelAllOrders(symbol string) {
+	now := replay.Now()
+	for id, order := range models.PlacedOrders {
+		if order.Symbol == symbol && order.Open() {
+			order.Status = models.OrderCancelled
+			order.Remaining = 0
+			order.UpdatedAt = now
+			models.PlacedOrders[id] = order
+		}
+	}
+
+	pricing := models.Orderbooks[symbol]
+	for _, outcome := range []string{"yes", "no"} {
+		side := pricing.Yes
+		if outcome == "no" {
+			side = pricing.No
+		}
+
+		for _, price := range sortedLevels(side) {
+			for _, order := range side[price].Orders {
+				userId := order.UserId
+				ordersCancelled.With(symbol).Inc()
+				if order.Type == "sell" {
+					held := getOutcome(symbol, userId, outcome)
+					held.Locked -= order.Quantity
+					held.Quantity += order.Quantity
+					setOutcome(symbol, userId, outcome, held)
+				} else {
+					refund := (models.ContractPrice-price)*order.Quantity + order.FeeLocked
+					user := Users[userId]
+					user.Locked -= refund
+					user.Balance += refund
+					Users[userId] = user
+					ledger.Transfer(ledger.KindUnlock, symbol, ledger.Locked(userId), ledger.Available(userId), refund)
+				}
+			}
+			delete(side, price)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tickers"
+)
+
+// GetTickers returns the summary the engine keeps of every market
+func GetTickers(c *gin.Context) {
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "Tickers",
+		Data:    tickers.All(time.Now()),
+	})
+}
@@ -1,38 +1,59 @@
 package controllers
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/logging"
 	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/replay"
 )
 
-var Users = make(map[string]models.UserBalance)
+// Users shares the map with models.INR_BALANCES so every handler sees the same balances
+var Users = models.INR_BALANCES
 
-func CreateUser(c *gin.Context) {
+// checkUserId refuses the user ids no request may act as: those of market
+// makers, whose INR and shares only the engine moves
+func checkUserId(userId string) error {
+	if amm.IsAccount(userId) {
+		return apierr.New(apierr.InvalidRequest, "User ids starting with amm: belong to market makers")
+	}
+	return nil
+}
 
-	var payload struct {
-		UserId string `json:"userId" binding:"required"`
+// lookupUser returns the balance of the user a request acts for. Handlers
+// that move a user's money find the user here rather than in Users.
+func lookupUser(userId string) (models.UserBalance, error) {
+	if err := checkUserId(userId); err != nil {
+		return models.UserBalance{}, err
+	}
+	user, exists := Users[userId]
+	if !exists {
+		return models.UserBalance{}, apierr.New(apierr.UserNotFound, "User does not exist")
 	}
+	return user, nil
+}
+
+func CreateUser(c *gin.Context) {
+
+	var payload models.CreateUser
 
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "Invalid request payload",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request payload"))
 		return
 	}
 
-	fmt.Println("Current Users:", Users)
+	logging.From(c).Debug("creating user", logging.UserID, payload.UserId, "users", len(Users))
 
+	if err := checkUserId(payload.UserId); err != nil {
+		apierr.Respond(c, err)
+		return
+	}
 	if _, exists := Users[payload.UserId]; exists {
-		c.JSON(http.StatusOK, models.UserResponse{
-			Success: false,
-			Message: "User already exists",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.UserExists, "User already exists"))
 		return
 	}
 
@@ -40,6 +61,7 @@ func CreateUser(c *gin.Context) {
 		Balance: 0,
 		Locked:  0,
 	}
+	logging.From(c).Info("user created", logging.UserID, payload.UserId)
 
 	c.JSON(http.StatusOK, models.UserResponse{
 		Success: true,
@@ -48,58 +70,65 @@ func CreateUser(c *gin.Context) {
 	})
 }
 
-// on ramping the money
+// on ramping the money: this only opens a deposit intent, the balance is
+// credited once the gateway confirms the payment on the webhook
 func OnrampUser(c *gin.Context) {
 	var payload models.OnrampUser
 
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "Invalid request data",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request data"))
 		return
 	}
 
 	if payload.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "Amount must be greater than zero",
-			Data:    nil,
-		})
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Amount must be greater than zero"))
+		return
+	}
+
+	if _, err := lookupUser(payload.UserId); err != nil {
+		apierr.Respond(c, err)
 		return
 	}
 
-	if userBalance, exists := Users[payload.UserId]; exists {
-		userBalance.Balance += payload.Amount
-		Users[payload.UserId] = userBalance
+	now := replay.Now()
+	intent := models.DepositIntent{
+		ID:        replay.NewID(),
+		UserId:    payload.UserId,
+		Amount:    payload.Amount,
+		Status:    models.DepositCreated,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
 
-		c.JSON(http.StatusOK, models.UserResponse{
-			Success: true,
-			Message: "User balance updated",
-			Data:    userBalance,
-		})
+	// A replayed deposit takes the gateway's answer from the command log
+	// instead of opening a second payment
+	type created struct {
+		Checkout payments.Checkout
+		Err      string
+	}
+	result := replay.Value(func() created {
+		checkout, err := payments.Deposits.CreatePayment(intent)
+		if err != nil {
+			return created{Err: err.Error()}
+		}
+		return created{Checkout: checkout}
+	})
+	if result.Err != "" {
+		apierr.Respond(c, apierr.New(apierr.PaymentFailed, "Failed to create payment").With(result.Err))
 		return
 	}
+	intent.Reference = result.Checkout.Reference
+	intent.CheckoutURL = result.Checkout.URL
+	models.DepositIntents[intent.ID] = intent
 
-	c.JSON(http.StatusBadRequest, models.UserResponse{
-		Success: false,
-		Message: "User does not exist",
-		Data:    nil,
+	c.JSON(http.StatusCreated, models.UserResponse{
+		Success: true,
+		Message: "Deposit intent created",
+		Data:    intent,
 	})
 }
 
 func GetBalances(c *gin.Context) {
-
-	if len(Users) == 0 {
-		c.JSON(http.StatusBadRequest, models.UserResponse{
-			Success: false,
-			Message: "didont have any money",
-			Data:    nil,
-		})
-		return
-	}
-
 	c.JSON(http.StatusOK, models.UserResponse{
 		Success: true,
 		Message: "The balance is ",
@@ -108,17 +137,18 @@ func GetBalances(c *gin.Context) {
 
 }
 
-// can apply if else
 func GetUserBalance(c *gin.Context) {
 	userId := c.Param("userId")
 
-	if userBalance, exists := Users[userId]; exists {
-		c.JSON(http.StatusOK, models.UserResponse{
-			Success: true,
-			Message: "User balance is ",
-			Data:    userBalance,
-		})
-
+	userBalance, exists := Users[userId]
+	if !exists {
+		apierr.Respond(c, apierr.New(apierr.UserNotFound, "User does not exist"))
+		return
 	}
 
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success: true,
+		Message: "User balance is ",
+		Data:    userBalance,
+	})
 }
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/models"
+)
+
+// TestErrorEnvelope checks handlers answer failures with the coded envelope
+// and a status matching the code, not a 200 with free text
+func TestErrorEnvelope(t *testing.T) {
+	const symbol, maker, user = "ERRENVELOPE", "envelope-maker", "envelope-user"
+	if r := call(t, CreateUser, models.CreateUser{UserId: user}, nil); !r.Success {
+		t.Fatalf("create user: %+v", r.Error)
+	}
+	fund(user, 1)
+	if r := call(t, CreateSymbol, models.CreateSymbol{UserId: maker, Stock: symbol}, nil); !r.Success {
+		t.Fatalf("create market: %+v", r.Error)
+	}
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    interface{}
+		params  []gin.Param
+		status  int
+		code    apierr.Code
+	}{
+		{"malformed body", CreateUser, []byte(`{"userId":`), nil, http.StatusBadRequest, apierr.InvalidRequest},
+		{"user exists", CreateUser, models.CreateUser{UserId: user}, nil, http.StatusConflict, apierr.UserExists},
+		{"unknown user balance", GetUserBalance, nil, []gin.Param{{Key: "userId", Value: "envelope-nobody"}}, http.StatusNotFound, apierr.UserNotFound},
+		{"unknown market", PlaceOrder, models.OrderRequest{UserId: user, Symbol: "ERRMISSING", Side: "buy", Outcome: "no", Price: 5, Quantity: 1}, nil, http.StatusNotFound, apierr.MarketNotFound},
+		{"price out of range", PlaceOrder, models.OrderRequest{UserId: user, Symbol: symbol, Side: "buy", Outcome: "no", Price: 10, Quantity: 1}, nil, http.StatusBadRequest, apierr.PriceOutOfRange},
+		{"buy beyond balance", PlaceOrder, models.OrderRequest{UserId: user, Symbol: symbol, Side: "buy", Outcome: "no", Price: 5, Quantity: 10}, nil, http.StatusUnprocessableEntity, apierr.InsufficientBalance},
+		{"sell without shares", PlaceOrder, models.OrderRequest{UserId: user, Symbol: symbol, Side: "sell", Outcome: "no", Price: 5, Quantity: 1}, nil, http.StatusUnprocessableEntity, apierr.InsufficientShares},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := call(t, tt.handler, tt.body, nil, tt.params...)
+			if r.Success || r.status != tt.status || r.code() != tt.code {
+				t.Fatalf("answered %d %+v, want %d %s", r.status, r.Error, tt.status, tt.code)
+			}
+			if r.Message != r.Error.Message {
+				t.Errorf("envelope message %q, error message %q", r.Message, r.Error.Message)
+			}
+		})
+	}
+
+	// The details carry what the client needs to fix the order
+	r := call(t, PlaceOrder, models.OrderRequest{UserId: user, Symbol: symbol, Side: "buy", Outcome: "no", Price: 5, Quantity: 10}, nil)
+	details, _ := r.Error.Details.(map[string]interface{})
+	if details["available"] != float64(1) || details["required"] == nil {
+		t.Errorf("insufficient balance details %v, want the available 1 and the required amount", r.Error.Details)
+	}
+}
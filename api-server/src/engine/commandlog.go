@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/replay"
+)
+
+// command is a command as the engine ran it: the request and what it drew
+// from the clock, the ID generator and outside systems. Running it again with
+// its tape leaves the state it left the first time.
+type command struct {
+	Seq       uint64            `json:"seq"`
+	RequestID string            `json:"requestId,omitempty"`
+	Method    string            `json:"method"`
+	Target    string            `json:"target"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      []byte            `json:"body,omitempty"`
+	Tape      replay.Tape       `json:"tape"`
+}
+
+// commandLog is the append-only file of the commands run since the last
+// snapshot. Appending a line is cheap, the snapshot is written every
+// SnapshotEvery commands and empties the log.
+type commandLog struct {
+	file         *os.File
+	snapshotPath string
+	// seq is the number of the last command run, the snapshot records the
+	// last one it includes
+	seq uint64
+	// since counts the commands appended since the last snapshot
+	since int
+}
+
+var (
+	// commands is the open command log, nil until Open
+	commands *commandLog
+	// replaying is the logged command being run again by Open
+	replaying *command
+)
+
+// append writes a command and syncs it to disk before returning
+func (l *commandLog) append(cmd command) error {
+	cmd.Seq = l.seq + 1
+	line, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.since = cmd.Seq, l.since+1
+	return nil
+}
+
+// checkpoint writes the snapshot and empties the log. A crash between the
+// two leaves commands in the log the snapshot already includes, their numbers
+// tell Open to skip them. The caller must hold the engine lock.
+func (l *commandLog) checkpoint() error {
+	if err := saveSnapshot(l.snapshotPath, l.seq); err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	l.since = 0
+	return l.file.Sync()
+}
+
+// readCommands reads the logged commands. A last line without its newline is
+// an append cut short by a crash; that command was never acknowledged, so it
+// is dropped and the transport delivers it again.
+func readCommands(path string) ([]command, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var logged []command
+	reader := bufio.NewReader(file)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return logged, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var cmd command
+		if err := json.Unmarshal(line, &cmd); err != nil {
+			return nil, fmt.Errorf("line %d of %s: %w", n, path, err)
+		}
+		logged = append(logged, cmd)
+	}
+}
+
+// Open restores the engine state: it reads the snapshot, runs the commands
+// logged after it through router again and starts an empty log. From then on
+// every command is logged before it is acknowledged, until Close.
+func Open(router http.Handler) error {
+	engine := config.Current.Engine
+	window := time.Duration(engine.IdempotencyWindow)
+	idempotencyKeys, processed = newResultStore(window), newResultStore(window)
+
+	seq, restored, err := loadSnapshot(engine.SnapshotPath)
+	if err != nil {
+		return fmt.Errorf("loading snapshot: %w", err)
+	}
+	logged, err := readCommands(engine.CommandLog)
+	if err != nil {
+		return fmt.Errorf("reading command log: %w", err)
+	}
+	file, err := os.OpenFile(engine.CommandLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	log := &commandLog{file: file, snapshotPath: engine.SnapshotPath, seq: seq}
+
+	replayed := 0
+	for _, cmd := range logged {
+		if cmd.Seq <= log.seq {
+			continue
+		}
+		rerun(router, cmd)
+		log.seq = cmd.Seq
+		replayed++
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := log.checkpoint(); err != nil {
+		file.Close()
+		return err
+	}
+	commands = log
+	if restored || replayed > 0 {
+		slog.Info("restored engine state", "snapshot", engine.SnapshotPath, "replayed", replayed)
+	}
+	return nil
+}
+
+// rerun runs a logged command through router with the values it drew the
+// first time
+func rerun(router http.Handler, cmd command) {
+	replaying = &cmd
+	defer func() { replaying = nil }()
+
+	req := httptest.NewRequest(cmd.Method, cmd.Target, bytes.NewReader(cmd.Body))
+	for key, value := range cmd.Headers {
+		req.Header.Set(key, value)
+	}
+	req = req.WithContext(withRequestID(context.Background(), cmd.RequestID))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// Close writes a snapshot and closes the command log
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if commands == nil {
+		return nil
+	}
+	err := commands.checkpoint()
+	err = errors.Join(err, commands.file.Close())
+	commands = nil
+	return err
+}
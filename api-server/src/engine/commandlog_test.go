@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/replay"
+)
+
+// payouts counts the calls the deposit handler makes to an outside system
+var payouts int
+
+// depositRouter serves a command that adds to a balance and draws an ID, the
+// time and an answer from outside the engine
+func depositRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/deposit", Command(func(c *gin.Context) {
+		var body struct {
+			UserId string `json:"userId"`
+			Amount int    `json:"amount"`
+		}
+		c.ShouldBindJSON(&body)
+		balance := models.INR_BALANCES[body.UserId]
+		balance.Balance += body.Amount
+		models.INR_BALANCES[body.UserId] = balance
+		c.JSON(http.StatusCreated, gin.H{
+			"balance": balance.Balance,
+			"ref":     replay.NewID(),
+			"at":      replay.Now(),
+			"payout":  replay.Value(func() int { payouts++; return payouts }),
+		})
+	}))
+	return router
+}
+
+// openEngine opens the engine on an empty directory and closes it when the
+// test ends
+func openEngine(t *testing.T, router http.Handler, every int) {
+	t.Helper()
+	dir := t.TempDir()
+	saved := config.Current
+	config.Current.Engine.CommandLog = filepath.Join(dir, "commands.log")
+	config.Current.Engine.SnapshotPath = filepath.Join(dir, "snapshot.json")
+	config.Current.Engine.SnapshotEvery = every
+	config.Current.Engine.IdempotencyWindow = config.Duration(time.Hour)
+	t.Cleanup(func() {
+		Close()
+		config.Current = saved
+	})
+	reopen(t, router)
+}
+
+func reopen(t *testing.T, router http.Handler) {
+	t.Helper()
+	if err := Open(router); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+}
+
+// crash drops the command log without a snapshot and forgets userId's
+// balance, as if the process was killed
+func crash(userId string) {
+	commands.file.Close()
+	commands = nil
+	delete(models.INR_BALANCES, userId)
+}
+
+// deposit sends a deposit through handle and returns the reply's body
+func deposit(t *testing.T, handle func(models.QueueData) (models.EngineReply, error), id, userId string, amount int) map[string]any {
+	t.Helper()
+	data := models.QueueData{ID: id, Method: http.MethodPost, Endpoint: "/deposit"}
+	data.Req.Body, _ = json.Marshal(map[string]any{"userId": userId, "amount": amount})
+	reply, err := handle(data)
+	if err != nil || reply.StatusCode != http.StatusCreated {
+		t.Fatalf("deposit %s: %+v %v", id, reply, err)
+	}
+	var body map[string]any
+	json.Unmarshal(reply.Data, &body)
+	return body
+}
+
+func logLines(t *testing.T) int {
+	t.Helper()
+	data, err := os.ReadFile(config.Current.Engine.CommandLog)
+	if err != nil {
+		t.Fatalf("read command log: %v", err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+// TestCommandLogReplay crashes after a command is logged: the command runs
+// again with what it drew the first time and does not call out a second time
+func TestCommandLogReplay(t *testing.T) {
+	const userId = "log-replay"
+	router := depositRouter()
+	openEngine(t, router, 100)
+	t.Cleanup(func() { delete(models.INR_BALANCES, userId) })
+	handle := NewHandler(router, nil)
+
+	first := deposit(t, handle, "req-1", userId, 10)
+	deposit(t, handle, "req-2", userId, 5)
+	calls := payouts
+
+	crash(userId)
+	reopen(t, router)
+
+	if balance := models.INR_BALANCES[userId].Balance; balance != 15 {
+		t.Errorf("balance after replay = %d, want 15", balance)
+	}
+	if payouts != calls {
+		t.Errorf("replay called out %d more times", payouts-calls)
+	}
+	if again := deposit(t, handle, "req-1", userId, 10); !reflect.DeepEqual(again, first) {
+		t.Errorf("redelivered reply = %v, want the first %v", again, first)
+	}
+	if lines := logLines(t); lines != 0 {
+		t.Errorf("log has %d commands after opening, want the snapshot to hold them", lines)
+	}
+}
+
+// TestCommandLogSnapshots writes the snapshot every two commands
+func TestCommandLogSnapshots(t *testing.T) {
+	const userId = "log-snapshots"
+	router := depositRouter()
+	openEngine(t, router, 2)
+	t.Cleanup(func() { delete(models.INR_BALANCES, userId) })
+	handle := NewHandler(router, nil)
+
+	for _, step := range []struct {
+		id    string
+		lines int
+	}{{"snap-a", 1}, {"snap-b", 0}, {"snap-c", 1}} {
+		deposit(t, handle, step.id, userId, 1)
+		if lines := logLines(t); lines != step.lines {
+			t.Errorf("after %s the log has %d lines, want %d", step.id, lines, step.lines)
+		}
+	}
+
+	// A crash between the snapshot and emptying the log leaves commands the
+	// snapshot already holds
+	log := config.Current.Engine.CommandLog
+	data, _ := os.ReadFile(log)
+	commands.file.Close()
+	commands = nil
+	var logged []command
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var cmd command
+		json.Unmarshal([]byte(line), &cmd)
+		logged = append(logged, cmd)
+	}
+	mu.Lock()
+	saveSnapshot(config.Current.Engine.SnapshotPath, logged[0].Seq)
+	mu.Unlock()
+	os.WriteFile(log, data, 0o644)
+
+	reopen(t, router)
+	if balance := models.INR_BALANCES[userId].Balance; balance != 3 {
+		t.Errorf("balance = %d, want 3 with no command run twice", balance)
+	}
+	if _, ok := processed.get("snap-a"); !ok {
+		t.Error("reply of a command in the snapshot was lost")
+	}
+}
+
+func TestCommandLogTornLine(t *testing.T) {
+	const userId = "log-torn"
+	router := depositRouter()
+	openEngine(t, router, 100)
+	t.Cleanup(func() { delete(models.INR_BALANCES, userId) })
+	deposit(t, NewHandler(router, nil), "torn-1", userId, 4)
+	crash(userId)
+
+	// An append cut short is dropped, the transport delivers it again
+	file, _ := os.OpenFile(config.Current.Engine.CommandLog, os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"seq":2,"requestId":"torn-2","meth`)
+	file.Close()
+	reopen(t, router)
+	if balance := models.INR_BALANCES[userId].Balance; balance != 4 {
+		t.Errorf("balance = %d, want 4 from the whole line only", balance)
+	}
+	if _, ok := processed.get("torn-2"); ok {
+		t.Error("torn command was stored as processed")
+	}
+
+	// A damaged line with commands after it is not a crash, the engine
+	// refuses to guess
+	Close()
+	os.WriteFile(config.Current.Engine.CommandLog, []byte("{\"seq\":\n{}\n"), 0o644)
+	if err := Open(router); err == nil {
+		t.Error("opened a damaged command log")
+	}
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/replay"
+	"github.com/sahilrush/src/tracing"
+)
+
+// mu serialises every command and query, the state in models is not safe for
+// concurrent use
+var mu sync.Mutex
+
+// lock takes the engine lock, the wait shows up in the request's trace
+func lock(c *gin.Context) {
+	_, span := tracing.Start(c.Request.Context(), "engine lock")
+	mu.Lock()
+	span.End()
+}
+
+// Command wraps a handler that changes state. Requests carrying an
+// Idempotency-Key run once, retries get the original response back. Every
+// SnapshotEvery commands the snapshot is written and the command log emptied.
+func Command(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lock(c)
+		defer mu.Unlock()
+		defer observe("command", c.FullPath(), time.Now())
+
+		idempotent(c, persisted(handler))
+
+		if commands != nil && replaying == nil && commands.since >= config.Current.Engine.SnapshotEvery {
+			// The commands are still in the log, the next one tries again
+			if err := commands.checkpoint(); err != nil {
+				logging.From(c).Error("writing snapshot", "path", commands.snapshotPath, "error", err)
+			}
+		}
+
+		if config.Current.Engine.Debug {
+			checkAndAlert(c.FullPath())
+		}
+	}
+}
+
+// persisted runs a command and appends it to the command log before anything
+// records it as done: its idempotency key, its processed reply and the
+// transport's ack. A failed append leaves memory ahead of the disk, so the
+// engine stops; it starts again from the log and the transport delivers the
+// command again. The reply is kept under the request's ID along with the
+// command, so a redelivery after a restart gets it back rather than running
+// the command twice.
+func persisted(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request payload"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if replaying != nil {
+			replay.Play(replaying.Tape)
+		} else {
+			replay.Record()
+		}
+		rec := &recorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		handler(c)
+		c.Writer = rec.ResponseWriter
+
+		tape, err := replay.Stop()
+		if err != nil {
+			logging.From(c).Error("replayed command took another path", "seq", replaying.Seq, "error", err)
+		}
+
+		id := requestID(c.Request.Context())
+		if commands != nil && replaying == nil {
+			headers := map[string]string{}
+			for key := range c.Request.Header {
+				headers[key] = c.Request.Header.Get(key)
+			}
+			err := commands.append(command{
+				RequestID: id,
+				Method:    c.Request.Method,
+				Target:    c.Request.URL.RequestURI(),
+				Headers:   headers,
+				Body:      body,
+				Tape:      tape,
+			})
+			if err != nil {
+				logging.Fatal("appending to the command log", "path", config.Current.Engine.CommandLog, "error", err)
+			}
+		}
+
+		if id != "" {
+			reply := newReply(rec.Status(), rec.Header(), rec.body.Bytes())
+			reply.ID = id
+			data, _ := json.Marshal(reply)
+			processed.put(storedResult{Key: id, Status: reply.StatusCode, Body: data, StoredAt: time.Now()})
+		}
+	}
+}
+
+// Query wraps a handler that only reads state
+func Query(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lock(c)
+		defer mu.Unlock()
+		defer observe("query", c.FullPath(), time.Now())
+
+		handler(c)
+	}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+)
+
+// IdempotencyHeader lets a client retry a command without it running twice
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyKeys keeps results for the configured window, Open sets it up
+var idempotencyKeys = newResultStore(0)
+
+// fingerprint ties a key to the request it was first used with
+func fingerprint(c *gin.Context, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+	for _, param := range c.Params {
+		sum.Write([]byte(param.Key + "=" + param.Value + "\n"))
+	}
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// scopedKey puts a key under the user the request acts for, found in its path,
+// query or JSON body, so two users picking the same key do not see each
+// other's responses
+func scopedKey(c *gin.Context, key string, body []byte) string {
+	userId := c.Param("userId")
+	if userId == "" {
+		userId = c.Query("userId")
+	}
+	if userId == "" {
+		var payload struct {
+			UserId string `json:"userId"`
+		}
+		if json.Unmarshal(body, &payload) == nil {
+			userId = payload.UserId
+		}
+	}
+	return userId + "/" + key
+}
+
+// recorder keeps a copy of what the handler writes
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// idempotent runs the handler once per key and replays the stored response
+// for retries. The caller must hold the engine lock.
+func idempotent(c *gin.Context, handler gin.HandlerFunc) {
+	key := c.GetHeader(IdempotencyHeader)
+	if key == "" {
+		handler(c)
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request payload"))
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	requestPrint := fingerprint(c, body)
+	key = scopedKey(c, key, body)
+
+	if stored, ok := idempotencyKeys.get(key); ok {
+		if stored.Fingerprint != requestPrint {
+			apierr.Respond(c, apierr.New(apierr.IdempotencyKeyReused, "Idempotency key was already used for a different request"))
+			return
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(stored.Status, "application/json; charset=utf-8", stored.Body)
+		return
+	}
+
+	rec := &recorder{ResponseWriter: c.Writer}
+	c.Writer = rec
+	handler(c)
+	c.Writer = rec.ResponseWriter
+
+	// Server errors are not stored so the client can retry them
+	if rec.Status() >= http.StatusInternalServerError {
+		return
+	}
+	// The command has run by now, so the response stands
+	idempotencyKeys.put(storedResult{
+		Key:         key,
+		Fingerprint: requestPrint,
+		Status:      rec.Status(),
+		Body:        json.RawMessage(rec.body.Bytes()),
+		StoredAt:    time.Now(),
+	})
+}
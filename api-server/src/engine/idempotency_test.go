@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := idempotencyKeys
+	idempotencyKeys = newResultStore(time.Hour)
+	t.Cleanup(func() { idempotencyKeys = saved })
+
+	runs := 0
+	handler := func(c *gin.Context) {
+		runs++
+		status := http.StatusCreated
+		if c.Query("fail") != "" {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"run": runs})
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		key      string
+		body     string
+		params   gin.Params
+		status   int
+		reply    string
+		replayed bool
+		runs     int
+	}{
+		{"no key runs", "/orders", "", `{"userId":"alice"}`, nil, http.StatusCreated, `{"run":1}`, false, 1},
+		{"no key runs again", "/orders", "", `{"userId":"alice"}`, nil, http.StatusCreated, `{"run":2}`, false, 2},
+		{"first use", "/orders", "k1", `{"userId":"alice","quantity":1}`, nil, http.StatusCreated, `{"run":3}`, false, 3},
+		{"retry replays", "/orders", "k1", `{"userId":"alice","quantity":1}`, nil, http.StatusCreated, `{"run":3}`, true, 3},
+		{"other request, same key", "/orders", "k1", `{"userId":"alice","quantity":2}`, nil, http.StatusUnprocessableEntity, "", false, 3},
+		{"other user, same key", "/orders", "k1", `{"userId":"bob","quantity":1}`, nil, http.StatusCreated, `{"run":4}`, false, 4},
+		{"user in the path", "/users", "k1", `{}`, gin.Params{{Key: "userId", Value: "carol"}}, http.StatusCreated, `{"run":5}`, false, 5},
+		{"user in the query", "/orders?userId=dave", "k1", ``, nil, http.StatusCreated, `{"run":6}`, false, 6},
+		{"server errors are not stored", "/orders?fail=1", "k2", `{"userId":"erin"}`, nil, http.StatusInternalServerError, `{"run":7}`, false, 7},
+		{"so they can be retried", "/orders?fail=1", "k2", `{"userId":"erin"}`, nil, http.StatusInternalServerError, `{"run":8}`, false, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.key != "" {
+				c.Request.Header.Set(IdempotencyHeader, tt.key)
+			}
+			c.Params = tt.params
+			idempotent(c, handler)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.status, rec.Body)
+			}
+			if tt.reply != "" && rec.Body.String() != tt.reply {
+				t.Errorf("body = %s, want %s", rec.Body, tt.reply)
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if runs != tt.runs {
+				t.Errorf("handler ran %d times, want %d", runs, tt.runs)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+)
+
+// Violation is a single broken invariant
+type Violation struct {
+	Invariant string `json:"invariant"`
+	Subject   string `json:"subject"`
+	Expected  int    `json:"expected"`
+	Actual    int    `json:"actual"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s broken for %s: expected %d, got %d", v.Invariant, v.Subject, v.Expected, v.Actual)
+}
+
+// Report is the outcome of one run of the checker
+type Report struct {
+	CheckedAt  time.Time   `json:"checkedAt"`
+	Trigger    string      `json:"trigger"`
+	Violations []Violation `json:"violations"`
+}
+
+func (r Report) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// Alerter is told about every report with violations
+type Alerter interface {
+	Alert(report Report)
+}
+
+type logAlerter struct{}
+
+func (logAlerter) Alert(report Report) {
+	for _, v := range report.Violations {
+		slog.Error("invariant violation", "trigger", report.Trigger, "invariant", v.Invariant, "subject", v.Subject, "expected", v.Expected, "actual", v.Actual)
+	}
+}
+
+var (
+	Alerts Alerter = logAlerter{}
+
+	lastReport   Report
+	lastFailures []Report
+)
+
+const maxFailures = 50
+
+// Check verifies the engine state. The caller must hold the engine lock.
+//
+//   - every market has as many YES shares as NO shares
+//   - a user's locked INR equals the notional of their resting buy orders
+//   - locked shares equal the quantity of the user's resting sell orders
+//   - price level totals equal the sum of their orders
+//   - no INR or share balance is negative
+//   - market escrow holds the contract price for every outstanding pair
+//   - stored balances agree with the ledger
+func Check() []Violation {
+	violations := []Violation{}
+	add := func(invariant, subject string, expected, actual int) {
+		if expected != actual {
+			violations = append(violations, Violation{invariant, subject, expected, actual})
+		}
+	}
+
+	lockedInr := map[string]int{}
+	lockedShares := map[string]int{}
+	for symbol, pricing := range models.Orderbooks {
+		for outcome, side := range map[string]map[int]models.OrderType{"yes": pricing.Yes, "no": pricing.No} {
+			for price, level := range side {
+				total := 0
+				for _, order := range level.Orders {
+					userId := order.UserId
+					total += order.Quantity
+					if order.Type == "sell" {
+						lockedShares[symbol+"/"+userId+"/"+outcome] += order.Quantity
+					} else {
+						lockedInr[userId] += (models.ContractPrice - price) * order.Quantity
+					}
+				}
+				add("level_total", fmt.Sprintf("%s/%s@%d", symbol, outcome, price), total, level.Total)
+			}
+		}
+	}
+
+	for symbol, users := range models.Stock_Balances {
+		yes, no := 0, 0
+		for userId, holdings := range users {
+			for outcome, held := range holdings {
+				subject := symbol + "/" + userId + "/" + outcome
+				if held.Quantity < 0 {
+					add("non_negative_shares", subject, 0, held.Quantity)
+				}
+				if held.Locked < 0 {
+					add("non_negative_locked_shares", subject, 0, held.Locked)
+				}
+				add("locked_shares", subject, lockedShares[subject], held.Locked)
+				delete(lockedShares, subject)
+
+				switch outcome {
+				case "yes":
+					yes += held.Quantity + held.Locked
+				case "no":
+					no += held.Quantity + held.Locked
+				}
+			}
+		}
+		add("yes_equals_no", symbol, yes, no)
+		add("escrow", symbol, yes*models.ContractPrice, ledger.Balance(ledger.Escrow(symbol)))
+	}
+	for subject, quantity := range lockedShares {
+		add("locked_shares", subject, quantity, 0)
+	}
+
+	for userId, user := range models.INR_BALANCES {
+		if user.Balance < 0 {
+			add("non_negative_balance", userId, 0, user.Balance)
+		}
+		if user.Locked < 0 {
+			add("non_negative_locked", userId, 0, user.Locked)
+		}
+		if user.PendingWithdrawal < 0 {
+			add("non_negative_pending", userId, 0, user.PendingWithdrawal)
+		}
+		add("locked_inr", userId, lockedInr[userId], user.Locked)
+		delete(lockedInr, userId)
+	}
+	for userId, amount := range lockedInr {
+		add("locked_inr", userId, amount, 0)
+	}
+
+	for _, m := range ledger.Verify() {
+		add("ledger", m.Account, m.Journal, m.Stored)
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Invariant != violations[j].Invariant {
+			return violations[i].Invariant < violations[j].Invariant
+		}
+		return violations[i].Subject < violations[j].Subject
+	})
+	return violations
+}
+
+// checkAndAlert runs the checker, keeps the report and alerts on violations.
+// The caller must hold the engine lock.
+func checkAndAlert(trigger string) Report {
+	report := Report{
+		CheckedAt:  time.Now(),
+		Trigger:    trigger,
+		Violations: Check(),
+	}
+	lastReport = report
+
+	if !report.OK() {
+		lastFailures = append(lastFailures, report)
+		if len(lastFailures) > maxFailures {
+			lastFailures = lastFailures[len(lastFailures)-maxFailures:]
+		}
+		Alerts.Alert(report)
+	}
+	return report
+}
+
+// RunChecks runs the checker now under the engine lock
+func RunChecks(trigger string) Report {
+	mu.Lock()
+	defer mu.Unlock()
+	return checkAndAlert(trigger)
+}
+
+// Reports returns the latest report and the most recent reports that failed
+func Reports() (Report, []Report) {
+	mu.Lock()
+	defer mu.Unlock()
+	return lastReport, append([]Report{}, lastFailures...)
+}
+
+// StartChecker runs the checker every interval until the context is done
+func StartChecker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				RunChecks("periodic")
+			}
+		}
+	}()
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+)
+
+// market sets up a consistent market: alice holds 10 YES and offers 5 of
+// them at 6, bob holds 10 NO and bids 4 for 3 YES, resting on NO at 6
+func market(t *testing.T) {
+	clearState := func() {
+		clear(models.Orderbooks)
+		clear(models.Stock_Balances)
+		clear(models.INR_BALANCES)
+		models.PlatformRevenue = models.FeeTotals{}
+		ledger.Restore([]ledger.Entry{})
+	}
+	clearState()
+	t.Cleanup(clearState)
+
+	models.Orderbooks["BTC"] = models.Pricing{
+		Yes: map[int]models.OrderType{6: {Total: 5, Orders: []models.Orders{
+			{OrderId: "ask", UserId: "alice", Quantity: 5, Type: "sell"},
+		}}},
+		No: map[int]models.OrderType{6: {Total: 3, Orders: []models.Orders{
+			{OrderId: "bid", UserId: "bob", Quantity: 3, Type: "inverse"},
+		}}},
+	}
+	models.Stock_Balances["BTC"] = models.User{
+		"alice": {"yes": {Quantity: 5, Locked: 5}},
+		"bob":   {"no": {Quantity: 10}},
+	}
+	ledger.Transfer(ledger.KindMint, "BTC", ledger.External, ledger.Escrow("BTC"), 100)
+
+	models.INR_BALANCES["alice"] = models.UserBalance{Balance: 50}
+	ledger.Transfer(ledger.KindGrant, "alice", ledger.External, ledger.Available("alice"), 50)
+	models.INR_BALANCES["bob"] = models.UserBalance{Balance: 88, Locked: 12}
+	ledger.Transfer(ledger.KindGrant, "bob", ledger.External, ledger.Available("bob"), 100)
+	ledger.Transfer(ledger.KindLock, "BTC", ledger.Available("bob"), ledger.Locked("bob"), 12)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func()
+		want    []string
+	}{
+		{"consistent", func() {}, nil},
+		{"level total", func() {
+			level := models.Orderbooks["BTC"].Yes[6]
+			level.Total = 6
+			models.Orderbooks["BTC"].Yes[6] = level
+		}, []string{"level_total BTC/yes@6"}},
+		{"share lock without an order", func() {
+			models.Stock_Balances["BTC"]["alice"]["yes"] = models.OutCome{Quantity: 4, Locked: 6}
+		}, []string{"locked_shares BTC/alice/yes"}},
+		{"INR lock without an order", func() {
+			models.INR_BALANCES["bob"] = models.UserBalance{Balance: 87, Locked: 13}
+			ledger.Transfer(ledger.KindLock, "BTC", ledger.Available("bob"), ledger.Locked("bob"), 1)
+		}, []string{"locked_inr bob"}},
+		{"order of a user without a balance", func() {
+			pricing := models.Orderbooks["BTC"]
+			pricing.No[6] = models.OrderType{Total: 4, Orders: append(pricing.No[6].Orders, models.Orders{OrderId: "ghost", UserId: "carol", Quantity: 1, Type: "inverse"})}
+		}, []string{"locked_inr carol"}},
+		{"negative balance", func() {
+			models.INR_BALANCES["alice"] = models.UserBalance{Balance: -5}
+			ledger.Transfer(ledger.KindFee, "BTC", ledger.Available("alice"), ledger.PlatformFees, 55)
+			models.PlatformRevenue.Total = 55
+		}, []string{"non_negative_balance alice"}},
+		{"shares without a pair", func() {
+			models.Stock_Balances["BTC"]["bob"]["no"] = models.OutCome{Quantity: 11}
+		}, []string{"yes_equals_no BTC"}},
+		{"escrow short", func() {
+			ledger.Transfer(ledger.KindSettlement, "BTC", ledger.Escrow("BTC"), ledger.External, 10)
+		}, []string{"escrow BTC"}},
+		{"balance without a journal entry", func() {
+			models.INR_BALANCES["alice"] = models.UserBalance{Balance: 60}
+		}, []string{"ledger user:alice:available"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			market(t)
+			tt.corrupt()
+
+			var got []string
+			for _, v := range Check() {
+				got = append(got, v.Invariant+" "+v.Subject)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type recordingAlerter struct {
+	reports []Report
+}
+
+func (a *recordingAlerter) Alert(report Report) {
+	a.reports = append(a.reports, report)
+}
+
+func TestCheckAndAlert(t *testing.T) {
+	market(t)
+	alerts := &recordingAlerter{}
+	saved := Alerts
+	Alerts = alerts
+	t.Cleanup(func() {
+		Alerts = saved
+		lastReport, lastFailures = Report{}, nil
+	})
+
+	if report := checkAndAlert("test"); !report.OK() || len(alerts.reports) != 0 {
+		t.Fatalf("consistent state: report %+v, %d alerts", report, len(alerts.reports))
+	}
+
+	models.INR_BALANCES["alice"] = models.UserBalance{Balance: 60}
+	for i := 0; i < maxFailures+5; i++ {
+		checkAndAlert("test")
+	}
+	latest, failures := Reports()
+	if latest.OK() || latest.Trigger != "test" {
+		t.Errorf("latest report = %+v, want the failing one", latest)
+	}
+	if len(alerts.reports) != maxFailures+5 {
+		t.Errorf("%d alerts, want one per failing run", len(alerts.reports))
+	}
+	if len(failures) != maxFailures {
+		t.Errorf("%d failures kept, want the last %d", len(failures), maxFailures)
+	}
+}
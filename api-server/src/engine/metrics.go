@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sahilrush/src/metrics"
+	"github.com/sahilrush/src/models"
+)
+
+var commandDuration = metrics.NewHistogramVec("opnify_engine_command_duration_seconds",
+	"Time the engine spends running a command or query, lock wait excluded.", metrics.DefBuckets, "kind", "route")
+
+// observe records how long a handler ran since start
+func observe(kind, route string, start time.Time) {
+	commandDuration.With(kind, route).Observe(time.Since(start).Seconds())
+}
+
+var registerState sync.Once
+
+// RegisterMetrics exposes gauges computed from the engine state. Only the
+// process running the engine registers them, elsewhere the state is empty.
+func RegisterMetrics() {
+	registerState.Do(func() {
+		metrics.NewGaugeFunc("opnify_open_interest_contracts",
+			"Outstanding YES/NO pairs per market.", []string{"market"}, openInterest)
+		metrics.NewGaugeFunc("opnify_inr_locked",
+			"INR locked behind resting buy orders, over all users.", nil, lockedINR)
+		metrics.NewGaugeFunc("opnify_resting_orders",
+			"Orders resting on the book per market.", []string{"market"}, restingOrders)
+	})
+}
+
+// openInterest counts the YES shares held per market, each one is half of a
+// pair backed in escrow until the market resolves
+func openInterest() []metrics.Sample {
+	mu.Lock()
+	defer mu.Unlock()
+
+	samples := []metrics.Sample{}
+	for symbol, holders := range models.Stock_Balances {
+		if _, resolved := models.ResolvedMarkets[symbol]; resolved {
+			continue
+		}
+		total := 0
+		for _, outcomes := range holders {
+			yes := outcomes["yes"]
+			total += yes.Quantity + yes.Locked
+		}
+		samples = append(samples, metrics.Sample{Labels: []string{symbol}, Value: float64(total)})
+	}
+	return samples
+}
+
+func lockedINR() []metrics.Sample {
+	mu.Lock()
+	defer mu.Unlock()
+
+	total := 0
+	for _, user := range models.INR_BALANCES {
+		total += user.Locked
+	}
+	return []metrics.Sample{{Value: float64(total)}}
+}
+
+func restingOrders() []metrics.Sample {
+	mu.Lock()
+	defer mu.Unlock()
+
+	samples := []metrics.Sample{}
+	for symbol, pricing := range models.Orderbooks {
+		count := 0
+		for _, side := range []map[int]models.OrderType{pricing.Yes, pricing.No} {
+			for _, level := range side {
+				count += len(level.Orders)
+			}
+		}
+		samples = append(samples, metrics.Sample{Labels: []string{symbol}, Value: float64(count)})
+	}
+	return samples
+}
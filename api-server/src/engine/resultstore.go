@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// storedResult is the response a request produced the first time it was seen
+type storedResult struct {
+	Key         string          `json:"key"`
+	Fingerprint string          `json:"fingerprint,omitempty"`
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body"`
+	StoredAt    time.Time       `json:"storedAt"`
+}
+
+// minSweep is how many results a store holds before put first drops the
+// expired ones
+const minSweep = 1024
+
+// resultStore keeps results by key for a window. It lives in memory and goes
+// into the snapshot; the command log brings back the results of the commands
+// run since.
+type resultStore struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]storedResult
+	// sweepAt is the size at which put drops the expired results next
+	sweepAt int
+}
+
+func newResultStore(window time.Duration) *resultStore {
+	return &resultStore{window: window, entries: map[string]storedResult{}, sweepAt: minSweep}
+}
+
+func (s *resultStore) expired(result storedResult, now time.Time) bool {
+	return now.Sub(result.StoredAt) > s.window
+}
+
+func (s *resultStore) get(key string) (storedResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.entries[key]
+	if !ok || s.expired(result, time.Now()) {
+		return storedResult{}, false
+	}
+	return result, true
+}
+
+func (s *resultStore) put(result storedResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[result.Key] = result
+	if len(s.entries) >= s.sweepAt {
+		s.sweep(time.Now())
+	}
+}
+
+// sweep drops the expired results. The next sweep waits until the store has
+// doubled in size, so sweeping costs put a constant amount on average.
+func (s *resultStore) sweep(now time.Time) {
+	for key, result := range s.entries {
+		if s.expired(result, now) {
+			delete(s.entries, key)
+		}
+	}
+	s.sweepAt = max(2*len(s.entries), minSweep)
+}
+
+// all returns the results that have not expired, ordered by key, for the
+// snapshot
+func (s *resultStore) all() []storedResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	results := []storedResult{}
+	for _, result := range s.entries {
+		if !s.expired(result, now) {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results
+}
+
+// restore replaces the results with those read from a snapshot
+func (s *resultStore) restore(results []storedResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	clear(s.entries)
+	for _, result := range results {
+		if !s.expired(result, now) {
+			s.entries[result.Key] = result
+		}
+	}
+	s.sweepAt = max(2*len(s.entries), minSweep)
+}
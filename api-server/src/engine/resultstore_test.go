@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func result(key string, age time.Duration) storedResult {
+	return storedResult{Key: key, Status: 200, Body: json.RawMessage(`{"key":"` + key + `"}`), StoredAt: time.Now().Add(-age)}
+}
+
+func TestResultStore(t *testing.T) {
+	store := newResultStore(time.Hour)
+	for _, r := range []storedResult{result("fresh", 0), result("old", 2*time.Hour), result("edge", 59*time.Minute)} {
+		store.put(r)
+	}
+
+	tests := []struct {
+		key   string
+		found bool
+	}{
+		{"fresh", true},
+		{"edge", true},
+		{"old", false},
+		{"missing", false},
+	}
+	check := func(store *resultStore) {
+		t.Helper()
+		for _, tt := range tests {
+			stored, ok := store.get(tt.key)
+			if ok != tt.found {
+				t.Errorf("get(%s) found = %v, want %v", tt.key, ok, tt.found)
+			}
+			if ok && string(stored.Body) != `{"key":"`+tt.key+`"}` {
+				t.Errorf("get(%s) body = %s", tt.key, stored.Body)
+			}
+		}
+	}
+	check(store)
+
+	// What goes into the snapshot leaves the expired results out and comes
+	// back the same
+	all := store.all()
+	if len(all) != 2 || all[0].Key != "edge" || all[1].Key != "fresh" {
+		t.Fatalf("all = %+v, want edge and fresh", all)
+	}
+	data, _ := json.Marshal(all)
+	var read []storedResult
+	json.Unmarshal(data, &read)
+
+	restored := newResultStore(time.Hour)
+	restored.put(result("stale", 0))
+	restored.restore(read)
+	check(restored)
+	if _, ok := restored.get("stale"); ok {
+		t.Error("restore kept a result that was not in the snapshot")
+	}
+}
+
+// TestResultStoreEviction fills a store with results nobody asks for again:
+// the expired ones have to go as new ones are put, not stay until a snapshot
+func TestResultStoreEviction(t *testing.T) {
+	store := newResultStore(time.Hour)
+	for i := range minSweep - 1 {
+		store.put(result("old-"+strconv.Itoa(i), 2*time.Hour))
+	}
+	if len(store.entries) != minSweep-1 {
+		t.Fatalf("%d results before the first sweep, want %d", len(store.entries), minSweep-1)
+	}
+	store.put(result("fresh-0", 0))
+	if len(store.entries) != 1 || store.sweepAt != minSweep {
+		t.Fatalf("after the sweep: %d results, next sweep at %d, want 1 and %d", len(store.entries), store.sweepAt, minSweep)
+	}
+
+	// Results still in their window are kept, and the next sweep waits for
+	// twice as many
+	for i := 1; i < minSweep; i++ {
+		store.put(result("fresh-"+strconv.Itoa(i), 0))
+	}
+	if len(store.entries) != minSweep || store.sweepAt != 2*minSweep {
+		t.Errorf("%d fresh results, next sweep at %d, want %d and %d", len(store.entries), store.sweepAt, minSweep, 2*minSweep)
+	}
+	if _, ok := store.get("fresh-0"); !ok {
+		t.Error("a fresh result was swept")
+	}
+}
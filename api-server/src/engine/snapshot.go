@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tickers"
+)
+
+// snapshot is the engine state after the command numbered Seq, written every
+// SnapshotEvery commands and on shutdown and read back on start. It holds the
+// stored replies too, so the state and the record of what produced it are
+// written in one go.
+type snapshot struct {
+	TakenAt time.Time `json:"takenAt"`
+	Seq     uint64    `json:"seq"`
+
+	Balances          map[string]models.UserBalance                 `json:"balances"`
+	Orderbooks        models.Orderbook                              `json:"orderbooks"`
+	StockBalances     models.Stock                                  `json:"stockBalances"`
+	Trades            []models.Trade                                `json:"trades"`
+	Orders            map[string]models.Order                       `json:"orders"`
+	UserOrders        map[string][]string                           `json:"userOrders"`
+	LastTradedPrice   map[string]map[string]int                     `json:"lastTradedPrice"`
+	ResolvedMarkets   map[string]string                             `json:"resolvedMarkets"`
+	CostBasis         map[string]map[string]map[string]models.Basis `json:"costBasis"`
+	FeesPaid          map[string]map[string]int                     `json:"feesPaid"`
+	Makers            map[string]amm.Maker                          `json:"makers"`
+	Withdrawals       map[string]models.Withdrawal                  `json:"withdrawals"`
+	DepositIntents    map[string]models.DepositIntent               `json:"depositIntents"`
+	ProcessedWebhooks map[string]bool                               `json:"processedWebhooks"`
+	PlatformRevenue   models.FeeTotals                              `json:"platformRevenue"`
+	MarketRevenue     map[string]models.FeeTotals                   `json:"marketRevenue"`
+	DefaultSchedule   fees.Schedule                                 `json:"defaultSchedule"`
+	MarketSchedules   map[string]fees.Schedule                      `json:"marketSchedules"`
+	TierSchedules     map[string]fees.Schedule                      `json:"tierSchedules"`
+	UserTiers         map[string]string                             `json:"userTiers"`
+	Journal           []ledger.Entry                                `json:"journal"`
+	Processed         []storedResult                                `json:"processed"`
+	IdempotencyKeys   []storedResult                                `json:"idempotencyKeys"`
+}
+
+// saveSnapshot writes the engine state after the command numbered seq to path.
+// The file is replaced atomically so a crash mid-write leaves the previous
+// snapshot in place. The caller must hold the engine lock.
+func saveSnapshot(path string, seq uint64) error {
+	data, err := json.Marshal(snapshot{
+		TakenAt:           time.Now(),
+		Seq:               seq,
+		Balances:          models.INR_BALANCES,
+		Orderbooks:        models.Orderbooks,
+		StockBalances:     models.Stock_Balances,
+		Trades:            models.Trades,
+		Orders:            models.PlacedOrders,
+		UserOrders:        models.UserOrders,
+		LastTradedPrice:   models.LastTradedPrice,
+		ResolvedMarkets:   models.ResolvedMarkets,
+		CostBasis:         models.CostBasis,
+		FeesPaid:          models.FeesPaid,
+		Makers:            amm.Makers,
+		Withdrawals:       models.Withdrawals,
+		DepositIntents:    models.DepositIntents,
+		ProcessedWebhooks: models.ProcessedWebhooks,
+		PlatformRevenue:   models.PlatformRevenue,
+		MarketRevenue:     models.MarketRevenue,
+		DefaultSchedule:   fees.DefaultSchedule,
+		MarketSchedules:   fees.MarketSchedules,
+		TierSchedules:     fees.TierSchedules,
+		UserTiers:         fees.UserTiers,
+		Journal:           ledger.Journal,
+		Processed:         processed.all(),
+		IdempotencyKeys:   idempotencyKeys.all(),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadSnapshot restores the engine state from path and returns the number of
+// the last command it includes, a missing file means a fresh start. Maps are
+// refilled in place because other packages hold them. Candles and tickers are
+// not stored, they are built again from the state.
+func loadSnapshot(path string) (uint64, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return 0, false, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	refill(models.INR_BALANCES, s.Balances)
+	refill(models.Orderbooks, s.Orderbooks)
+	refill(models.Stock_Balances, s.StockBalances)
+	refill(models.PlacedOrders, s.Orders)
+	refill(models.UserOrders, s.UserOrders)
+	refill(models.LastTradedPrice, s.LastTradedPrice)
+	refill(models.ResolvedMarkets, s.ResolvedMarkets)
+	refill(models.CostBasis, s.CostBasis)
+	refill(models.FeesPaid, s.FeesPaid)
+	refill(amm.Makers, s.Makers)
+	refill(models.Withdrawals, s.Withdrawals)
+	refill(models.DepositIntents, s.DepositIntents)
+	refill(models.ProcessedWebhooks, s.ProcessedWebhooks)
+	refill(models.MarketRevenue, s.MarketRevenue)
+	refill(fees.MarketSchedules, s.MarketSchedules)
+	refill(fees.TierSchedules, s.TierSchedules)
+	refill(fees.UserTiers, s.UserTiers)
+
+	models.Trades = append([]models.Trade{}, s.Trades...)
+	candles.Rebuild(models.Trades)
+	tickers.Rebuild(models.Trades, models.Orderbooks, models.Stock_Balances, models.ResolvedMarkets)
+	models.PlatformRevenue = s.PlatformRevenue
+	fees.DefaultSchedule = s.DefaultSchedule
+	ledger.Restore(append([]ledger.Entry{}, s.Journal...))
+	processed.restore(s.Processed)
+	idempotencyKeys.restore(s.IdempotencyKeys)
+	return s.Seq, true, nil
+}
+
+// refill replaces the contents of dst with those of src
+func refill[M ~map[K]V, K comparable, V any](dst, src M) {
+	clear(dst)
+	for key, value := range src {
+		dst[key] = value
+	}
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Process runs a forwarded request through the engine's router and captures
+// the reply. Handlers see ctx, and with it the span of the command.
+func Process(ctx context.Context, handler http.Handler, data models.QueueData) models.EngineReply {
+	target := endpointPath(data.Endpoint, data.Req.Params)
+	if data.Req.Query != "" {
+		target += "?" + data.Req.Query
+	}
+
+	var body []byte
+	if len(data.Req.Body) > 0 && string(data.Req.Body) != "null" {
+		body = data.Req.Body
+	}
+
+	req, err := http.NewRequestWithContext(withRequestID(ctx, data.ID), data.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return errorReply(apierr.New(apierr.InvalidRequest, "Invalid forwarded request"))
+	}
+	for key, value := range data.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Handlers log with the ID the API server gave the request
+	logger := slog.Default().With(logging.RequestID, data.ID, logging.Route, data.Endpoint)
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		logger = logger.With(logging.TraceID, span.SpanContext().TraceID().String())
+	}
+	req = req.WithContext(logging.WithLogger(req.Context(), logger))
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	logger.Debug("processed", "method", data.Method, "status", rec.Code, "duration", time.Since(start))
+
+	return newReply(rec.Code, rec.Header(), rec.Body.Bytes())
+}
+
+// newReply builds the reply sent back for a response
+func newReply(status int, header http.Header, body []byte) models.EngineReply {
+	reply := models.EngineReply{
+		StatusCode: status,
+		Headers:    map[string]string{},
+		Data:       append(json.RawMessage{}, body...),
+	}
+	for key := range header {
+		if key != "Content-Type" && key != "Content-Length" {
+			reply.Headers[key] = header.Get(key)
+		}
+	}
+	if len(reply.Data) == 0 {
+		reply.Data = json.RawMessage("null")
+	}
+	return reply
+}
+
+type requestIDKey struct{}
+
+// withRequestID tells the handlers which forwarded request they are running
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID is the ID of the forwarded request ctx belongs to, empty for
+// requests that did not come through the transport
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// endpointPath fills the :params of a route pattern back in
+func endpointPath(endpoint string, params map[string]string) string {
+	segments := strings.Split(endpoint, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = url.PathEscape(params[segment[1:]])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func errorReply(err error) models.EngineReply {
+	status, data := apierr.Body(err)
+	return models.EngineReply{StatusCode: status, Data: data}
+}
+
+// processed keeps the replies of processed requests for the idempotency
+// window, Open sets it up
+var processed = newResultStore(0)
+
+// NewHandler returns the transport handler that runs forwarded requests
+// through router. A request seen before, recognised by QueueData.ID, only gets
+// its stored reply again. Commands store their reply once they are in the
+// command log, so one acknowledged or not is never run twice; a query's is
+// stored here. Trades filled by a request are published on the "trades" topic.
+func NewHandler(router http.Handler, publish func(topic string, payload []byte)) func(models.QueueData) (models.EngineReply, error) {
+	return func(data models.QueueData) (models.EngineReply, error) {
+		ctx := tracing.Extract(context.Background(), data.Trace)
+
+		// Time spent between the API server queueing the request and now
+		if !data.SentAt.IsZero() {
+			_, wait := tracing.Start(ctx, "queue wait", trace.WithTimestamp(data.SentAt))
+			wait.End()
+		}
+
+		ctx, span := tracing.Start(ctx, "engine "+data.Method+" "+data.Endpoint,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String(logging.RequestID, data.ID)),
+		)
+		defer span.End()
+
+		var reply models.EngineReply
+		if stored, ok := processed.get(data.ID); ok {
+			span.SetAttributes(attribute.Bool("engine.replayed", true))
+			err := json.Unmarshal(stored.Body, &reply)
+			return reply, err
+		}
+
+		mu.Lock()
+		before := len(models.Trades)
+		mu.Unlock()
+
+		reply = Process(ctx, router, data)
+		reply.ID = data.ID
+		span.SetAttributes(attribute.Int("engine.status_code", reply.StatusCode))
+
+		if _, ok := processed.get(data.ID); !ok {
+			body, _ := json.Marshal(reply)
+			processed.put(storedResult{Key: data.ID, Status: reply.StatusCode, Body: body, StoredAt: time.Now()})
+		}
+
+		if publish != nil {
+			mu.Lock()
+			var fills []models.Trade
+			if len(models.Trades) > before {
+				fills = append(fills, models.Trades[before:]...)
+			}
+			mu.Unlock()
+
+			for _, trade := range fills {
+				payload, _ := json.Marshal(trade)
+				publish("trades", payload)
+			}
+		}
+		return reply, nil
+	}
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/models"
+)
+
+// TestHandlerReplaysRedelivery delivers a command twice, as a transport does
+// when the engine dies before acknowledging it, and again after a restart
+func TestHandlerReplaysRedelivery(t *testing.T) {
+	runs := 0
+	router := gin.New()
+	router.POST("/count", Command(func(c *gin.Context) {
+		runs++
+		c.JSON(http.StatusCreated, gin.H{"run": runs})
+	}))
+	openEngine(t, router, 100)
+	handle := NewHandler(router, nil)
+
+	request := models.QueueData{ID: "req-1", Method: http.MethodPost, Endpoint: "/count"}
+	deliver := func() {
+		t.Helper()
+		reply, err := handle(request)
+		if err != nil {
+			t.Fatalf("handle: %v", err)
+		}
+		if reply.ID != "req-1" || reply.StatusCode != http.StatusCreated || string(reply.Data) != `{"run":1}` {
+			t.Fatalf("reply = %+v (%s), want the first run's", reply, reply.Data)
+		}
+	}
+
+	deliver()
+	deliver()
+	if err := Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	reopen(t, router)
+	deliver()
+
+	if runs != 1 {
+		t.Errorf("command ran %d times, want once", runs)
+	}
+}
@@ -0,0 +1,140 @@
+package fees
+
+import "fmt"
+
+// Basis decides what amount a fee rate is applied to
+type Basis string
+
+const (
+	Flat     Basis = "flat"
+	Notional Basis = "notional"
+	Winnings Basis = "winnings"
+)
+
+// Kind is the role a user had when the fee was charged
+type Kind string
+
+const (
+	Maker      Kind = "maker"
+	Taker      Kind = "taker"
+	Settlement Kind = "settlement"
+)
+
+// Rate is a single fee, Amount is in INR for flat fees and basis points otherwise
+type Rate struct {
+	Basis  Basis `json:"basis"`
+	Amount int   `json:"amount"`
+}
+
+// Schedule holds the rates charged at fill and at settlement
+type Schedule struct {
+	Maker      Rate `json:"maker"`
+	Taker      Rate `json:"taker"`
+	Settlement Rate `json:"settlement"`
+}
+
+var DefaultSchedule = Schedule{
+	Maker:      Rate{Basis: Notional, Amount: 0},
+	Taker:      Rate{Basis: Notional, Amount: 100},
+	Settlement: Rate{Basis: Winnings, Amount: 200},
+}
+
+var (
+	// MarketSchedules overrides the default schedule for a symbol
+	MarketSchedules = map[string]Schedule{}
+	// TierSchedules overrides the market schedule for users in a tier
+	TierSchedules = map[string]Schedule{}
+	// UserTiers maps a user to their fee tier
+	UserTiers = map[string]string{}
+)
+
+// Validate checks that a rate uses a known basis and a sane amount
+func (r Rate) Validate() error {
+	switch r.Basis {
+	case Flat, Notional, Winnings:
+	default:
+		return fmt.Errorf("unknown fee basis %q", r.Basis)
+	}
+	if r.Amount < 0 {
+		return fmt.Errorf("fee amount must not be negative")
+	}
+	if r.Basis != Flat && r.Amount > 10000 {
+		return fmt.Errorf("fee rate must not exceed 10000 basis points")
+	}
+	return nil
+}
+
+func (s Schedule) Validate() error {
+	for _, r := range []Rate{s.Maker, s.Taker, s.Settlement} {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleFor picks the tier schedule first, then the market one, then the default
+func ScheduleFor(symbol, userId string) Schedule {
+	if tier, ok := UserTiers[userId]; ok {
+		if s, ok := TierSchedules[tier]; ok {
+			return s
+		}
+	}
+	if s, ok := MarketSchedules[symbol]; ok {
+		return s
+	}
+	return DefaultSchedule
+}
+
+// Compute returns the fee owed on notional (fills) or winnings (settlement).
+// Rates in basis points round up to the next INR, so small fills still pay.
+func Compute(symbol, userId string, kind Kind, notional, winnings int) int {
+	rate := rateFor(symbol, userId, kind)
+	switch rate.Basis {
+	case Flat:
+		return rate.Amount
+	case Notional:
+		return basisPoints(notional, rate.Amount)
+	case Winnings:
+		return basisPoints(winnings, rate.Amount)
+	}
+	return 0
+}
+
+// Fill returns the fee on a fill of notional by an order that already filled
+// before. The rate rounds over the order as a whole, so many small fills pay
+// what one fill of them all would, and a flat fee is charged once per order.
+func Fill(symbol, userId string, kind Kind, before, notional int) int {
+	if notional <= 0 {
+		return 0
+	}
+	if rateFor(symbol, userId, kind).Basis == Flat {
+		if before > 0 {
+			return 0
+		}
+		return Compute(symbol, userId, kind, notional, 0)
+	}
+	return Compute(symbol, userId, kind, before+notional, 0) - Compute(symbol, userId, kind, before, 0)
+}
+
+// rateFor picks the rate of kind from the user's schedule
+func rateFor(symbol, userId string, kind Kind) Rate {
+	schedule := ScheduleFor(symbol, userId)
+	switch kind {
+	case Maker:
+		return schedule.Maker
+	case Taker:
+		return schedule.Taker
+	case Settlement:
+		return schedule.Settlement
+	}
+	return Rate{}
+}
+
+// basisPoints returns rate basis points of amount, rounded up
+func basisPoints(amount, rate int) int {
+	if amount <= 0 {
+		return 0
+	}
+	return (amount*rate + 9999) / 10000
+}
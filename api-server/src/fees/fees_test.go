@@ -0,0 +1,151 @@
+package fees_test
+
+import (
+	"testing"
+
+	"github.com/sahilrush/src/fees"
+)
+
+func TestCompute(t *testing.T) {
+	fees.MarketSchedules["FLAT"] = fees.Schedule{
+		Maker:      fees.Rate{Basis: fees.Flat, Amount: 2},
+		Taker:      fees.Rate{Basis: fees.Flat, Amount: 3},
+		Settlement: fees.Rate{Basis: fees.Flat, Amount: 4},
+	}
+	defer delete(fees.MarketSchedules, "FLAT")
+
+	tests := []struct {
+		name     string
+		symbol   string
+		kind     fees.Kind
+		notional int
+		winnings int
+		want     int
+	}{
+		{"taker exact", "BTC", fees.Taker, 10000, 0, 100},
+		{"taker rounds up", "BTC", fees.Taker, 10001, 0, 101},
+		{"taker notional under 100", "BTC", fees.Taker, 99, 0, 1},
+		{"taker smallest fill", "BTC", fees.Taker, 1, 0, 1},
+		{"taker nothing traded", "BTC", fees.Taker, 0, 0, 0},
+		{"maker free", "BTC", fees.Maker, 5000, 0, 0},
+		{"settlement on winnings", "BTC", fees.Settlement, 0, 1000, 20},
+		{"settlement small winnings", "BTC", fees.Settlement, 0, 10, 1},
+		{"settlement no winnings", "BTC", fees.Settlement, 0, 0, 0},
+		{"settlement losses", "BTC", fees.Settlement, 0, -50, 0},
+		{"flat ignores notional", "FLAT", fees.Taker, 1, 0, 3},
+		{"flat maker", "FLAT", fees.Maker, 0, 0, 2},
+		{"flat settlement", "FLAT", fees.Settlement, 0, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fees.Compute(tt.symbol, "alice", tt.kind, tt.notional, tt.winnings); got != tt.want {
+				t.Errorf("Compute = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFill splits orders into fills and checks they pay what the whole order
+// would: 1% of 250 rounds up to 3 however the 250 is filled
+func TestFill(t *testing.T) {
+	fees.MarketSchedules["FLAT"] = fees.Schedule{Taker: fees.Rate{Basis: fees.Flat, Amount: 3}}
+	defer delete(fees.MarketSchedules, "FLAT")
+
+	tests := []struct {
+		name   string
+		symbol string
+		kind   fees.Kind
+		fills  []int
+		want   []int
+	}{
+		{"one fill", "BTC", fees.Taker, []int{250}, []int{3}},
+		{"small fills", "BTC", fees.Taker, []int{50, 50, 50, 50, 50}, []int{1, 0, 1, 0, 1}},
+		{"fills of one", "BTC", fees.Taker, []int{1, 1, 1}, []int{1, 0, 0}},
+		{"free maker", "BTC", fees.Maker, []int{100, 100}, []int{0, 0}},
+		{"flat once per order", "FLAT", fees.Taker, []int{10, 20, 30}, []int{3, 0, 0}},
+		{"nothing filled", "BTC", fees.Taker, []int{0}, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, total := 0, 0
+			for i, notional := range tt.fills {
+				fee := fees.Fill(tt.symbol, "alice", tt.kind, before, notional)
+				if fee != tt.want[i] {
+					t.Errorf("fill %d of %d after %d: fee %d, want %d", i+1, notional, before, fee, tt.want[i])
+				}
+				before, total = before+notional, total+fee
+			}
+			if whole := fees.Fill(tt.symbol, "alice", tt.kind, 0, before); total != whole {
+				t.Errorf("fills paid %d, the whole order %d", total, whole)
+			}
+		})
+	}
+}
+
+func TestScheduleFor(t *testing.T) {
+	market := fees.Schedule{Taker: fees.Rate{Basis: fees.Notional, Amount: 50}}
+	tier := fees.Schedule{Taker: fees.Rate{Basis: fees.Notional, Amount: 10}}
+	fees.MarketSchedules["ETH"] = market
+	fees.TierSchedules["vip"] = tier
+	fees.UserTiers["bob"] = "vip"
+	fees.UserTiers["carol"] = "unknown"
+	defer func() {
+		delete(fees.MarketSchedules, "ETH")
+		delete(fees.TierSchedules, "vip")
+		delete(fees.UserTiers, "bob")
+		delete(fees.UserTiers, "carol")
+	}()
+
+	tests := []struct {
+		name   string
+		symbol string
+		userId string
+		want   fees.Schedule
+	}{
+		{"default", "BTC", "alice", fees.DefaultSchedule},
+		{"market override", "ETH", "alice", market},
+		{"tier beats market", "ETH", "bob", tier},
+		{"tier everywhere", "BTC", "bob", tier},
+		{"unknown tier falls back", "ETH", "carol", market},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fees.ScheduleFor(tt.symbol, tt.userId); got != tt.want {
+				t.Errorf("ScheduleFor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rate fees.Rate
+		ok   bool
+	}{
+		{"notional", fees.Rate{Basis: fees.Notional, Amount: 100}, true},
+		{"full rate", fees.Rate{Basis: fees.Winnings, Amount: 10000}, true},
+		{"over full rate", fees.Rate{Basis: fees.Winnings, Amount: 10001}, false},
+		{"large flat", fees.Rate{Basis: fees.Flat, Amount: 20000}, true},
+		{"negative", fees.Rate{Basis: fees.Flat, Amount: -1}, false},
+		{"unknown basis", fees.Rate{Basis: "percent", Amount: 1}, false},
+		{"missing basis", fees.Rate{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rate.Validate()
+			if (err == nil) != tt.ok {
+				t.Errorf("Validate = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+
+	if err := fees.DefaultSchedule.Validate(); err != nil {
+		t.Errorf("default schedule: %v", err)
+	}
+	bad := fees.DefaultSchedule
+	bad.Settlement.Amount = -5
+	if err := bad.Validate(); err == nil {
+		t.Error("schedule with a negative settlement fee validated")
+	}
+}
@@ -0,0 +1,180 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/replay"
+)
+
+// Entry kinds, one per kind of money movement
+const (
+	KindOnramp           = "onramp"
+	KindGrant            = "grant"
+	KindLock             = "lock"
+	KindUnlock           = "unlock"
+	KindFill             = "fill"
+	KindFee              = "fee"
+	KindMint             = "mint"
+	KindMerge            = "merge"
+	KindSubsidy          = "subsidy"
+	KindSettlement       = "settlement"
+	KindWithdrawal       = "withdrawal"
+	KindWithdrawalFailed = "withdrawal_failed"
+	KindWithdrawalPayout = "payout"
+)
+
+// Platform wide accounts
+const (
+	PlatformFees = "platform:fees"
+	// PlatformSubsidy funds market makers the platform seeds, it goes negative
+	// by what they still hold and what they lost
+	PlatformSubsidy = "platform:subsidy"
+	External        = "external"
+)
+
+func Available(userId string) string { return "user:" + userId + ":available" }
+func Locked(userId string) string    { return "user:" + userId + ":locked" }
+func Pending(userId string) string   { return "user:" + userId + ":pending" }
+func Escrow(symbol string) string    { return "market:" + symbol + ":escrow" }
+
+// Posting moves Amount into Account, negative amounts move money out
+type Posting struct {
+	Account string `json:"account"`
+	Amount  int    `json:"amount"`
+}
+
+// Entry is a balanced set of postings, the amounts always add up to zero
+type Entry struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference,omitempty"`
+	Postings  []Posting `json:"postings"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+var (
+	Journal  = []Entry{}
+	balances = map[string]int{}
+)
+
+// Record appends an entry to the journal after checking it balances
+func Record(kind, reference string, postings ...Posting) (Entry, error) {
+	sum := 0
+	for _, p := range postings {
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return Entry{}, fmt.Errorf("unbalanced %s entry: postings add up to %d", kind, sum)
+	}
+
+	entry := Entry{
+		ID:        replay.NewID(),
+		Kind:      kind,
+		Reference: reference,
+		Postings:  postings,
+		Timestamp: replay.Now(),
+	}
+	for _, p := range postings {
+		balances[p.Account] += p.Amount
+	}
+	Journal = append(Journal, entry)
+	return entry, nil
+}
+
+// Transfer records a two legged entry moving amount from one account to another.
+// Zero amounts are not recorded.
+func Transfer(kind, reference, from, to string, amount int) {
+	if amount == 0 {
+		return
+	}
+	Record(kind, reference, Posting{Account: from, Amount: -amount}, Posting{Account: to, Amount: amount})
+}
+
+// Restore replaces the journal, rebuilding account balances from its entries
+func Restore(entries []Entry) {
+	Journal = entries
+	balances = map[string]int{}
+	for _, entry := range entries {
+		for _, p := range entry.Postings {
+			balances[p.Account] += p.Amount
+		}
+	}
+}
+
+// Balance returns what the journal says an account holds
+func Balance(account string) int {
+	return balances[account]
+}
+
+// Balances returns every account the journal has touched
+func Balances() map[string]int {
+	out := make(map[string]int, len(balances))
+	for account, amount := range balances {
+		out[account] = amount
+	}
+	return out
+}
+
+// Entries returns the journal entries that touch the account, or all of them
+func Entries(account string) []Entry {
+	if account == "" {
+		return Journal
+	}
+	entries := []Entry{}
+	for _, entry := range Journal {
+		for _, p := range entry.Postings {
+			if p.Account == account {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// Mismatch is a stored balance that disagrees with the journal
+type Mismatch struct {
+	Account string `json:"account"`
+	Stored  int    `json:"stored"`
+	Journal int    `json:"journal"`
+}
+
+// Verify compares the balances kept in models against the journal
+func Verify() []Mismatch {
+	mismatches := []Mismatch{}
+	check := func(account string, stored int) {
+		if journal := balances[account]; journal != stored {
+			mismatches = append(mismatches, Mismatch{Account: account, Stored: stored, Journal: journal})
+		}
+	}
+
+	seen := map[string]bool{}
+	for userId, user := range models.INR_BALANCES {
+		check(Available(userId), user.Balance)
+		check(Locked(userId), user.Locked)
+		check(Pending(userId), user.PendingWithdrawal)
+		seen[userId] = true
+	}
+
+	// Accounts of users the balance map does not know about must be empty
+	for account := range balances {
+		if !strings.HasPrefix(account, "user:") {
+			continue
+		}
+		userId := account[len("user:"):strings.LastIndex(account, ":")]
+		if !seen[userId] {
+			check(account, 0)
+		}
+	}
+
+	check(PlatformFees, models.PlatformRevenue.Total)
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Account < mismatches[j].Account
+	})
+	return mismatches
+}
@@ -0,0 +1,151 @@
+package ledger_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+)
+
+// reset starts a test from an empty journal and no stored balances
+func reset(t *testing.T) {
+	ledger.Restore([]ledger.Entry{})
+	clear(models.INR_BALANCES)
+	models.PlatformRevenue = models.FeeTotals{}
+	t.Cleanup(func() {
+		ledger.Restore([]ledger.Entry{})
+		clear(models.INR_BALANCES)
+		models.PlatformRevenue = models.FeeTotals{}
+	})
+}
+
+func TestRecord(t *testing.T) {
+	reset(t)
+
+	tests := []struct {
+		name     string
+		postings []ledger.Posting
+		ok       bool
+	}{
+		{"two legs", []ledger.Posting{{"a", -10}, {"b", 10}}, true},
+		{"three legs", []ledger.Posting{{"a", -6}, {"c", -4}, {"escrow", 10}}, true},
+		{"unbalanced", []ledger.Posting{{"a", -10}, {"b", 9}}, false},
+		{"one leg", []ledger.Posting{{"a", 5}}, false},
+		{"nothing", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, balances := len(ledger.Journal), ledger.Balances()
+			entry, err := ledger.Record("test", tt.name, tt.postings...)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Record error = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				if len(ledger.Journal) != before || !reflect.DeepEqual(ledger.Balances(), balances) {
+					t.Error("a rejected entry changed the journal")
+				}
+				return
+			}
+			if entry.ID == "" || entry.Kind != "test" || entry.Reference != tt.name {
+				t.Errorf("entry = %+v", entry)
+			}
+			if len(ledger.Journal) != before+1 {
+				t.Errorf("journal has %d entries, want %d", len(ledger.Journal), before+1)
+			}
+		})
+	}
+
+	want := map[string]int{"a": -16, "b": 10, "c": -4, "escrow": 10}
+	if got := ledger.Balances(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Balances = %v, want %v", got, want)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	reset(t)
+
+	ledger.Transfer(ledger.KindOnramp, "dep-1", ledger.External, ledger.Available("alice"), 100)
+	ledger.Transfer(ledger.KindLock, "BTC", ledger.Available("alice"), ledger.Locked("alice"), 30)
+	ledger.Transfer(ledger.KindLock, "BTC", ledger.Available("alice"), ledger.Locked("alice"), 0)
+	ledger.Transfer(ledger.KindUnlock, "BTC", ledger.Locked("alice"), ledger.Available("alice"), 10)
+
+	if len(ledger.Journal) != 3 {
+		t.Fatalf("journal has %d entries, want the zero transfer skipped", len(ledger.Journal))
+	}
+	tests := []struct {
+		account string
+		balance int
+		entries int
+	}{
+		{ledger.External, -100, 1},
+		{ledger.Available("alice"), 80, 3},
+		{ledger.Locked("alice"), 20, 2},
+		{ledger.Available("bob"), 0, 0},
+		{"", 0, 3},
+	}
+	for _, tt := range tests {
+		if got := ledger.Balance(tt.account); tt.account != "" && got != tt.balance {
+			t.Errorf("Balance(%s) = %d, want %d", tt.account, got, tt.balance)
+		}
+		if got := len(ledger.Entries(tt.account)); got != tt.entries {
+			t.Errorf("Entries(%q) has %d entries, want %d", tt.account, got, tt.entries)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	reset(t)
+	ledger.Transfer(ledger.KindGrant, "alice", ledger.External, ledger.Available("alice"), 50)
+	ledger.Transfer(ledger.KindFee, "BTC", ledger.Available("alice"), ledger.PlatformFees, 5)
+	saved := append([]ledger.Entry{}, ledger.Journal...)
+	balances := ledger.Balances()
+
+	ledger.Restore([]ledger.Entry{})
+	if len(ledger.Balances()) != 0 {
+		t.Fatal("balances survived restoring an empty journal")
+	}
+	ledger.Restore(saved)
+	if got := ledger.Balances(); !reflect.DeepEqual(got, balances) {
+		t.Errorf("restored balances = %v, want %v", got, balances)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func()
+		want  []ledger.Mismatch
+	}{
+		{"in step", func() {
+			ledger.Transfer(ledger.KindGrant, "alice", ledger.External, ledger.Available("alice"), 100)
+			ledger.Transfer(ledger.KindLock, "BTC", ledger.Available("alice"), ledger.Locked("alice"), 40)
+			ledger.Transfer(ledger.KindFee, "BTC", ledger.Available("alice"), ledger.PlatformFees, 2)
+			models.INR_BALANCES["alice"] = models.UserBalance{Balance: 58, Locked: 40}
+			models.PlatformRevenue.Total = 2
+		}, []ledger.Mismatch{}},
+		{"balance changed without an entry", func() {
+			ledger.Transfer(ledger.KindGrant, "alice", ledger.External, ledger.Available("alice"), 100)
+			models.INR_BALANCES["alice"] = models.UserBalance{Balance: 120}
+		}, []ledger.Mismatch{{Account: ledger.Available("alice"), Stored: 120, Journal: 100}}},
+		{"pending withdrawal", func() {
+			ledger.Transfer(ledger.KindWithdrawal, "w-1", ledger.Available("bob"), ledger.Pending("bob"), 30)
+			models.INR_BALANCES["bob"] = models.UserBalance{Balance: -30}
+		}, []ledger.Mismatch{{Account: ledger.Pending("bob"), Stored: 0, Journal: 30}}},
+		{"unknown user holding money", func() {
+			ledger.Transfer(ledger.KindGrant, "ghost", ledger.External, ledger.Locked("ghost"), 7)
+		}, []ledger.Mismatch{{Account: ledger.Locked("ghost"), Stored: 0, Journal: 7}}},
+		{"revenue without fees", func() {
+			models.PlatformRevenue.Total = 3
+		}, []ledger.Mismatch{{Account: ledger.PlatformFees, Stored: 3, Journal: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset(t)
+			tt.setup()
+			if got := ledger.Verify(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verify = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Field names shared by every log line so they can be searched the same way
+const (
+	RequestID = "request_id"
+	UserID    = "user_id"
+	Symbol    = "symbol"
+	OrderID   = "order_id"
+	TradeID   = "trade_id"
+	Route     = "route"
+	TraceID   = "trace_id"
+)
+
+// ParseLevel accepts debug, info, warn and error
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("unknown log level %q", level)
+	}
+	return l, nil
+}
+
+// Setup makes a text or JSON logger at the given level the default, the
+// standard log package included
+func Setup(w io.Writer, level, format string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	case "text", "":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	if l > slog.LevelDebug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	return nil
+}
+
+// Fatal logs at error level and exits, for failures the process cannot go on from
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context carrying the logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// From returns the logger of the request being handled
+func From(c *gin.Context) *slog.Logger {
+	return FromContext(c.Request.Context())
+}
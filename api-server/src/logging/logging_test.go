@@ -0,0 +1,85 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sahilrush/src/logging"
+)
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { logging.Setup(io.Discard, "error", "text") })
+
+	tests := []struct {
+		name, level, format string
+		// logged is what the debug, info and warn lines below come out as
+		logged  string
+		wantErr bool
+	}{
+		{"json at warn", "warn", "json", `{"level":"WARN","msg":"warn","user_id":"alice"}`, false},
+		{"json at debug", "DEBUG", "JSON", `{"level":"DEBUG","msg":"debug","user_id":"alice"}` + "\n" +
+			`{"level":"INFO","msg":"info","user_id":"alice"}` + "\n" +
+			`{"level":"WARN","msg":"warn","user_id":"alice"}`, false},
+		{"text at info", "info", "", "level=INFO msg=info user_id=alice\nlevel=WARN msg=warn user_id=alice", false},
+		{"unknown level", "verbose", "json", "", true},
+		{"unknown format", "info", "xml", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := logging.Setup(&out, tt.level, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Setup(%q, %q) accepted", tt.level, tt.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			slog.Debug("debug", logging.UserID, "alice")
+			slog.Info("info", logging.UserID, "alice")
+			slog.Warn("warn", logging.UserID, "alice")
+
+			if got := withoutTime(t, out.String(), tt.format); got != tt.logged {
+				t.Errorf("logged\n%s\nwant\n%s", got, tt.logged)
+			}
+		})
+	}
+}
+
+// withoutTime drops the timestamps from the lines, which change every run
+func withoutTime(t *testing.T, out, format string) string {
+	t.Helper()
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.EqualFold(format, "json") {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("line %q is not JSON: %v", line, err)
+			}
+			delete(record, "time")
+			data, _ := json.Marshal(record)
+			lines = append(lines, string(data))
+		} else {
+			_, rest, _ := strings.Cut(line, " ")
+			lines = append(lines, rest)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestFromContext(t *testing.T) {
+	if logging.FromContext(context.Background()) != slog.Default() {
+		t.Error("a context without a logger does not give the default one")
+	}
+	logger := slog.Default().With(logging.RequestID, "req-1")
+	if logging.FromContext(logging.WithLogger(context.Background(), logger)) != logger {
+		t.Error("the context does not give back the logger it carries")
+	}
+}
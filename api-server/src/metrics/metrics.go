@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write itself in the text format
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds every metric exposed on /metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default is the registry the constructors register with
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the default registry
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf := bufio.NewWriter(w)
+		Default.WriteText(buf)
+		buf.Flush()
+	})
+}
+
+// family is what every metric type shares: a name, help text and label names
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (f family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+// key joins label values so a series can be looked up in a map
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func (f family) check(values []string) {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+}
+
+// labelPairs formats the label set, extra is appended as is (used for le)
+func labelPairs(names, values []string, extra string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escape(values[i])+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escape escapes a label value: backslash, newline and double quote
+func escape(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+// escapeHelp escapes help text, where only backslash and newline are special
+func escapeHelp(help string) string {
+	help = strings.ReplaceAll(help, `\`, `\\`)
+	return strings.ReplaceAll(help, "\n", `\n`)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	family
+	mu     sync.Mutex
+	series map[string]*Counter
+}
+
+// Counter only goes up
+type Counter struct {
+	values []string
+	mu     sync.Mutex
+	value  float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: family{name, help, "counter", labels}, series: map[string]*Counter{}}
+	Default.register(c)
+	return c
+}
+
+// With returns the counter for the label values, in the order the labels were declared
+func (c *CounterVec) With(values ...string) *Counter {
+	c.check(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(values)
+	counter, ok := c.series[k]
+	if !ok {
+		counter = &Counter{values: values}
+		c.series[k] = counter
+	}
+	return counter
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter, negative values are ignored
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	keys := sortedKeys(c.series)
+	series := make([]*Counter, len(keys))
+	for i, k := range keys {
+		series[i] = c.series[k]
+	}
+	c.mu.Unlock()
+
+	for _, counter := range series {
+		counter.mu.Lock()
+		value := counter.value
+		counter.mu.Unlock()
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, counter.values, ""), formatFloat(value))
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*Histogram
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	values  []string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{family: family{name, help, "histogram", labels}, buckets: buckets, series: map[string]*Histogram{}}
+	Default.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	h.check(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	k := key(values)
+	histogram, ok := h.series[k]
+	if !ok {
+		histogram = &Histogram{values: values, buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+		h.series[k] = histogram
+	}
+	return histogram
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	keys := sortedKeys(h.series)
+	series := make([]*Histogram, len(keys))
+	for i, k := range keys {
+		series[i] = h.series[k]
+	}
+	h.mu.Unlock()
+
+	for _, histogram := range series {
+		histogram.mu.Lock()
+		counts := append([]uint64{}, histogram.counts...)
+		count, sum := histogram.count, histogram.sum
+		histogram.mu.Unlock()
+
+		for i, bound := range h.buckets {
+			le := `le="` + formatFloat(bound) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, histogram.values, le), counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, histogram.values, `le="+Inf"`), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, histogram.values, ""), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, histogram.values, ""), count)
+	}
+}
+
+// Sample is one series of a gauge read at scrape time
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc computes its series when scraped, for values derived from state
+type GaugeFunc struct {
+	family
+	fn func() []Sample
+}
+
+func NewGaugeFunc(name, help string, labels []string, fn func() []Sample) *GaugeFunc {
+	g := &GaugeFunc{family: family{name, help, "gauge", labels}, fn: fn}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w)
+	samples := g.fn()
+	sort.Slice(samples, func(i, j int) bool {
+		return key(samples[i].Labels) < key(samples[j].Labels)
+	})
+	for _, sample := range samples {
+		if len(sample.Labels) != len(g.labels) {
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelPairs(g.labels, sample.Labels, ""), formatFloat(sample.Value))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
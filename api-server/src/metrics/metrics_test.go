@@ -0,0 +1,80 @@
+package metrics_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sahilrush/src/metrics"
+)
+
+// exposition is what a scrape of the metrics below has to read, in the
+// Prometheus text format 0.0.4
+const exposition = `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/a"} 3
+test_requests_total{method="GET",path="/quote\"d\\back\nline"} 1
+test_requests_total{method="POST",path="/a"} 0.5
+# HELP test_events_total Events with a back\\slash and a\nnew line in the help.
+# TYPE test_events_total counter
+test_events_total 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 1
+test_latency_seconds_bucket{route="/a",le="1"} 2
+test_latency_seconds_bucket{route="/a",le="+Inf"} 3
+test_latency_seconds_sum{route="/a"} 2.55
+test_latency_seconds_count{route="/a"} 3
+# HELP test_depth Depth read at scrape time.
+# TYPE test_depth gauge
+test_depth{queue="a"} 1e+06
+test_depth{queue="b"} -Inf
+test_depth{queue="c"} 0.25
+`
+
+func TestExposition(t *testing.T) {
+	requests := metrics.NewCounterVec("test_requests_total", "Requests served.", "method", "path")
+	events := metrics.NewCounterVec("test_events_total", "Events with a back\\slash and a\nnew line in the help.")
+	latency := metrics.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	metrics.NewGaugeFunc("test_depth", "Depth read at scrape time.", []string{"queue"}, func() []metrics.Sample {
+		return []metrics.Sample{
+			{Labels: []string{"c"}, Value: 0.25},
+			{Labels: []string{"a"}, Value: 1e6},
+			{Labels: []string{"b"}, Value: math.Inf(-1)},
+			// A sample with the wrong labels is left out
+			{Labels: []string{"d", "extra"}, Value: 1},
+		}
+	})
+
+	for range 3 {
+		requests.With("GET", "/a").Inc()
+	}
+	requests.With("POST", "/a").Add(0.5)
+	requests.With("POST", "/a").Add(-4)
+	requests.With("GET", "/quote\"d\\back\nline").Inc()
+	events.With().Add(2)
+	for _, v := range []float64{0.05, 0.5, 2} {
+		latency.With("/a").Observe(v)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Body.String(); got != exposition {
+		t.Errorf("scrape differs:\n%s\nwant\n%s", got, exposition)
+	}
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	counter := metrics.NewCounterVec("test_labelled_total", "Labelled.", "a", "b")
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "takes 2 label values, got 1") {
+			t.Errorf("recovered %v, want a panic naming the label count", r)
+		}
+	}()
+	counter.With("only one")
+}
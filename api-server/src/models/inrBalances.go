@@ -1,8 +1,12 @@
 package models
 
+import "time"
+
 type UserBalance struct {
 	Balance int `json:"balance"`
 	Locked  int `json:"locked" `
+	// PendingWithdrawal is money on its way out that the payout rail has not confirmed yet
+	PendingWithdrawal int `json:"pendingWithdrawal"`
 }
 
 var UserWithBalance = make(map[string]UserBalance)
@@ -13,3 +17,61 @@ type OnrampUser struct {
 }
 
 var INR_BALANCES = UserWithBalance
+
+type OfframpUser struct {
+	UserId string `json:"userId" binding:"required"`
+	Amount int    `json:"amount" binding:"required"`
+}
+
+// Withdrawal statuses
+const (
+	WithdrawalPending   = "pending"
+	WithdrawalCompleted = "completed"
+	WithdrawalFailed    = "failed"
+)
+
+type Withdrawal struct {
+	ID        string    `json:"id"`
+	UserId    string    `json:"userId"`
+	Amount    int       `json:"amount"`
+	Status    string    `json:"status"`
+	Reference string    `json:"reference,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+var Withdrawals = map[string]Withdrawal{}
+
+// Deposit intent statuses
+const (
+	DepositCreated   = "created"
+	DepositSucceeded = "succeeded"
+	DepositFailed    = "failed"
+)
+
+// DepositIntent is a request to add money that only credits once the gateway confirms it
+type DepositIntent struct {
+	ID          string    `json:"id"`
+	UserId      string    `json:"userId"`
+	Amount      int       `json:"amount"`
+	Status      string    `json:"status"`
+	Reference   string    `json:"reference,omitempty"`
+	CheckoutURL string    `json:"checkoutUrl,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+var DepositIntents = map[string]DepositIntent{}
+
+// ProcessedWebhooks remembers gateway event ids so a replayed callback is ignored
+var ProcessedWebhooks = map[string]bool{}
+
+// GatewayEvent is the payload the payment gateway posts to the onramp webhook
+type GatewayEvent struct {
+	EventId   string `json:"eventId"`
+	IntentId  string `json:"intentId"`
+	Amount    int    `json:"amount"`
+	Status    string `json:"status"`
+	Reference string `json:"reference"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Order statuses
+const (
+	OrderOpen            = "open"
+	OrderPartiallyFilled = "partially_filled"
+	OrderFilled          = "filled"
+	OrderCancelled       = "cancelled"
+)
+
+// Order types: a limit order rests what it cannot fill at its price, a market
+// order fills what it can at any price and cancels the rest
+const (
+	OrderLimit  = "limit"
+	OrderMarket = "market"
+)
+
+// OrderRequest is the one schema orders are placed with
+type OrderRequest struct {
+	UserId        string `json:"userId"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`    // "buy" or "sell"
+	Outcome       string `json:"outcome"` // "yes" or "no"
+	Type          string `json:"type"`    // "limit" (the default) or "market"
+	Price         int    `json:"price"`
+	Quantity      int    `json:"quantity"`
+	ClientOrderId string `json:"clientOrderId,omitempty"`
+}
+
+// Order is a placed order. Remaining is the quantity still resting on the
+// book, Fills holds every trade the order took part in, as taker or maker.
+type Order struct {
+	ID            string    `json:"id"`
+	ClientOrderId string    `json:"clientOrderId,omitempty"`
+	UserId        string    `json:"userId"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	Outcome       string    `json:"outcome"`
+	Type          string    `json:"type"`
+	Price         int       `json:"price"`
+	Quantity      int       `json:"quantity"`
+	Filled        int       `json:"filled"`
+	Remaining     int       `json:"remaining"`
+	Status        string    `json:"status"`
+	Fills         []Trade   `json:"fills"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Open reports whether part of the order still rests on the book
+func (o Order) Open() bool {
+	return o.Status == OrderOpen || o.Status == OrderPartiallyFilled
+}
+
+// PlacedOrders holds every order by ID
+var PlacedOrders = map[string]Order{}
+
+// UserOrders lists the IDs of each user's orders in the order they were placed
+var UserOrders = map[string][]string{}
@@ -1,13 +1,21 @@
 package models
 
+// Orders is what is left of one order resting at a price level: a "sell" of
+// the level's outcome or an "inverse" buy of the other outcome
 type Orders struct {
+	OrderId  string `json:"orderId"`
+	UserId   string `json:"userId"`
 	Quantity int    `json:"quantity"`
 	Type     string `json:"type"`
+	// FeeLocked is the maker fee an inverse buy locked for its quantity
+	FeeLocked int `json:"feeLocked,omitempty"`
 }
 
+// OrderType is a price level. Its resting orders are kept in the order they
+// arrived, which is the order they fill in.
 type OrderType struct {
-	Total  int               `json:"total"`
-	Orders map[string]Orders `json:"orders"`
+	Total  int      `json:"total"`
+	Orders []Orders `json:"orders"`
 }
 
 type Pricing struct {
@@ -18,3 +26,6 @@ type Pricing struct {
 type Orderbook map[string]Pricing
 
 var Orderbooks = Orderbook{}
+
+// LastTradedPrice keeps the last fill price per symbol and outcome
+var LastTradedPrice = map[string]map[string]int{}
@@ -0,0 +1,64 @@
+package models
+
+import "github.com/sahilrush/src/fees"
+
+// Request bodies of the routes that have no other model to bind to
+
+type CreateUser struct {
+	UserId string `json:"userId" binding:"required"`
+}
+
+type CreateSymbol struct {
+	UserId string `json:"userId" binding:"required"`
+	Stock  string `json:"stock" binding:"required"`
+	// Amm seeds the market with an automated market maker when set
+	Amm *MakerSeed `json:"amm,omitempty"`
+}
+
+// MakerSeed is the liquidity of a new market's maker and who funds it: the
+// creator, by default, or the platform
+type MakerSeed struct {
+	Liquidity float64 `json:"liquidity"`
+	FundedBy  string  `json:"fundedBy,omitempty"`
+}
+
+type ResolveSymbol struct {
+	Stock   string `json:"stock" binding:"required"`
+	Outcome string `json:"outcome" binding:"required"`
+}
+
+// WithdrawalUpdate is what the payout rail reports about a pending withdrawal
+type WithdrawalUpdate struct {
+	Status    string `json:"status" binding:"required"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason"`
+}
+
+// FeeScheduleUpdate sets the schedule of a market, of a tier, or the default one
+type FeeScheduleUpdate struct {
+	Market   string        `json:"market"`
+	Tier     string        `json:"tier"`
+	Schedule fees.Schedule `json:"schedule" binding:"required"`
+}
+
+type UserTier struct {
+	UserId string `json:"userId" binding:"required"`
+	Tier   string `json:"tier" binding:"required"`
+}
+
+// Reply data of routes that answer with more than one model
+
+// OrderReply is what the legacy buy and sell routes answer with.
+// RemainingBalance is the seller's holding and only set for sells.
+type OrderReply struct {
+	Orderbook        Pricing  `json:"orderbook"`
+	Trades           []Trade  `json:"trades"`
+	Order            Order    `json:"order"`
+	RemainingBalance *OutCome `json:"remaining_balance,omitempty"`
+}
+
+// Resolution is the outcome of a market and what each holder was paid
+type Resolution struct {
+	Outcome string         `json:"outcome"`
+	Payouts map[string]int `json:"payouts"`
+}
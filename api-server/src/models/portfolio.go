@@ -0,0 +1,59 @@
+package models
+
+// Basis is what a user paid for the shares of one outcome they hold and the
+// profit they took on the ones they no longer hold
+type Basis struct {
+	Quantity int `json:"quantity"`
+	Cost     int `json:"cost"`
+	Realized int `json:"realized"`
+}
+
+// CostBasis is keyed by symbol, user and outcome like Stock_Balances. It
+// outlives the holdings: resolving a market clears them but keeps the profit.
+var CostBasis = map[string]map[string]map[string]Basis{}
+
+// FeesPaid is the trading and settlement fees a user paid, by symbol and user
+var FeesPaid = map[string]map[string]int{}
+
+// Position is a user's holding in one outcome of a market, valued at the last
+// traded price or, before the first trade, at the middle of the book
+type Position struct {
+	Symbol   string  `json:"symbol"`
+	Outcome  string  `json:"outcome"`
+	Quantity int     `json:"quantity"`
+	Locked   int     `json:"locked"`
+	AvgPrice float64 `json:"avgPrice"`
+	Cost     int     `json:"cost"`
+	// MarkSource is "last", "mid" or empty when there is nothing to mark
+	// against, in which case the position is valued at cost. Resolving a
+	// market pays its shares out, leaving only the realized PnL.
+	MarkPrice     float64 `json:"markPrice"`
+	MarkSource    string  `json:"markSource,omitempty"`
+	Value         float64 `json:"value"`
+	RealizedPnl   int     `json:"realizedPnl"`
+	UnrealizedPnl float64 `json:"unrealizedPnl"`
+	// Open orders: shares bid for and the INR locked for them, shares offered
+	OpenBuy     int    `json:"openBuy"`
+	OpenBuyCost int    `json:"openBuyCost"`
+	OpenSell    int    `json:"openSell"`
+	Resolved    string `json:"resolved,omitempty"`
+}
+
+// PortfolioTotals adds up the positions of a portfolio
+type PortfolioTotals struct {
+	Cost          int     `json:"cost"`
+	Value         float64 `json:"value"`
+	RealizedPnl   int     `json:"realizedPnl"`
+	UnrealizedPnl float64 `json:"unrealizedPnl"`
+	Fees          int     `json:"fees"`
+	NetPnl        float64 `json:"netPnl"`
+	OpenOrders    int     `json:"openOrders"`
+	OpenBuyCost   int     `json:"openBuyCost"`
+}
+
+type Portfolio struct {
+	UserId    string          `json:"userId"`
+	Balance   UserBalance     `json:"balance"`
+	Positions []Position      `json:"positions"`
+	Totals    PortfolioTotals `json:"totals"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// QueueData is a request the API server forwards to the engine
+type QueueData struct {
+	ID       string `json:"_id"`
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	// ReplyTo is the channel the engine publishes the reply on
+	ReplyTo string            `json:"replyTo,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Trace carries the W3C trace context of the forwarding span
+	Trace map[string]string `json:"trace,omitempty"`
+	// SentAt is when the API server queued the request
+	SentAt time.Time `json:"sentAt,omitempty"`
+	Req    struct {
+		Body   json.RawMessage   `json:"body"`
+		Params map[string]string `json:"params"`
+		Query  string            `json:"query,omitempty"`
+	} `json:"req"`
+}
+
+// EngineReply is what the engine publishes back for a QueueData
+type EngineReply struct {
+	ID         string            `json:"_id"`
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Data       json.RawMessage   `json:"data"`
+}
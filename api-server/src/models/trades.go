@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type YesPayload struct {
 	UserId   string `json:"userId"`
 	Stock    string `json:"stock"`
@@ -29,3 +31,43 @@ type BuyNo struct {
 	Quantity  int    `json:"quantity"`
 	StockType string `json:"stocktype"`
 }
+
+// ContractPrice is what a winning share pays out, YES and NO prices add up to it
+const ContractPrice = 10
+
+// Trade is a single fill between a resting (maker) and incoming (taker) order
+type Trade struct {
+	ID       string `json:"id"`
+	Symbol   string `json:"symbol"`
+	Outcome  string `json:"outcome"`
+	Price    int    `json:"price"`
+	Quantity int    `json:"quantity"`
+	Buyer    string `json:"buyer"`
+	Seller   string `json:"seller"`
+	Maker    string `json:"maker"`
+	Taker    string `json:"taker"`
+	// MakerOrderId is the resting order filled, empty when a market maker sold
+	MakerOrderId string    `json:"makerOrderId,omitempty"`
+	MakerFee     int       `json:"makerFee"`
+	TakerFee     int       `json:"takerFee"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+var Trades = []Trade{}
+
+// FeeTotals is the revenue collected by the platform, split by fee kind
+type FeeTotals struct {
+	Maker      int `json:"maker"`
+	Taker      int `json:"taker"`
+	Settlement int `json:"settlement"`
+	Total      int `json:"total"`
+}
+
+// PlatformRevenue is the platform revenue account, MarketRevenue breaks it down per symbol
+var (
+	PlatformRevenue = FeeTotals{}
+	MarketRevenue   = map[string]FeeTotals{}
+)
+
+// ResolvedMarkets stores the winning outcome of every settled symbol
+var ResolvedMarkets = map[string]string{}
@@ -0,0 +1,310 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document. Schemas
+// are derived from the Go types the handlers bind and answer with, so they
+// follow the code; Operations must list every route the API server serves.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/candles"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/fees"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/tickers"
+)
+
+// Param is a query or header parameter
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Operation documents one route. Body and Data are values of the request body
+// type and of the type in the data field of a successful reply, nil for none.
+// Raw is the media type of replies that are not the JSON envelope.
+type Operation struct {
+	ID      string
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	Query   []Param
+	Headers []Param
+	Body    interface{}
+	Data    interface{}
+	Status  int
+	Raw     string
+}
+
+// invariantReport is the data of GET /invariants
+type invariantReport struct {
+	Latest   engine.Report   `json:"latest"`
+	Failures []engine.Report `json:"failures"`
+}
+
+// feeReport is the data of GET /fees
+type feeReport struct {
+	Platform models.FeeTotals            `json:"platform"`
+	Markets  map[string]models.FeeTotals `json:"markets"`
+	Schedule struct {
+		Default fees.Schedule            `json:"default"`
+		Markets map[string]fees.Schedule `json:"markets"`
+		Tiers   map[string]fees.Schedule `json:"tiers"`
+	} `json:"schedule"`
+}
+
+// probe is the data of the health probes
+type probe map[string]struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+var signature = Param{Name: payments.SignatureHeader, Description: "Hex HMAC-SHA256 of the raw body", Required: true}
+
+var operatorSignature = Param{Name: payments.OperatorHeader, Description: "Hex HMAC-SHA256 of the raw body with the operator secret, needed for a platform funded market maker"}
+
+var Operations = []Operation{
+	{ID: "createUser", Method: http.MethodPost, Path: "/user/create", Tag: "users", Summary: "Create a user with an empty INR balance",
+		Body: models.CreateUser{}, Data: models.UserBalance{}},
+	{ID: "getBalances", Method: http.MethodGet, Path: "/balance/inr", Tag: "users", Summary: "INR balances of every user",
+		Data: map[string]models.UserBalance{}},
+	{ID: "getBalance", Method: http.MethodGet, Path: "/balance/inr/:userId", Tag: "users", Summary: "INR balance of a user",
+		Data: models.UserBalance{}},
+	{ID: "getUserStock", Method: http.MethodGet, Path: "/getUserStock/:userId", Tag: "users", Summary: "Holdings of a user by market",
+		Data: map[string]models.Stocksymbol{}},
+	{ID: "getPortfolio", Method: http.MethodGet, Path: "/portfolio/:userId", Tag: "users", Summary: "Positions of a user with average entry price, mark-to-market value, PnL and open-order exposure",
+		Data: models.Portfolio{}},
+	{ID: "getStocks", Method: http.MethodGet, Path: "/getStocks", Tag: "users", Summary: "Holdings of every user by market",
+		Data: models.Stock{}},
+
+	{ID: "onramp", Method: http.MethodPost, Path: "/onramp/inr", Tag: "payments", Summary: "Open a deposit intent, the balance is credited once the gateway confirms it",
+		Body: models.OnrampUser{}, Data: models.DepositIntent{}, Status: http.StatusCreated},
+	{ID: "getDepositIntent", Method: http.MethodGet, Path: "/onramp/inr/:intentId", Tag: "payments", Summary: "Status of a deposit intent",
+		Data: models.DepositIntent{}},
+	{ID: "onrampWebhook", Method: http.MethodPost, Path: "/onramp/webhook", Tag: "payments", Summary: "Payment gateway callback settling a deposit intent",
+		Headers: []Param{signature}, Body: models.GatewayEvent{}, Data: models.DepositIntent{}},
+	{ID: "offramp", Method: http.MethodPost, Path: "/offramp/inr", Tag: "payments", Summary: "Withdraw INR, 202 while the payout is pending",
+		Body: models.OfframpUser{}, Data: models.Withdrawal{}},
+	{ID: "getWithdrawal", Method: http.MethodGet, Path: "/offramp/inr/:withdrawalId", Tag: "payments", Summary: "Status of a withdrawal",
+		Data: models.Withdrawal{}},
+	{ID: "updateWithdrawal", Method: http.MethodPost, Path: "/offramp/inr/:withdrawalId/status", Tag: "payments", Summary: "Payout rail callback completing or failing a withdrawal",
+		Headers: []Param{signature}, Body: models.WithdrawalUpdate{}, Data: models.Withdrawal{}},
+
+	{ID: "createMarket", Method: http.MethodPost, Path: "/symbol/create", Tag: "markets", Summary: "Create a market, the creator gets the initial YES and NO shares; amm seeds it with a market maker",
+		Headers: []Param{operatorSignature}, Body: models.CreateSymbol{}, Data: models.Pricing{}},
+	{ID: "resolveMarket", Method: http.MethodPost, Path: "/symbol/resolve", Tag: "markets", Summary: "Settle a market, cancelling its orders and paying out winning shares",
+		Body: models.ResolveSymbol{}, Data: models.Resolution{}},
+	{ID: "getOrderbook", Method: http.MethodGet, Path: "/orderbook/:symbol", Tag: "markets", Summary: "Order book of a market",
+		Data: models.Pricing{}},
+	{ID: "getOrderbooks", Method: http.MethodGet, Path: "/orderbook/getorder", Tag: "markets", Summary: "Order books of every market",
+		Data: models.Orderbook{}},
+	{ID: "getCandles", Method: http.MethodGet, Path: "/markets/:symbol/candles", Tag: "markets", Summary: "OHLCV candles of a market outcome, oldest first; intervals without trades have none",
+		Query: []Param{
+			{Name: "outcome", Description: "yes or no, default yes"},
+			{Name: "interval", Description: "1m, 5m, 1h or 1d, default 1m"},
+			{Name: "from", Description: "Earliest candle start, RFC 3339 or Unix seconds"},
+			{Name: "to", Description: "Candles start before this, RFC 3339 or Unix seconds"},
+		}, Data: candles.Series{}},
+	{ID: "getTickers", Method: http.MethodGet, Path: "/tickers", Tag: "markets", Summary: "Last price, best bid and ask, 24h volume and change, open interest and traders of every market",
+		Data: []tickers.Ticker{}},
+	{ID: "getMarketMaker", Method: http.MethodGet, Path: "/markets/:symbol/amm", Tag: "markets", Summary: "LMSR market maker of a market: prices, quotes, holdings, subsidy and PnL",
+		Data: amm.Status{}},
+
+	{ID: "placeOrder", Method: http.MethodPost, Path: "/v1/orders", Tag: "orders", Summary: "Place an order",
+		Body: models.OrderRequest{}, Data: models.Order{}, Status: http.StatusCreated},
+	{ID: "listOrders", Method: http.MethodGet, Path: "/v1/orders", Tag: "orders", Summary: "Orders of a user, oldest first",
+		Query: []Param{
+			{Name: "userId", Required: true},
+			{Name: "symbol", Description: "Only orders in this market"},
+			{Name: "status", Description: "open, partially_filled, filled or cancelled; open includes partially filled orders"},
+		}, Data: []models.Order{}},
+	{ID: "getOrder", Method: http.MethodGet, Path: "/v1/orders/:orderId", Tag: "orders", Summary: "An order with its fills",
+		Data: models.Order{}},
+	{ID: "cancelOrder", Method: http.MethodDelete, Path: "/v1/orders/:orderId", Tag: "orders", Summary: "Cancel what is left of an open order, releasing its locked shares or INR",
+		Query: []Param{{Name: "userId", Description: "Owner of the order", Required: true}}, Data: models.Order{}},
+	{ID: "listTrades", Method: http.MethodGet, Path: "/trades", Tag: "orders", Summary: "Trades oldest first, the most recent ones or those after a cursor",
+		Query: []Param{
+			{Name: "symbol", Description: "Only trades in this market"},
+			{Name: "after", Description: "ID of the last trade seen, only later trades are returned"},
+			{Name: "limit", Description: "At most this many trades, 1 to 1000, default 100"},
+		}, Data: []models.Trade{}},
+	{ID: "buyYes", Method: http.MethodPost, Path: "/buyyes", Tag: "orders", Summary: "Legacy: buy YES shares with a limit order",
+		Body: models.BuyYes{}, Data: models.OrderReply{}},
+	{ID: "buyNo", Method: http.MethodPost, Path: "/buyno", Tag: "orders", Summary: "Legacy: buy NO shares with a limit order",
+		Body: models.BuyNo{}, Data: models.OrderReply{}},
+	{ID: "sellYes", Method: http.MethodPost, Path: "/sellyes", Tag: "orders", Summary: "Legacy: sell YES shares with a limit order",
+		Body: models.YesPayload{}, Data: models.OrderReply{}},
+	{ID: "sellNo", Method: http.MethodPost, Path: "/sellno", Tag: "orders", Summary: "Legacy: sell NO shares with a limit order",
+		Body: models.YesPayload{}, Data: models.OrderReply{}},
+
+	{ID: "getFees", Method: http.MethodGet, Path: "/fees", Tag: "fees", Summary: "Fee revenue and schedules",
+		Data: feeReport{}},
+	{ID: "setFeeSchedule", Method: http.MethodPost, Path: "/fees/schedule", Tag: "fees", Summary: "Set the fee schedule of a market, of a tier, or the default one",
+		Body: models.FeeScheduleUpdate{}, Data: fees.Schedule{}},
+	{ID: "setUserTier", Method: http.MethodPost, Path: "/fees/tier", Tag: "fees", Summary: "Place a user in a fee tier",
+		Body: models.UserTier{}, Data: models.UserTier{}},
+
+	{ID: "getJournal", Method: http.MethodGet, Path: "/ledger/journal", Tag: "ledger", Summary: "Journal entries",
+		Query: []Param{{Name: "account", Description: "Only entries touching this account"}}, Data: []ledger.Entry{}},
+	{ID: "getLedgerAccounts", Method: http.MethodGet, Path: "/ledger/accounts", Tag: "ledger", Summary: "Balance of every ledger account",
+		Data: map[string]int{}},
+	{ID: "verifyLedger", Method: http.MethodGet, Path: "/ledger/verify", Tag: "ledger", Summary: "Compare stored balances with the journal, LEDGER_MISMATCH lists the differences"},
+	{ID: "getInvariants", Method: http.MethodGet, Path: "/invariants", Tag: "ledger", Summary: "Latest invariant report and recent failures",
+		Query: []Param{{Name: "run", Description: "true checks the state again first"}}, Data: invariantReport{}},
+
+	{ID: "healthz", Method: http.MethodGet, Path: "/healthz", Tag: "operations", Summary: "Liveness probe",
+		Data: probe{}},
+	{ID: "readyz", Method: http.MethodGet, Path: "/readyz", Tag: "operations", Summary: "Readiness probe, 503 while the engine or Redis is unavailable or the server drains",
+		Data: probe{}},
+	{ID: "metrics", Method: http.MethodGet, Path: "/metrics", Tag: "operations", Summary: "Prometheus metrics",
+		Raw: "text/plain"},
+	{ID: "openapi", Method: http.MethodGet, Path: "/openapi.json", Tag: "operations", Summary: "This document",
+		Raw: "application/json"},
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// Document builds the OpenAPI document from Operations
+func Document() map[string]interface{} {
+	s := newSchemas()
+	s.of(reflect.TypeOf(apierr.Error{}))
+	s.components["ErrorResponse"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"success", "message", "error"},
+		"properties": map[string]interface{}{
+			"success": map[string]interface{}{"type": "boolean"},
+			"message": map[string]interface{}{"type": "string"},
+			"error":   ref("Error"),
+		},
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, op := range Operations {
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(op.Method)] = operation(s, op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Opnify API",
+			"version":     "1.0.0",
+			"description": "Prediction market API. Every reply is an envelope with success and message; data holds the result, error the code and details of a failure.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": s.components,
+			"parameters": map[string]interface{}{
+				"IdempotencyKey": map[string]interface{}{
+					"name": engine.IdempotencyHeader, "in": "header",
+					"description": "Retries with the same key from the same user get the first reply again",
+					"schema":      map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	}
+}
+
+func operation(s schemas, op Operation) map[string]interface{} {
+	parameters := []interface{}{}
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		parameters = append(parameters, parameter(match[1], "path", "", true))
+	}
+	for _, q := range op.Query {
+		parameters = append(parameters, parameter(q.Name, "query", q.Description, q.Required))
+	}
+	for _, h := range op.Headers {
+		parameters = append(parameters, parameter(h.Name, "header", h.Description, h.Required))
+	}
+	if op.Method != http.MethodGet {
+		parameters = append(parameters, map[string]interface{}{"$ref": "#/components/parameters/IdempotencyKey"})
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var success map[string]interface{}
+	if op.Raw != "" {
+		success = map[string]interface{}{op.Raw: map[string]interface{}{}}
+	} else {
+		envelope := map[string]interface{}{
+			"type":     "object",
+			"required": []string{"success", "message"},
+			"properties": map[string]interface{}{
+				"success": map[string]interface{}{"type": "boolean"},
+				"message": map[string]interface{}{"type": "string"},
+			},
+		}
+		if op.Data != nil {
+			envelope["properties"].(map[string]interface{})["data"] = s.of(reflect.TypeOf(op.Data))
+		}
+		success = map[string]interface{}{"application/json": map[string]interface{}{"schema": envelope}}
+	}
+
+	doc := map[string]interface{}{
+		"operationId": op.ID,
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"parameters":  parameters,
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): map[string]interface{}{"description": http.StatusText(status), "content": success},
+			"default": map[string]interface{}{
+				"description": "Error envelope",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": ref("ErrorResponse")},
+				},
+			},
+		},
+	}
+	if op.Body != nil {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.of(reflect.TypeOf(op.Body))},
+			},
+		}
+	}
+	return doc
+}
+
+func parameter(name, in, description string, required bool) map[string]interface{} {
+	p := map[string]interface{}{
+		"name":     name,
+		"in":       in,
+		"required": required,
+		"schema":   map[string]interface{}{"type": "string"},
+	}
+	if description != "" {
+		p["description"] = description
+	}
+	return p
+}
+
+var (
+	once    sync.Once
+	encoded []byte
+)
+
+// Handler serves the document, it is built on the first request
+func Handler(c *gin.Context) {
+	once.Do(func() {
+		encoded, _ = json.MarshalIndent(Document(), "", "  ")
+	})
+	c.Data(http.StatusOK, "application/json; charset=utf-8", encoded)
+}
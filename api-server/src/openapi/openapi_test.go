@@ -0,0 +1,90 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/openapi"
+	"github.com/sahilrush/src/services"
+	"github.com/sahilrush/src/transport"
+)
+
+// TestOperationsMatchRouter fails when a route is added or removed without
+// updating Operations
+func TestOperationsMatchRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := services.NewRouter(transport.NewInProc(), nil, nil)
+
+	documented := map[string]bool{}
+	for _, op := range openapi.Operations {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	served := map[string]bool{}
+	for _, route := range router.Routes() {
+		if route.Path == "/" {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		served[key] = true
+		if !documented[key] {
+			t.Errorf("%s is served but not in openapi.Operations", key)
+		}
+	}
+	for key := range documented {
+		if !served[key] {
+			t.Errorf("%s is in openapi.Operations but not served", key)
+		}
+	}
+}
+
+func TestDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	openapi.Handler(c)
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	body := rec.Body.String()
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("document is not JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/v1/orders/{orderId}"]["get"]; !ok {
+		t.Fatalf("GET /v1/orders/{orderId} missing from paths")
+	}
+
+	ids := map[string]bool{}
+	for _, op := range openapi.Operations {
+		if ids[op.ID] {
+			t.Errorf("operation id %s used twice", op.ID)
+		}
+		ids[op.ID] = true
+	}
+
+	// Every reference must point at a schema in components
+	for _, match := range regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(body, -1) {
+		if _, ok := doc.Components.Schemas[match[1]]; !ok {
+			t.Errorf("schema %s is referenced but not defined", match[1])
+		}
+	}
+	for _, name := range []string{"Order", "OrderRequest", "Trade", "Error", "ErrorResponse"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s missing", name)
+		}
+	}
+}
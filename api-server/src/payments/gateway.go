@@ -0,0 +1,160 @@
+package payments
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/models"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the raw webhook body
+const SignatureHeader = "X-Gateway-Signature"
+
+// OperatorHeader carries the platform operator's signature of a request body,
+// made with Sign like a webhook's
+const OperatorHeader = "X-Operator-Signature"
+
+// Sign returns the signature the gateway attaches to a webhook body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a webhook signature in constant time
+func Verify(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Checkout is what the gateway returns when a payment is opened for an intent
+type Checkout struct {
+	Reference string
+	URL       string
+}
+
+// Gateway opens a payment for a deposit intent, the result arrives later on the webhook
+type Gateway interface {
+	CreatePayment(intent models.DepositIntent) (Checkout, error)
+}
+
+// Deposits is the gateway used by the onramp handlers
+var Deposits Gateway = NewStubGateway("", "", config.Current.Payments.WebhookSecret)
+
+// StubGateway is a local payment gateway for tests and development. Serve its
+// Handler at BaseURL; POST /pay/:intentId on it settles the payment and sends a
+// signed callback to WebhookURL like the real gateway would.
+type StubGateway struct {
+	BaseURL    string
+	WebhookURL string
+	Secret     string
+
+	mu       sync.Mutex
+	payments map[string]models.DepositIntent
+}
+
+func NewStubGateway(baseURL, webhookURL, secret string) *StubGateway {
+	return &StubGateway{
+		BaseURL:    baseURL,
+		WebhookURL: webhookURL,
+		Secret:     secret,
+		payments:   map[string]models.DepositIntent{},
+	}
+}
+
+func (g *StubGateway) CreatePayment(intent models.DepositIntent) (Checkout, error) {
+	reference := "stub_" + uuid.NewString()
+	intent.Reference = reference
+
+	g.mu.Lock()
+	g.payments[intent.ID] = intent
+	g.mu.Unlock()
+
+	checkout := Checkout{Reference: reference}
+	if g.BaseURL != "" {
+		checkout.URL = strings.TrimRight(g.BaseURL, "/") + "/pay/" + intent.ID
+	}
+	return checkout, nil
+}
+
+// Complete sends a signed callback with the given status for an intent
+func (g *StubGateway) Complete(intentId, status string) error {
+	g.mu.Lock()
+	intent, ok := g.payments[intentId]
+	g.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown payment for intent %s", intentId)
+	}
+
+	return g.Send(models.GatewayEvent{
+		EventId:   uuid.NewString(),
+		IntentId:  intent.ID,
+		Amount:    intent.Amount,
+		Status:    status,
+		Reference: intent.Reference,
+	})
+}
+
+// Send posts an event to the webhook, exported so tests can replay or tamper with events
+func (g *StubGateway) Send(event models.GatewayEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(g.Secret, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Handler serves the stub checkout: POST /pay/:intentId?status=failed
+func (g *StubGateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pay/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = models.DepositSucceeded
+		}
+
+		intentId := strings.TrimPrefix(r.URL.Path, "/pay/")
+		if err := g.Complete(intentId, status); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,101 @@
+package payments_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "gateway-test-secret"
+	body := []byte(`{"eventId":"evt_1","intentId":"int_1","amount":500,"status":"succeeded"}`)
+	signature := payments.Sign(secret, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		ok        bool
+	}{
+		{"signed", secret, body, signature, true},
+		{"upper case hex", secret, body, strings.ToUpper(signature), true},
+		{"tampered body", secret, []byte(strings.Replace(string(body), "500", "5000", 1)), signature, false},
+		{"other secret", "another-test-secret", body, signature, false},
+		{"no signature", secret, body, "", false},
+		{"not hex", secret, body, "zz" + signature[2:], false},
+		{"truncated", secret, body, signature[:len(signature)-2], false},
+		{"empty body", secret, nil, payments.Sign(secret, nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := payments.Verify(tt.secret, tt.body, tt.signature); got != tt.ok {
+				t.Errorf("Verify = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+// TestStubGateway pays an intent through the stub checkout and checks the
+// callback is signed over the exact body it carries
+func TestStubGateway(t *testing.T) {
+	secret := "gateway-test-secret"
+	events := make(chan models.GatewayEvent, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !payments.Verify(secret, body, r.Header.Get(payments.SignatureHeader)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var event models.GatewayEvent
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	defer webhook.Close()
+
+	gateway := payments.NewStubGateway("http://checkout.test/", webhook.URL, secret)
+	checkout, err := gateway.CreatePayment(models.DepositIntent{ID: "int_1", UserId: "alice", Amount: 500})
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	if checkout.URL != "http://checkout.test/pay/int_1" || !strings.HasPrefix(checkout.Reference, "stub_") {
+		t.Fatalf("checkout = %+v", checkout)
+	}
+
+	stub := httptest.NewServer(gateway.Handler())
+	defer stub.Close()
+	for _, status := range []string{"", models.DepositFailed} {
+		resp, err := http.Post(stub.URL+"/pay/int_1?status="+status, "", nil)
+		if err != nil {
+			t.Fatalf("pay: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("pay status = %d, want 204", resp.StatusCode)
+		}
+
+		want := status
+		if want == "" {
+			want = models.DepositSucceeded
+		}
+		event := <-events
+		if event.IntentId != "int_1" || event.Amount != 500 || event.Status != want || event.Reference != checkout.Reference {
+			t.Errorf("event = %+v, want %s for int_1", event, want)
+		}
+	}
+
+	if err := gateway.Complete("unknown", models.DepositSucceeded); err == nil {
+		t.Error("completing an unknown intent succeeded")
+	}
+
+	wrong := payments.NewStubGateway("", webhook.URL, "another-test-secret")
+	if err := wrong.Send(models.GatewayEvent{EventId: "evt_x", IntentId: "int_1"}); err == nil {
+		t.Error("webhook accepted a callback signed with another secret")
+	}
+}
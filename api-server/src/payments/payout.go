@@ -0,0 +1,64 @@
+package payments
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/sahilrush/src/models"
+)
+
+// Result is what the payout rail reports back for a withdrawal. A pending result
+// means the rail will confirm later through the withdrawal status endpoint.
+type Result struct {
+	Status    string
+	Reference string
+	Reason    string
+}
+
+// Processor pays a withdrawal out to the user's bank account
+type Processor interface {
+	Payout(w models.Withdrawal) Result
+}
+
+// Payouts is the processor used by the offramp handlers, the engine sets it to
+// the configured one on start
+var Payouts Processor
+
+// NewProcessor returns the payout processor called name
+func NewProcessor(name string) (Processor, error) {
+	switch name {
+	case "fake":
+		return &FakeProcessor{Mode: models.WithdrawalCompleted}, nil
+	}
+	return nil, fmt.Errorf("unknown payout processor %q", name)
+}
+
+// FakeProcessor is a local payout rail for tests and development. Mode decides
+// how every payout ends, FailAbove fails payouts larger than the given amount.
+type FakeProcessor struct {
+	Mode      string
+	FailAbove int
+	Submitted []models.Withdrawal
+}
+
+func (p *FakeProcessor) Payout(w models.Withdrawal) Result {
+	p.Submitted = append(p.Submitted, w)
+	reference := "fake_" + uuid.NewString()
+
+	if p.FailAbove > 0 && w.Amount > p.FailAbove {
+		return Result{
+			Status:    models.WithdrawalFailed,
+			Reference: reference,
+			Reason:    fmt.Sprintf("amount above %d", p.FailAbove),
+		}
+	}
+
+	switch p.Mode {
+	case models.WithdrawalFailed:
+		return Result{Status: models.WithdrawalFailed, Reference: reference, Reason: "payout rejected"}
+	case models.WithdrawalPending:
+		return Result{Status: models.WithdrawalPending, Reference: reference}
+	default:
+		return Result{Status: models.WithdrawalCompleted, Reference: reference}
+	}
+}
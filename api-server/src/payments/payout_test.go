@@ -0,0 +1,24 @@
+package payments_test
+
+import (
+	"testing"
+
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+func TestNewProcessor(t *testing.T) {
+	processor, err := payments.NewProcessor("fake")
+	if err != nil {
+		t.Fatalf("NewProcessor(fake) = %v", err)
+	}
+	if result := processor.Payout(models.Withdrawal{ID: "w1", Amount: 10}); result.Status != models.WithdrawalCompleted {
+		t.Errorf("fake payout = %+v, want completed", result)
+	}
+
+	for _, name := range []string{"", "bank"} {
+		if _, err := payments.NewProcessor(name); err == nil {
+			t.Errorf("NewProcessor(%q) picked a processor", name)
+		}
+	}
+}
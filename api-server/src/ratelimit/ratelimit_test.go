@@ -0,0 +1,79 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sahilrush/src/ratelimit"
+)
+
+func TestMemoryBurst(t *testing.T) {
+	limiter := ratelimit.NewMemory()
+	defer limiter.Close()
+	// A rate this low refills nothing while the test runs
+	limit := ratelimit.Limit{Rate: 0.001, Burst: 3}
+
+	tests := []struct {
+		key       string
+		allowed   bool
+		remaining int
+	}{
+		{"alice", true, 2},
+		{"alice", true, 1},
+		{"alice", true, 0},
+		{"alice", false, 0},
+		{"bob", true, 2},
+		{"alice", false, 0},
+	}
+	for i, tt := range tests {
+		result, err := limiter.Allow(context.Background(), tt.key, limit)
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if result.Allowed != tt.allowed || result.Remaining != tt.remaining {
+			t.Errorf("call %d for %s = %+v, want allowed %v with %d left", i, tt.key, result, tt.allowed, tt.remaining)
+		}
+		if !result.Allowed && result.RetryAfter <= 0 {
+			t.Errorf("call %d refused without a RetryAfter", i)
+		}
+	}
+}
+
+func TestMemoryRefill(t *testing.T) {
+	limiter := ratelimit.NewMemory()
+	limit := ratelimit.Limit{Rate: 50, Burst: 1}
+	allow := func() ratelimit.Result {
+		t.Helper()
+		result, err := limiter.Allow(context.Background(), "alice", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if !allow().Allowed {
+		t.Fatal("first call refused")
+	}
+	refused := allow()
+	if refused.Allowed {
+		t.Fatal("second call allowed with an empty bucket")
+	}
+	if refused.RetryAfter > 20*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want at most one token's time of 20ms", refused.RetryAfter)
+	}
+
+	time.Sleep(refused.RetryAfter + 5*time.Millisecond)
+	if !allow().Allowed {
+		t.Error("call after RetryAfter refused")
+	}
+
+	// Waiting longer never fills the bucket past its burst
+	time.Sleep(60 * time.Millisecond)
+	if result := allow(); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after a long wait = %+v, want one token", result)
+	}
+	if allow().Allowed {
+		t.Error("bucket held more than its burst")
+	}
+}
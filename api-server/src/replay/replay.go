@@ -0,0 +1,124 @@
+// Package replay makes a command come out the same when the engine runs it
+// again from its command log after a restart. Commands take their IDs, clock
+// readings and the answers of outside systems from here instead of uuid,
+// time.Now or the outside system directly. While the engine records a command
+// they are drawn fresh and written to a Tape; while it replays one they are
+// read back from the tape in the same order.
+//
+// Outside a recording or a replay, queries and tests for instance, the values
+// are simply drawn fresh. Like the rest of the engine state the tape is
+// guarded by the engine lock.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tape holds what a command drew, in the order it drew it
+type Tape struct {
+	IDs    []string          `json:"ids,omitempty"`
+	Times  []time.Time       `json:"times,omitempty"`
+	Values []json.RawMessage `json:"values,omitempty"`
+}
+
+type head struct {
+	ids, times, values int
+}
+
+var (
+	tape    *Tape
+	playing bool
+	read    head
+	// missed counts draws a replayed command made past the end of its tape
+	missed int
+)
+
+// Record starts a tape for the command about to run
+func Record() {
+	tape, playing, missed = &Tape{}, false, 0
+}
+
+// Play replays a recorded tape to the command about to run
+func Play(recorded Tape) {
+	tape, playing, read, missed = &recorded, true, head{}, 0
+}
+
+// Stop ends the recording or replay and returns the tape. A replayed command
+// that drew more or fewer values than it recorded took a different path the
+// second time, Stop reports it.
+func Stop() (Tape, error) {
+	if tape == nil {
+		return Tape{}, nil
+	}
+	done := *tape
+	var err error
+	if playing && (missed > 0 || read != (head{len(done.IDs), len(done.Times), len(done.Values)})) {
+		err = fmt.Errorf("replay diverged: drew %d ids, %d times and %d values (%d past the end), recorded %d, %d and %d",
+			read.ids, read.times, read.values, missed, len(done.IDs), len(done.Times), len(done.Values))
+	}
+	tape, playing = nil, false
+	return done, err
+}
+
+// NewID returns a new unique ID
+func NewID() string {
+	switch {
+	case tape == nil:
+		return uuid.NewString()
+	case playing && read.ids < len(tape.IDs):
+		read.ids++
+		return tape.IDs[read.ids-1]
+	case playing:
+		missed++
+		return uuid.NewString()
+	}
+	id := uuid.NewString()
+	tape.IDs = append(tape.IDs, id)
+	return id
+}
+
+// Now returns the current time
+func Now() time.Time {
+	switch {
+	case tape == nil:
+		return time.Now()
+	case playing && read.times < len(tape.Times):
+		read.times++
+		return tape.Times[read.times-1]
+	case playing:
+		missed++
+		return time.Now()
+	}
+	now := time.Now()
+	tape.Times = append(tape.Times, now)
+	return now
+}
+
+// Value returns what fetch returns. fetch asks something outside the engine,
+// such as the payout rail, so a replay reads the answer from the tape rather
+// than asking again; a replay that has no answer left gets the zero value,
+// never a second call. T must survive a round trip through JSON.
+func Value[T any](fetch func() T) T {
+	var value T
+	if tape != nil && playing {
+		if read.values < len(tape.Values) {
+			read.values++
+			if json.Unmarshal(tape.Values[read.values-1], &value) == nil {
+				return value
+			}
+		}
+		missed++
+		return value
+	}
+
+	value = fetch()
+	if tape != nil {
+		data, _ := json.Marshal(value)
+		tape.Values = append(tape.Values, data)
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package replay_test
+
+import (
+	"testing"
+
+	"github.com/sahilrush/src/replay"
+)
+
+// run draws what a command would: an ID, the time and an outside answer
+func run(calls *int) (string, int64, int) {
+	id := replay.NewID()
+	now := replay.Now().UnixNano()
+	answer := replay.Value(func() int { *calls++; return *calls * 10 })
+	return id, now, answer
+}
+
+func TestReplay(t *testing.T) {
+	calls := 0
+	replay.Record()
+	id, now, answer := run(&calls)
+	tape, err := replay.Stop()
+	if err != nil || len(tape.IDs) != 1 || len(tape.Times) != 1 || len(tape.Values) != 1 {
+		t.Fatalf("recorded tape = %+v, %v", tape, err)
+	}
+
+	replay.Play(tape)
+	againID, againNow, againAnswer := run(&calls)
+	if _, err := replay.Stop(); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+	if againID != id || againNow != now || againAnswer != answer {
+		t.Errorf("replayed %s %d %d, recorded %s %d %d", againID, againNow, againAnswer, id, now, answer)
+	}
+	if calls != 1 {
+		t.Errorf("outside system asked %d times, want once", calls)
+	}
+
+	// Outside a recording values are drawn fresh and nothing is kept
+	if fresh, _, _ := run(&calls); fresh == id || calls != 2 {
+		t.Errorf("fresh draw = %s after %d calls", fresh, calls)
+	}
+	if tape, err := replay.Stop(); err != nil || len(tape.IDs) != 0 {
+		t.Errorf("Stop without a tape = %+v, %v", tape, err)
+	}
+}
+
+func TestReplayDiverged(t *testing.T) {
+	calls := 0
+	replay.Record()
+	replay.NewID()
+	tape, _ := replay.Stop()
+
+	tests := []struct {
+		name string
+		draw func()
+	}{
+		{"fewer draws", func() {}},
+		{"more draws", func() { replay.NewID(); replay.NewID() }},
+		{"a value never recorded", func() { replay.NewID(); replay.Value(func() int { calls++; return 1 }) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replay.Play(tape)
+			tt.draw()
+			if _, err := replay.Stop(); err == nil {
+				t.Error("Stop reported no divergence")
+			}
+		})
+	}
+	if calls != 0 {
+		t.Errorf("a replay asked the outside system %d times", calls)
+	}
+}
@@ -0,0 +1,177 @@
+package risk
+
+import (
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/models"
+)
+
+// Order is the view of an incoming order the risk checks work on
+type Order struct {
+	UserId   string
+	Symbol   string
+	Outcome  string // "yes" or "no"
+	Side     string // "buy" or "sell"
+	Type     string // "limit" or "market"
+	Price    int
+	Quantity int
+}
+
+// Check inspects an order and returns why it must not be placed, if it must not
+type Check func(o Order) *apierr.Error
+
+var checks = []Check{
+	MarketOpen,
+	MaxOrderQuantity,
+	MaxNotional,
+	PositionLimit,
+	MaxOpenOrders,
+	PriceBand,
+}
+
+// Register adds a check that runs after the default ones
+func Register(check Check) {
+	checks = append(checks, check)
+}
+
+// Validate runs every registered check and returns the first failure
+func Validate(o Order) *apierr.Error {
+	for _, check := range checks {
+		if err := check(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarketOpen rejects orders on markets that have already been settled
+func MarketOpen(o Order) *apierr.Error {
+	outcome, resolved := models.ResolvedMarkets[o.Symbol]
+	if !resolved {
+		return nil
+	}
+	return apierr.New(apierr.MarketResolved, "Market has already been resolved").With(map[string]interface{}{
+		"outcome": outcome,
+	})
+}
+
+func MaxOrderQuantity(o Order) *apierr.Error {
+	limit := config.Current.Risk.MaxOrderQuantity
+	if limit <= 0 || o.Quantity <= limit {
+		return nil
+	}
+	return apierr.New(apierr.MaxOrderQuantity, "Order quantity exceeds the maximum allowed").With(map[string]interface{}{
+		"limit": limit, "requested": o.Quantity,
+	})
+}
+
+func MaxNotional(o Order) *apierr.Error {
+	limit := config.Current.Risk.MaxNotional
+	notional := o.Price * o.Quantity
+	if limit <= 0 || notional <= limit {
+		return nil
+	}
+	return apierr.New(apierr.MaxNotional, "Order notional exceeds the maximum allowed").With(map[string]interface{}{
+		"limit": limit, "requested": notional,
+	})
+}
+
+// PositionLimit caps the YES or NO holding a user can build up in one market.
+// The shares their open buys would add count as held.
+func PositionLimit(o Order) *apierr.Error {
+	limit := config.Current.Risk.MaxPosition
+	if limit <= 0 || o.Side != "buy" {
+		return nil
+	}
+
+	held := 0
+	if users, ok := models.Stock_Balances[o.Symbol]; ok {
+		if outcome, ok := users[o.UserId][o.Outcome]; ok {
+			held = outcome.Quantity + outcome.Locked
+		}
+	}
+	held += OpenBuys(o.UserId, o.Symbol, o.Outcome)
+
+	if held+o.Quantity <= limit {
+		return nil
+	}
+	return apierr.New(apierr.PositionLimit, "Order would exceed the position limit for this market").With(map[string]interface{}{
+		"limit": limit, "held": held, "requested": o.Quantity,
+	})
+}
+
+// MaxOpenOrders caps the orders a user has resting across all books
+func MaxOpenOrders(o Order) *apierr.Error {
+	limit := config.Current.Risk.MaxOpenOrders
+	if limit <= 0 {
+		return nil
+	}
+
+	open := OpenOrders(o.UserId)
+	if open < limit {
+		return nil
+	}
+	return apierr.New(apierr.MaxOpenOrders, "Too many open orders").With(map[string]interface{}{
+		"limit": limit, "open": open,
+	})
+}
+
+// PriceBand rejects orders priced too far away from the last traded price.
+// Market orders have no price of their own and are not checked.
+func PriceBand(o Order) *apierr.Error {
+	band := config.Current.Risk.PriceBand
+	if band <= 0 || o.Type == models.OrderMarket {
+		return nil
+	}
+
+	last, ok := models.LastTradedPrice[o.Symbol][o.Outcome]
+	if !ok {
+		return nil
+	}
+
+	diff := o.Price - last
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff <= band {
+		return nil
+	}
+	return apierr.New(apierr.PriceOutsideBand, "Order price is too far from the last traded price").With(map[string]interface{}{
+		"lastPrice": last, "band": band, "price": o.Price,
+	})
+}
+
+// OpenBuys returns the quantity of outcome the user's resting buys in a market
+// are still after. A buy rests as an inverse order on the other outcome.
+func OpenBuys(userId, symbol, outcome string) int {
+	side := models.Orderbooks[symbol].No
+	if outcome == "no" {
+		side = models.Orderbooks[symbol].Yes
+	}
+	quantity := 0
+	for _, level := range side {
+		for _, order := range level.Orders {
+			if order.UserId == userId && order.Type == "inverse" {
+				quantity += order.Quantity
+			}
+		}
+	}
+	return quantity
+}
+
+// OpenOrders returns the number of resting orders the user has
+func OpenOrders(userId string) int {
+	count := 0
+	for _, pricing := range models.Orderbooks {
+		for _, side := range []map[int]models.OrderType{pricing.Yes, pricing.No} {
+			for _, level := range side {
+				for _, order := range level.Orders {
+					if order.UserId == userId {
+						count++
+					}
+				}
+			}
+		}
+	}
+	return count
+}
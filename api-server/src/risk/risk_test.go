@@ -0,0 +1,121 @@
+package risk_test
+
+import (
+	"testing"
+
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/risk"
+)
+
+// limits sets the risk limits for one test
+func limits(t *testing.T, l config.Risk) {
+	saved := config.Current.Risk
+	config.Current.Risk = l
+	t.Cleanup(func() { config.Current.Risk = saved })
+}
+
+func TestValidate(t *testing.T) {
+	limits(t, config.Risk{MaxOrderQuantity: 100, MaxNotional: 500, MaxPosition: 150, MaxOpenOrders: 2, PriceBand: 2})
+
+	models.ResolvedMarkets["DONE"] = "yes"
+	models.LastTradedPrice["BAND"] = map[string]int{"yes": 5}
+	models.Stock_Balances["HELD"] = models.User{"alice": {"yes": {Quantity: 100, Locked: 40}}}
+	// A resting buy of YES at 6 waits as an inverse order on NO at 4
+	models.Stock_Balances["BIDS"] = models.User{"bidder": {"yes": {Quantity: 100}}}
+	models.Orderbooks["BIDS"] = models.Pricing{
+		Yes: map[int]models.OrderType{},
+		No: map[int]models.OrderType{4: {Total: 45, Orders: []models.Orders{
+			{OrderId: "d", UserId: "bidder", Quantity: 45, Type: "inverse"},
+		}}},
+	}
+	models.Orderbooks["OPEN"] = models.Pricing{
+		Yes: map[int]models.OrderType{6: {Total: 2, Orders: []models.Orders{
+			{OrderId: "a", UserId: "busy", Quantity: 1, Type: "sell"},
+			{OrderId: "b", UserId: "idle", Quantity: 1, Type: "sell"},
+		}}},
+		No: map[int]models.OrderType{3: {Total: 1, Orders: []models.Orders{
+			{OrderId: "c", UserId: "busy", Quantity: 1, Type: "inverse"},
+		}}},
+	}
+	t.Cleanup(func() {
+		delete(models.ResolvedMarkets, "DONE")
+		delete(models.LastTradedPrice, "BAND")
+		delete(models.Stock_Balances, "HELD")
+		delete(models.Stock_Balances, "BIDS")
+		delete(models.Orderbooks, "BIDS")
+		delete(models.Orderbooks, "OPEN")
+	})
+
+	order := func(change func(*risk.Order)) risk.Order {
+		o := risk.Order{UserId: "alice", Symbol: "FREE", Outcome: "yes", Side: "buy", Type: models.OrderLimit, Price: 5, Quantity: 10}
+		change(&o)
+		return o
+	}
+
+	tests := []struct {
+		name  string
+		order risk.Order
+		want  apierr.Code
+	}{
+		{"passes", order(func(o *risk.Order) {}), ""},
+		{"resolved market", order(func(o *risk.Order) { o.Symbol = "DONE" }), apierr.MarketResolved},
+		{"quantity at limit", order(func(o *risk.Order) { o.Quantity, o.Price = 100, 1 }), ""},
+		{"quantity over limit", order(func(o *risk.Order) { o.Quantity, o.Price = 101, 1 }), apierr.MaxOrderQuantity},
+		{"notional at limit", order(func(o *risk.Order) { o.Quantity = 100 }), ""},
+		{"notional over limit", order(func(o *risk.Order) { o.Quantity, o.Price = 84, 6 }), apierr.MaxNotional},
+		{"position counts locked shares", order(func(o *risk.Order) { o.Symbol, o.Quantity = "HELD", 11 }), apierr.PositionLimit},
+		{"position up to limit", order(func(o *risk.Order) { o.Symbol = "HELD" }), ""},
+		{"position counts open buys", order(func(o *risk.Order) { o.UserId, o.Symbol, o.Quantity = "bidder", "BIDS", 6 }), apierr.PositionLimit},
+		{"position up to limit with open buys", order(func(o *risk.Order) { o.UserId, o.Symbol, o.Quantity = "bidder", "BIDS", 5 }), ""},
+		{"sells add no position", order(func(o *risk.Order) { o.Symbol, o.Side, o.Quantity = "HELD", "sell", 100 }), ""},
+		{"open orders at limit", order(func(o *risk.Order) { o.UserId = "busy" }), apierr.MaxOpenOrders},
+		{"open orders under limit", order(func(o *risk.Order) { o.UserId = "idle" }), ""},
+		{"inside band", order(func(o *risk.Order) { o.Symbol, o.Price = "BAND", 7 }), ""},
+		{"above band", order(func(o *risk.Order) { o.Symbol, o.Price = "BAND", 8 }), apierr.PriceOutsideBand},
+		{"below band", order(func(o *risk.Order) { o.Symbol, o.Price = "BAND", 2 }), apierr.PriceOutsideBand},
+		{"band is per outcome", order(func(o *risk.Order) { o.Symbol, o.Outcome, o.Price = "BAND", "no", 9 }), ""},
+		{"market orders skip the band", order(func(o *risk.Order) { o.Symbol, o.Type, o.Price = "BAND", models.OrderMarket, 9 }), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got apierr.Code
+			if err := risk.Validate(tt.order); err != nil {
+				got = err.Code
+			}
+			if got != tt.want {
+				t.Errorf("Validate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZeroLimitsDisableChecks(t *testing.T) {
+	limits(t, config.Risk{})
+	models.LastTradedPrice["ZERO"] = map[string]int{"yes": 1}
+	t.Cleanup(func() { delete(models.LastTradedPrice, "ZERO") })
+
+	o := risk.Order{UserId: "alice", Symbol: "ZERO", Outcome: "yes", Side: "buy", Type: models.OrderLimit, Price: 9, Quantity: 1 << 20}
+	if err := risk.Validate(o); err != nil {
+		t.Fatalf("Validate = %v, want every check switched off", err)
+	}
+}
+
+func TestOpenOrders(t *testing.T) {
+	models.Orderbooks["COUNT"] = models.Pricing{
+		Yes: map[int]models.OrderType{4: {Total: 3, Orders: []models.Orders{
+			{OrderId: "a", UserId: "bob", Quantity: 1, Type: "sell"},
+			{OrderId: "b", UserId: "bob", Quantity: 2, Type: "inverse"},
+		}}},
+		No: map[int]models.OrderType{},
+	}
+	t.Cleanup(func() { delete(models.Orderbooks, "COUNT") })
+
+	if got := risk.OpenOrders("bob"); got != 2 {
+		t.Errorf("OpenOrders(bob) = %d, want both orders on the level counted", got)
+	}
+	if got := risk.OpenOrders("nobody"); got != 0 {
+		t.Errorf("OpenOrders(nobody) = %d, want 0", got)
+	}
+}
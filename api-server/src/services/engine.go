@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/payments"
+	"github.com/sahilrush/src/transport"
+)
+
+// RunEngine loads the engine's persisted state and serves requests from the
+// transport until ctx is done. Each command is in the command log before it is
+// acknowledged; the command being processed when ctx ends finishes first, then
+// the snapshot is written once more.
+func RunEngine(ctx context.Context, t transport.Transport) error {
+	// A local stub gateway settles deposit intents when one is configured
+	secret := config.Current.Payments.WebhookSecret
+	if addr := config.Current.Payments.StubGatewayAddr; addr != "" {
+		gateway := payments.NewStubGateway("http://"+addr, config.Current.Server.PublicURL+"/onramp/webhook", secret)
+		payments.Deposits = gateway
+		go http.ListenAndServe(addr, gateway.Handler())
+	} else {
+		payments.Deposits = payments.NewStubGateway("", "", secret)
+	}
+
+	processor, err := payments.NewProcessor(config.Current.Payments.PayoutProcessor)
+	if err != nil {
+		return err
+	}
+	payments.Payouts = processor
+
+	router := gin.New()
+	router.Use(apierr.Recovery())
+	SetupEngineRoutes(router)
+
+	if err := engine.Open(router); err != nil {
+		return err
+	}
+
+	engine.RegisterMetrics()
+	engine.StartChecker(ctx, time.Duration(config.Current.Engine.InvariantInterval))
+
+	publish := func(topic string, payload []byte) {
+		if err := t.Publish(ctx, topic, payload); err != nil {
+			slog.Warn("failed to publish event", "topic", topic, "error", err)
+		}
+	}
+	go sendHeartbeats(ctx, publish)
+
+	serveErr := t.Serve(ctx, engine.NewHandler(router, publish))
+
+	if err := engine.Close(); err != nil {
+		return errors.Join(serveErr, err)
+	}
+	slog.Info("engine state saved", "path", config.Current.Engine.SnapshotPath)
+	return serveErr
+}
+
+// sendHeartbeats tells API servers the engine is alive until ctx is done
+func sendHeartbeats(ctx context.Context, publish func(topic string, payload []byte)) {
+	name := config.Current.Engine.Consumer
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	ticker := time.NewTicker(time.Duration(config.Current.Engine.HeartbeatInterval))
+	defer ticker.Stop()
+	for {
+		payload, _ := json.Marshal(heartbeat{Engine: name, At: time.Now()})
+		publish(heartbeatTopic, payload)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
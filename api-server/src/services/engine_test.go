@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/ledger"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/payments"
+)
+
+// engineState is everything a replay has to bring back, as JSON
+func engineState(t *testing.T) string {
+	t.Helper()
+	data, err := json.Marshal([]any{
+		models.INR_BALANCES, models.Orderbooks, models.Stock_Balances, models.PlacedOrders,
+		models.Trades, models.Withdrawals, models.DepositIntents, amm.Makers, ledger.Journal,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestEngineReplay runs a session through the engine's routes, then starts
+// again from the snapshot taken before it and the session's command log. The
+// replay has to land on the same state without paying anything out again.
+func TestEngineReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Setup(io.Discard, "error", "text")
+	dir := t.TempDir()
+	saved, savedPayouts := config.Current, payments.Payouts
+	t.Cleanup(func() { config.Current, payments.Payouts = saved, savedPayouts })
+	config.Current = config.Defaults()
+	config.Current.Features.AutoBalance = true
+	config.Current.Payments.WebhookSecret = "replay-webhook-secret"
+	config.Current.Engine.CommandLog = filepath.Join(dir, "commands.log")
+	config.Current.Engine.SnapshotPath = filepath.Join(dir, "snapshot.json")
+	rail := &payments.FakeProcessor{Mode: models.WithdrawalCompleted}
+	payments.Payouts = rail
+
+	router := gin.New()
+	router.Use(apierr.Recovery())
+	SetupEngineRoutes(router)
+	if err := engine.Open(router); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	before, _ := os.ReadFile(config.Current.Engine.SnapshotPath)
+
+	send := func(method, target string, body any) json.RawMessage {
+		t.Helper()
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, target, strings.NewReader(string(payload)))
+		req.Header.Set(payments.SignatureHeader, payments.Sign(config.Current.Payments.WebhookSecret, payload))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var reply struct {
+			Success bool
+			Data    json.RawMessage
+		}
+		json.Unmarshal(rec.Body.Bytes(), &reply)
+		if !reply.Success {
+			t.Fatalf("%s %s: %d %s", method, target, rec.Code, rec.Body)
+		}
+		return reply.Data
+	}
+	send(http.MethodPost, "/user/create", models.CreateUser{UserId: "replay-alice"})
+	var intent models.DepositIntent
+	json.Unmarshal(send(http.MethodPost, "/onramp/inr", models.OnrampUser{UserId: "replay-alice", Amount: 500}), &intent)
+	send(http.MethodPost, "/onramp/webhook", models.GatewayEvent{EventId: "replay-paid", IntentId: intent.ID,
+		Amount: intent.Amount, Status: models.DepositSucceeded, Reference: intent.Reference})
+	send(http.MethodPost, "/symbol/create", models.CreateSymbol{UserId: "replay-alice", Stock: "REPLAY", Amm: &models.MakerSeed{Liquidity: 10}})
+	send(http.MethodPost, "/v1/orders", models.OrderRequest{UserId: "replay-bob", Symbol: "REPLAY", Side: "buy", Outcome: "yes", Price: 7, Quantity: 5})
+	send(http.MethodPost, "/v1/orders", models.OrderRequest{UserId: "replay-alice", Symbol: "REPLAY", Side: "sell", Outcome: "no", Price: 5, Quantity: 3})
+	send(http.MethodPost, "/offramp/inr", models.OfframpUser{UserId: "replay-bob", Amount: 50})
+	send(http.MethodPost, "/symbol/resolve", models.ResolveSymbol{Stock: "REPLAY", Outcome: "yes"})
+
+	logged, _ := os.ReadFile(config.Current.Engine.CommandLog)
+	first, paid := engineState(t), len(rail.Submitted)
+	if err := engine.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	os.WriteFile(config.Current.Engine.SnapshotPath, before, 0o644)
+	os.WriteFile(config.Current.Engine.CommandLog, logged, 0o644)
+	if err := engine.Open(router); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer engine.Close()
+
+	if replayed := engineState(t); replayed != first {
+		t.Errorf("replayed state differs:\n%s\nwant\n%s", replayed, first)
+	}
+	if len(rail.Submitted) != paid {
+		t.Errorf("replay paid out %d more withdrawals", len(rail.Submitted)-paid)
+	}
+}
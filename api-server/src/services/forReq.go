@@ -2,114 +2,171 @@ package services
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"log"
-	"net/http"
+	"errors"
+	"fmt"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tracing"
+	"github.com/sahilrush/src/transport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	redisClient     *redis.Client
-	redisSubscriber *redis.Client
-	ctx             = context.Background()
-	queueName       = "apiToEngine"
-)
+// forwardedHeaders are the request headers the engine handlers read
+var forwardedHeaders = []string{
+	"Content-Type",
+	"Idempotency-Key",
+	"X-Gateway-Signature",
+	"X-Operator-Signature",
+}
 
-type QueueData struct {
-	ID       string `json:"_id"`
-	Endpoint string `json:"endpoint"`
-	Req      struct {
-		Body   interface{}       `json:"body"`
-		Params map[string]string `json:"params"`
-	} `json:"req"`
+// redisTLS returns the TLS settings for the configured Redis, nil for plain TCP
+func redisTLS() *tls.Config {
+	if !config.Current.Redis.TLS {
+		return nil
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12}
 }
 
-func init() {
-	// Initialize Redis clients
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
+func newRedisClient() *redis.Client {
+	cfg := config.Current.Redis
+	return redis.NewClient(&redis.Options{
+		Addr:      cfg.Addr,
+		Password:  cfg.Password,
+		DB:        cfg.DB,
+		TLSConfig: redisTLS(),
 	})
+}
 
-	redisSubscriber = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-	})
+// NewTransport returns the configured transport: "redis" for separate API
+// server and engine processes, "inproc" to run the engine inside the API server
+func NewTransport() (transport.Transport, error) {
+	switch mode := config.Current.Queue.Transport; mode {
+	case "redis":
+		return NewRedisTransport(), nil
+	case "inproc":
+		return transport.NewInProc(), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", mode)
+	}
+}
+
+// NewRedisTransport returns the Redis transport on the configured engine queue
+func NewRedisTransport() *transport.Redis {
+	queue, engine := config.Current.Queue, config.Current.Engine
+
+	// The engine publishes replies on the instance's own channel
+	instanceID := config.Current.Server.InstanceID
+	if instanceID == "" {
+		instanceID = uuid.NewString()
+	}
+
+	consumer := engine.Consumer
+	if consumer == "" {
+		consumer, _ = os.Hostname()
+	}
+
+	return &transport.Redis{
+		Client:      newRedisClient(),
+		Subscriber:  newRedisClient(),
+		Stream:      queue.Stream,
+		MaxLen:      queue.MaxLen,
+		InstanceID:  instanceID,
+		ReplyPrefix: queue.ReplyPrefix,
+		Group:       queue.Group,
+		Consumer:    consumer,
+		ClaimIdle:   time.Duration(engine.ClaimIdle),
+	}
 }
 
-// ForwardReq returns a handler function for the given endpoint
-func ForwardReq(endpoint string) gin.HandlerFunc {
+// ForwardReq returns a handler function for the given endpoint. It sends the
+// request over the transport, then blocks until the engine answers, the
+// client goes away or the configured reply timeout passes.
+func ForwardReq(t transport.Transport, endpoint string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		payload := QueueData{
-			ID:       uuid.NewString(),
+		payload := models.QueueData{
+			ID:       requestID(c),
 			Endpoint: endpoint,
+			Method:   c.Request.Method,
 		}
 
-		// Bind request body
-		if err := c.ShouldBindJSON(&payload.Req.Body); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"success": false,
-				"message": "Invalid request payload",
-			})
+		// Keep the raw body, some handlers verify signatures over the exact bytes
+		body, err := c.GetRawData()
+		if err != nil || (len(body) > 0 && !json.Valid(body)) {
+			apierr.Respond(c, apierr.New(apierr.InvalidRequest, "Invalid request payload"))
 			return
 		}
+		if len(body) > 0 {
+			payload.Req.Body = body
+		}
 
 		// Bind URL parameters
 		payload.Req.Params = make(map[string]string)
 		for _, param := range c.Params {
 			payload.Req.Params[param.Key] = param.Value
 		}
+		payload.Req.Query = c.Request.URL.RawQuery
 
-		// Convert payload to JSON
-		payloadJSON, err := json.Marshal(payload)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": "Failed to process request payload",
-			})
-			return
+		payload.Headers = make(map[string]string)
+		for _, header := range forwardedHeaders {
+			if value := c.GetHeader(header); value != "" {
+				payload.Headers[header] = value
+			}
 		}
 
-		// Subscribe and forward to queue
-		go func() {
-			pubsub := redisSubscriber.Subscribe(ctx, payload.ID)
-			defer pubsub.Close()
+		// The span covers the queue and the engine, the engine continues the trace
+		spanCtx, span := tracing.Start(c.Request.Context(), "forward "+endpoint,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.String(logging.RequestID, payload.ID)),
+		)
+		defer span.End()
+		payload.Trace = tracing.Inject(spanCtx)
+		payload.SentAt = time.Now()
 
-			_, err := pubsub.Receive(ctx)
-			if err != nil {
-				log.Printf("Subscription error: %v\n", err)
-				return
-			}
+		reqCtx, cancel := context.WithTimeout(spanCtx, time.Duration(config.Current.Queue.ReplyTimeout))
+		defer cancel()
 
-			ch := pubsub.Channel()
-			for msg := range ch {
-				var response struct {
-					StatusCode int         `json:"statusCode"`
-					Data       interface{} `json:"data"`
-				}
-				if err := json.Unmarshal([]byte(msg.Payload), &response); err != nil {
-					log.Printf("Failed to unmarshal message: %v\n", err)
-					return
-				}
-
-				// Send the response back to the client
-				c.JSON(response.StatusCode, response.Data)
-				break
+		response, err := t.Request(reqCtx, payload)
+		if err != nil {
+			if reqCtx.Err() == nil {
+				logging.From(c).Error("failed to forward request", "error", err)
 			}
-		}()
-
-		// Push the payload to the queue
-		if err := redisClient.LPush(ctx, queueName, payloadJSON).Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": "Failed to forward request",
-			})
+			tracing.Fail(span, err)
+			respondWaitError(c, reqCtx)
 			return
 		}
+		span.SetAttributes(attribute.Int("engine.status_code", response.StatusCode))
+
+		// Send the response back to the client
+		for key, value := range response.Headers {
+			c.Header(key, value)
+		}
+		c.Data(response.StatusCode, "application/json; charset=utf-8", response.Data)
+	}
+}
+
+// respondWaitError answers a request whose engine reply never arrived. Nothing
+// is written when the client cancelled, there is nobody left to read it.
+func respondWaitError(c *gin.Context, reqCtx context.Context) {
+	if c.Request.Context().Err() != nil {
+		c.Abort()
+		return
 	}
+
+	if errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+		apierr.Respond(c, apierr.New(apierr.EngineTimeout, "Engine did not reply in time"))
+		return
+	}
+
+	apierr.Respond(c, apierr.New(apierr.EngineUnavailable, "Failed to forward request"))
 }
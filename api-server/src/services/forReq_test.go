@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/transport"
+)
+
+// stubTransport answers requests with reply, which sees the request's context
+type stubTransport struct {
+	transport.Transport
+	reply func(ctx context.Context, data models.QueueData) (models.EngineReply, error)
+}
+
+func (s stubTransport) Request(ctx context.Context, data models.QueueData) (models.EngineReply, error) {
+	return s.reply(ctx, data)
+}
+
+// silent never replies, it returns when the request is given up
+func silent(ctx context.Context, _ models.QueueData) (models.EngineReply, error) {
+	<-ctx.Done()
+	return models.EngineReply{}, ctx.Err()
+}
+
+func TestForwardReq(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Setup(io.Discard, "error", "text")
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+	config.Current.Queue.ReplyTimeout = config.Duration(20 * time.Millisecond)
+
+	tests := []struct {
+		name  string
+		reply func(context.Context, models.QueueData) (models.EngineReply, error)
+		// cancel has the client give up as soon as the request is sent
+		cancel bool
+		status int
+		code   apierr.Code
+	}{
+		{"engine replies", func(_ context.Context, data models.QueueData) (models.EngineReply, error) {
+			return models.EngineReply{ID: data.ID, StatusCode: http.StatusCreated, Data: []byte(`{"success":true}`)}, nil
+		}, false, http.StatusCreated, ""},
+		{"engine never replies", silent, false, http.StatusGatewayTimeout, apierr.EngineTimeout},
+		{"transport down", func(context.Context, models.QueueData) (models.EngineReply, error) {
+			return models.EngineReply{}, errors.New("connection refused")
+		}, false, http.StatusServiceUnavailable, apierr.EngineUnavailable},
+		{"client cancels", silent, true, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var gaveUp error
+			stub := stubTransport{reply: func(reqCtx context.Context, data models.QueueData) (models.EngineReply, error) {
+				if tt.cancel {
+					cancel()
+				}
+				reply, err := tt.reply(reqCtx, data)
+				gaveUp = reqCtx.Err()
+				return reply, err
+			}}
+			router := gin.New()
+			router.POST("/order", ForwardReq(stub, "/order"))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(`{"userId":"alice"}`)).WithContext(ctx)
+			started := time.Now()
+			router.ServeHTTP(rec, req)
+
+			if tt.cancel {
+				if !errors.Is(gaveUp, context.Canceled) || rec.Body.Len() != 0 {
+					t.Errorf("client gone: request ended with %v and wrote %q", gaveUp, rec.Body)
+				}
+				if waited := time.Since(started); waited >= time.Duration(config.Current.Queue.ReplyTimeout) {
+					t.Errorf("waited %v for a client that had gone", waited)
+				}
+				return
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var body struct {
+				Error *apierr.Error `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if tt.code != "" && (body.Error == nil || body.Error.Code != tt.code) {
+				t.Errorf("error = %+v, want %s", body.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"inproc", "*transport.InProc"},
+		{"redis", "*transport.Redis"},
+		{"kafka", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config.Current.Queue.Transport = tt.mode
+			got, err := NewTransport()
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("transport %q accepted", tt.mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTransport: %v", err)
+			}
+			defer got.Close()
+			if kind := fmt.Sprintf("%T", got); kind != tt.want {
+				t.Errorf("transport %q is a %s, want %s", tt.mode, kind, tt.want)
+			}
+		})
+	}
+}
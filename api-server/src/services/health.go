@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/transport"
+)
+
+// heartbeatTopic carries the engine's periodic sign of life
+const heartbeatTopic = "heartbeat"
+
+type heartbeat struct {
+	Engine string    `json:"engine"`
+	At     time.Time `json:"at"`
+}
+
+// Health tracks what the API server needs to serve requests: a working
+// transport and an engine that has sent a heartbeat recently
+type Health struct {
+	t        transport.Transport
+	draining atomic.Bool
+
+	mu       sync.Mutex
+	lastBeat heartbeat
+	seenAt   time.Time
+}
+
+// NewHealth starts listening for engine heartbeats until ctx is done
+func NewHealth(ctx context.Context, t transport.Transport) (*Health, error) {
+	h := &Health{t: t}
+
+	beats, err := t.Subscribe(ctx, heartbeatTopic)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for payload := range beats {
+			var beat heartbeat
+			if json.Unmarshal(payload, &beat) != nil {
+				continue
+			}
+			h.mu.Lock()
+			h.lastBeat, h.seenAt = beat, time.Now()
+			h.mu.Unlock()
+		}
+	}()
+	return h, nil
+}
+
+// Drain marks the server as going away, readiness fails from now on
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// checks reports the transport and engine state and whether both are fine
+func (h *Health) checks(ctx context.Context) (gin.H, bool) {
+	ok := true
+
+	transportCheck := gin.H{"ok": true}
+	if err := h.t.Ping(ctx); err != nil {
+		transportCheck = gin.H{"ok": false, "error": err.Error()}
+		ok = false
+	}
+
+	h.mu.Lock()
+	beat, seenAt := h.lastBeat, h.seenAt
+	h.mu.Unlock()
+
+	// A few missed beats are tolerated before the engine counts as gone
+	stale := 3 * time.Duration(config.Current.Engine.HeartbeatInterval)
+	alive := !seenAt.IsZero() && time.Since(seenAt) < stale
+	engineCheck := gin.H{"ok": alive}
+	if !seenAt.IsZero() {
+		engineCheck["engine"] = beat.Engine
+		engineCheck["lastHeartbeat"] = seenAt
+	}
+	if !alive {
+		ok = false
+	}
+
+	return gin.H{"transport": transportCheck, "engine": engineCheck}, ok
+}
+
+// Healthz reports the checks but only fails when the process cannot answer at all
+func (h *Health) Healthz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+	defer cancel()
+
+	checks, _ := h.checks(ctx)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "alive",
+		"data":    checks,
+	})
+}
+
+// Readyz fails while draining, when the transport is down or the engine has
+// stopped sending heartbeats
+func (h *Health) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+	defer cancel()
+
+	checks, ok := h.checks(ctx)
+	checks["draining"] = h.draining.Load()
+	if !ok || h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "not ready",
+			"data":    checks,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "ready",
+		"data":    checks,
+	})
+}
+
+// SetupHealthRoutes registers the probes, they are answered by the API server itself
+func SetupHealthRoutes(router *gin.Engine, h *Health) {
+	router.GET("/healthz", h.Healthz)
+	router.GET("/readyz", h.Readyz)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+)
+
+// TestRequestLogger follows a request from the API server through the queue
+// into an engine handler: every line logged on the way carries the ID the
+// client got back in X-Request-Id
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	logging.Setup(&out, "debug", "json")
+	t.Cleanup(func() { logging.Setup(io.Discard, "error", "text") })
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+	config.Current = config.Defaults()
+
+	engineRouter := gin.New()
+	engineRouter.POST("/order", func(c *gin.Context) {
+		logging.From(c).Info("order placed", logging.UserID, "alice", logging.OrderID, "order-1")
+		c.JSON(http.StatusCreated, gin.H{"success": true})
+	})
+	var forwarded string
+	stub := stubTransport{reply: func(ctx context.Context, data models.QueueData) (models.EngineReply, error) {
+		forwarded = data.ID
+		return engine.Process(ctx, engineRouter, data), nil
+	}}
+	router := gin.New()
+	router.Use(RequestLogger())
+	router.POST("/order", ForwardReq(stub, "/order"))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(`{"userId":"alice"}`)))
+	id := rec.Header().Get(RequestIDHeader)
+	if rec.Code != http.StatusCreated || id == "" {
+		t.Fatalf("status %d, request ID %q", rec.Code, id)
+	}
+	if forwarded != id {
+		t.Errorf("engine got request ID %q, the client %q", forwarded, id)
+	}
+
+	lines := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		lines[record["msg"].(string)] = record
+	}
+	want := map[string]map[string]any{
+		"order placed": {logging.RequestID: id, logging.Route: "/order", logging.UserID: "alice", logging.OrderID: "order-1"},
+		"processed":    {logging.RequestID: id, logging.Route: "/order", "status": float64(http.StatusCreated)},
+		"request":      {logging.RequestID: id, logging.Route: "/order", "status": float64(http.StatusCreated), "method": "POST"},
+	}
+	for msg, fields := range want {
+		record, ok := lines[msg]
+		if !ok {
+			t.Errorf("nothing logged as %q in\n%s", msg, out.String())
+			continue
+		}
+		for key, value := range fields {
+			if record[key] != value {
+				t.Errorf("%q logged %s=%v, want %v", msg, key, record[key], value)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/metrics"
+	"github.com/sahilrush/src/transport"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("opnify_http_requests_total",
+		"Requests answered by the API server.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("opnify_http_request_duration_seconds",
+		"Time from receiving a request to answering it, engine round trip included.", metrics.DefBuckets, "method", "route")
+)
+
+// Instrument counts and times every request by its route pattern
+func Instrument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		// Nothing is written when the client went away first, count those apart
+		status := strconv.Itoa(c.Writer.Status())
+		if !c.Writer.Written() && c.Request.Context().Err() != nil {
+			status = "499"
+		}
+		httpRequests.With(c.Request.Method, route, status).Inc()
+		httpDuration.With(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterQueueMetrics exposes how many commands wait on the transport
+func RegisterQueueMetrics(t transport.Transport) {
+	metrics.NewGaugeFunc("opnify_engine_queue_depth",
+		"Commands queued for the engine and not yet acknowledged.", nil, func() []metrics.Sample {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			depth, err := t.Depth(ctx)
+			if err != nil {
+				slog.Warn("failed to read queue depth", "error", err)
+				return nil
+			}
+			return []metrics.Sample{{Value: float64(depth)}}
+		})
+}
+
+// SetupMetricsRoute serves the metrics of this process on /metrics
+func SetupMetricsRoute(router *gin.Engine) {
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+}
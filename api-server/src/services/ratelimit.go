@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/metrics"
+	"github.com/sahilrush/src/ratelimit"
+)
+
+var rateLimited = metrics.NewCounterVec("opnify_rate_limited_total",
+	"Requests refused with 429 because a rate limit ran out.", "class", "scope")
+
+// NewLimiter returns the configured rate limiter, or nil when rate limiting is off
+func NewLimiter() (ratelimit.Limiter, error) {
+	limits := config.Current.RateLimit
+	if !limits.Enabled {
+		return nil, nil
+	}
+
+	store := limits.Store
+	if store == "auto" {
+		store = "memory"
+		if config.Current.Queue.Transport == "redis" {
+			store = "redis"
+		}
+	}
+
+	switch store {
+	case "redis":
+		return &ratelimit.Redis{Client: newRedisClient(), Prefix: limits.Prefix}, nil
+	case "memory":
+		return ratelimit.NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", store)
+	}
+}
+
+// budget returns the configured budget of a class of routes
+func budget(class ratelimit.Class) config.Budget {
+	limits := config.Current.RateLimit
+	switch class {
+	case ratelimit.Orders:
+		return limits.Orders
+	case ratelimit.Cancels:
+		return limits.Cancels
+	case ratelimit.Reads:
+		return limits.Reads
+	case ratelimit.Callbacks:
+		return limits.Callbacks
+	default:
+		return limits.Writes
+	}
+}
+
+// RateLimit takes a token from the client IP's bucket and, when the request
+// names a user, from that user's bucket for the class of the route. A request
+// without tokens left gets 429 with Retry-After. When the limiter fails the
+// request goes through, the limits protect the engine but must not take the
+// API down with Redis.
+func RateLimit(limiter ratelimit.Limiter, class ratelimit.Class) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || class == ratelimit.None {
+			c.Next()
+			return
+		}
+		limits := budget(class)
+
+		// Requests are not authenticated, so the user is whoever the request
+		// acts for. Cycling through user IDs still runs into the IP budget.
+		buckets := []struct {
+			scope string
+			id    string
+			limit config.Rate
+		}{
+			{"ip", c.ClientIP(), limits.IP},
+			{"user", requestUser(c), limits.User},
+		}
+
+		remaining := math.MaxInt
+		for _, bucket := range buckets {
+			if bucket.id == "" {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+			key := string(class) + ":" + bucket.scope + ":" + bucket.id
+			result, err := limiter.Allow(ctx, key, ratelimit.Limit(bucket.limit))
+			cancel()
+			if err != nil {
+				logging.From(c).Warn("rate limiter unavailable, letting request through", "error", err)
+				c.Next()
+				return
+			}
+
+			if !result.Allowed {
+				rateLimited.With(string(class), bucket.scope).Inc()
+				seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				c.Header("Retry-After", strconv.Itoa(seconds))
+				apierr.Respond(c, apierr.New(apierr.RateLimited, "Too many requests").With(map[string]interface{}{
+					"limit":      bucket.scope,
+					"retryAfter": seconds,
+				}))
+				return
+			}
+			remaining = min(remaining, result.Remaining)
+		}
+
+		if remaining != math.MaxInt {
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		}
+		c.Next()
+	}
+}
+
+// requestUser finds the user a request acts for in its path, query or JSON
+// body. The body is put back for the handlers that read it later.
+func requestUser(c *gin.Context) string {
+	if userId := c.Param("userId"); userId != "" {
+		return userId
+	}
+	if userId := c.Query("userId"); userId != "" {
+		return userId
+	}
+	if c.Request.Body == nil || c.ContentType() != gin.MIMEJSON {
+		return ""
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		UserId string `json:"userId"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return payload.UserId
+}
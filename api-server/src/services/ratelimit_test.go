@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/ratelimit"
+)
+
+type brokenLimiter struct{}
+
+func (brokenLimiter) Allow(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("redis down")
+}
+
+func (brokenLimiter) Close() error { return nil }
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Setup(io.Discard, "error", "text")
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+	config.Current.RateLimit.Orders = config.Budget{User: config.Rate{Rate: 0.001, Burst: 2}, IP: config.Rate{Rate: 0.001, Burst: 3}}
+
+	// route builds a fresh router, so every case starts from full buckets
+	route := func(limiter ratelimit.Limiter, class ratelimit.Class) *gin.Engine {
+		router := gin.New()
+		router.POST("/order", RateLimit(limiter, class), func(c *gin.Context) {
+			body, _ := io.ReadAll(c.Request.Body)
+			c.String(http.StatusOK, string(body))
+		})
+		return router
+	}
+	send := func(router *gin.Engine, ip, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	type call struct {
+		ip, body  string
+		status    int
+		remaining string
+	}
+	tests := []struct {
+		name    string
+		limiter ratelimit.Limiter
+		class   ratelimit.Class
+		calls   []call
+	}{
+		{"user budget", ratelimit.NewMemory(), ratelimit.Orders, []call{
+			{"10.0.0.1", `{"userId":"alice"}`, http.StatusOK, "1"},
+			{"10.0.0.2", `{"userId":"alice"}`, http.StatusOK, "0"},
+			{"10.0.0.3", `{"userId":"alice"}`, http.StatusTooManyRequests, ""},
+			{"10.0.0.3", `{"userId":"bob"}`, http.StatusOK, "1"},
+		}},
+		{"IP budget across users", ratelimit.NewMemory(), ratelimit.Orders, []call{
+			{"10.0.0.1", `{"userId":"a"}`, http.StatusOK, "1"},
+			{"10.0.0.1", `{"userId":"b"}`, http.StatusOK, "1"},
+			{"10.0.0.1", `{"userId":"c"}`, http.StatusOK, "0"},
+			{"10.0.0.1", `{"userId":"d"}`, http.StatusTooManyRequests, ""},
+		}},
+		{"no user, IP only", ratelimit.NewMemory(), ratelimit.Orders, []call{
+			{"10.0.0.1", `{}`, http.StatusOK, "2"},
+		}},
+		{"unlimited class", ratelimit.NewMemory(), ratelimit.None, []call{
+			{"10.0.0.1", `{"userId":"alice"}`, http.StatusOK, ""},
+		}},
+		{"limiter down lets requests through", brokenLimiter{}, ratelimit.Orders, []call{
+			{"10.0.0.1", `{"userId":"alice"}`, http.StatusOK, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := route(tt.limiter, tt.class)
+			for i, call := range tt.calls {
+				rec := send(router, call.ip, call.body)
+				if rec.Code != call.status {
+					t.Fatalf("call %d: status %d, want %d (%s)", i, rec.Code, call.status, rec.Body)
+				}
+				if got := rec.Header().Get("X-RateLimit-Remaining"); got != call.remaining {
+					t.Errorf("call %d: remaining %q, want %q", i, got, call.remaining)
+				}
+				switch call.status {
+				case http.StatusOK:
+					if rec.Body.String() != call.body {
+						t.Errorf("call %d: handler read %q, want the body put back", i, rec.Body)
+					}
+				case http.StatusTooManyRequests:
+					if rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), `"RATE_LIMITED"`) {
+						t.Errorf("call %d: %v %s, want Retry-After and a RATE_LIMITED error", i, rec.Header(), rec.Body)
+					}
+				}
+			}
+		})
+	}
+}
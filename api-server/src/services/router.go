@@ -0,0 +1,35 @@
+package services
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/apierr"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/openapi"
+	"github.com/sahilrush/src/ratelimit"
+	"github.com/sahilrush/src/transport"
+)
+
+// NewRouter builds the API server's handler: middleware, probes, metrics,
+// the OpenAPI document and every route rate limited and forwarded to the
+// engine over t
+func NewRouter(t transport.Transport, health *Health, limiter ratelimit.Limiter) *gin.Engine {
+	r := gin.New()
+	// Only the proxies in front of us may name the client IP in
+	// X-Forwarded-For, otherwise anyone gets a fresh rate limit budget by
+	// sending a different one. Validate has checked the list.
+	if err := r.SetTrustedProxies(config.Current.Server.TrustedProxies); err != nil {
+		r.SetTrustedProxies(nil)
+	}
+	r.Use(apierr.Recovery(), Trace(), RequestLogger(), Instrument())
+	r.NoRoute(apierr.NoRoute)
+
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(200, gin.H{"message": "Probo-Backend"})
+	})
+	SetupHealthRoutes(r, health)
+	SetupMetricsRoute(r)
+	r.GET("/openapi.json", openapi.Handler)
+
+	SetupRoutes(r, t, limiter)
+	return r
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/ratelimit"
+	"github.com/sahilrush/src/transport"
+)
+
+// TestRouterClientIP checks whose X-Forwarded-For the router believes: a
+// client naming another IP must not get a fresh read budget, a trusted
+// proxy naming the client must.
+func TestRouterClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Setup(io.Discard, "error", "text")
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+	config.Current.RateLimit.Enabled = true
+	config.Current.RateLimit.Reads = config.Budget{IP: config.Rate{Rate: 0.001, Burst: 1}}
+
+	// An engine that answers everything at once
+	inproc := transport.NewInProc()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go inproc.Serve(ctx, func(models.QueueData) (models.EngineReply, error) {
+		return models.EngineReply{StatusCode: http.StatusOK, Data: []byte(`{}`)}, nil
+	})
+
+	send := func(router *gin.Engine, remote, forwardedFor string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/tickers", nil)
+		req.RemoteAddr = remote + ":1234"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	type call struct {
+		remote, forwardedFor string
+		status               int
+	}
+	tests := []struct {
+		name    string
+		proxies []string
+		calls   []call
+	}{
+		{"no trusted proxies", nil, []call{
+			{"10.0.0.1", "", http.StatusOK},
+			{"10.0.0.1", "203.0.113.9", http.StatusTooManyRequests},
+			{"10.0.0.1", "203.0.113.10, 10.0.0.1", http.StatusTooManyRequests},
+		}},
+		{"spoofing past a trusted proxy", []string{"10.0.0.0/8"}, []call{
+			{"192.168.1.1", "", http.StatusOK},
+			{"192.168.1.1", "203.0.113.9", http.StatusTooManyRequests},
+		}},
+		{"behind a trusted proxy", []string{"10.0.0.0/8"}, []call{
+			{"10.0.0.1", "203.0.113.9", http.StatusOK},
+			{"10.0.0.1", "203.0.113.10", http.StatusOK},
+			{"10.0.0.2", "203.0.113.9", http.StatusTooManyRequests},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Current.Server.TrustedProxies = tt.proxies
+			router := NewRouter(inproc, nil, ratelimit.NewMemory())
+			for i, c := range tt.calls {
+				if status := send(router, c.remote, c.forwardedFor); status != c.status {
+					t.Errorf("call %d from %s for %q: status %d, want %d", i+1, c.remote, c.forwardedFor, status, c.status)
+				}
+			}
+		})
+	}
+}
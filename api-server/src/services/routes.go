@@ -1,29 +1,80 @@
 package services
 
-// import (
-// 	"github.com/gin-gonic/gin"
-// 	"github.com/sahilrush/src/controllers"
-// )
+import (
+	"net/http"
 
-// func SetupRoutes(router *gin.Engine) {
-// 	api := router.Group("/")
-// 	{
-// 		api.POST("/user/create/:userId", controllers.ForwardReq("/user/create/:userId"))
-// 		api.POST("/symbol/create/:stockSymbol", controllers.ForwardReq("/symbol/create/:stockSymbol"))
-// 		api.POST("/onramp/inr", controllers.ForwardReq("/onramp/inr"))
-// 		api.POST("/trade/mint", controllers.ForwardReq("/trade/mint"))
-// 		api.POST("/reset", controllers.ForwardReq("/reset"))
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/controllers"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/ratelimit"
+	"github.com/sahilrush/src/transport"
+)
 
-// 		api.GET("/balances/inr", controllers.ForwardReq("/balances/inr"))
-// 		api.GET("/balances/inr/:userId", controllers.ForwardReq("/balances/inr/:userId"))
-// 		api.GET("/balances/stock", controllers.ForwardReq("/balances/stock"))
-// 		api.GET("/balances/stock/:stockSymbol", controllers.ForwardReq("/balances/stock/:stockSymbol"))
+// Route is an endpoint served by the engine. Wrap decides how the engine runs
+// the handler: engine.Command for state changes, engine.Query for reads, nil
+// for handlers that take the engine lock themselves. Limit is the rate limit
+// budget the route draws from.
+type Route struct {
+	Method  string
+	Path    string
+	Handler gin.HandlerFunc
+	Wrap    func(gin.HandlerFunc) gin.HandlerFunc
+	Limit   ratelimit.Class
+}
 
-// 		api.GET("/orderbook", controllers.ForwardReq("/orderbook"))
-// 		api.GET("/orderbook/:stockSymbol", controllers.ForwardReq("/orderbook/:stockSymbol"))
+var Routes = []Route{
+	{http.MethodPost, "/user/create", controllers.CreateUser, engine.Command, ratelimit.Writes},
+	{http.MethodPost, "/onramp/inr", controllers.OnrampUser, engine.Command, ratelimit.Writes},
+	{http.MethodGet, "/onramp/inr/:intentId", controllers.GetDepositIntent, engine.Query, ratelimit.Reads},
+	{http.MethodPost, "/onramp/webhook", controllers.OnrampWebhook, engine.Command, ratelimit.Callbacks},
+	{http.MethodPost, "/offramp/inr", controllers.OfframpUser, engine.Command, ratelimit.Writes},
+	{http.MethodGet, "/offramp/inr/:withdrawalId", controllers.GetWithdrawal, engine.Query, ratelimit.Reads},
+	{http.MethodPost, "/offramp/inr/:withdrawalId/status", controllers.UpdateWithdrawal, engine.Command, ratelimit.Callbacks},
+	{http.MethodGet, "/balance/inr", controllers.GetBalances, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/balance/inr/:userId", controllers.GetUserBalance, engine.Query, ratelimit.Reads},
+	{http.MethodPost, "/symbol/create", controllers.CreateSymbol, engine.Command, ratelimit.Writes},
+	{http.MethodGet, "/orderbook/:symbol", controllers.ViewOrderbook, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/orderbook/getorder", controllers.GetOrderBooks, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/markets/:symbol/candles", controllers.GetCandles, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/tickers", controllers.GetTickers, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/markets/:symbol/amm", controllers.GetMarketMaker, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/getUserStock/:userId", controllers.GetUserStock, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/portfolio/:userId", controllers.GetPortfolio, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/getStocks", controllers.GetStocks, engine.Query, ratelimit.Reads},
+	{http.MethodPost, "/sellyes", controllers.SellYes, engine.Command, ratelimit.Orders},
+	{http.MethodPost, "/sellno", controllers.SellNo, engine.Command, ratelimit.Orders},
+	{http.MethodPost, "/buyyes", controllers.BuyYes, engine.Command, ratelimit.Orders},
+	{http.MethodPost, "/buyno", controllers.BuyNo, engine.Command, ratelimit.Orders},
+	{http.MethodPost, "/v1/orders", controllers.PlaceOrder, engine.Command, ratelimit.Orders},
+	{http.MethodGet, "/v1/orders", controllers.ListOrders, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/v1/orders/:orderId", controllers.GetOrder, engine.Query, ratelimit.Reads},
+	{http.MethodDelete, "/v1/orders/:orderId", controllers.CancelOrder, engine.Command, ratelimit.Cancels},
+	{http.MethodGet, "/trades", controllers.ListTrades, engine.Query, ratelimit.Reads},
+	{http.MethodPost, "/symbol/resolve", controllers.ResolveSymbol, engine.Command, ratelimit.Writes},
+	{http.MethodGet, "/fees", controllers.GetFees, engine.Query, ratelimit.Reads},
+	{http.MethodPost, "/fees/schedule", controllers.SetFeeSchedule, engine.Command, ratelimit.Writes},
+	{http.MethodPost, "/fees/tier", controllers.SetUserTier, engine.Command, ratelimit.Writes},
+	{http.MethodGet, "/ledger/journal", controllers.GetJournal, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/ledger/accounts", controllers.GetLedgerAccounts, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/ledger/verify", controllers.VerifyLedger, engine.Query, ratelimit.Reads},
+	{http.MethodGet, "/invariants", controllers.GetInvariantReport, nil, ratelimit.Reads},
+}
 
-// 		api.POST("/order/buy", controllers.ForwardReq("/order/buy"))
-// 		api.POST("/order/sell", controllers.ForwardReq("/order/sell"))
-// 		api.POST("/order/cancel", controllers.ForwardReq("/order/cancel"))
-// 	}
-// }
+// SetupRoutes registers every route on the API server, each one rate limited
+// and forwarded to the engine
+func SetupRoutes(router *gin.Engine, t transport.Transport, limiter ratelimit.Limiter) {
+	for _, route := range Routes {
+		router.Handle(route.Method, route.Path, RateLimit(limiter, route.Limit), ForwardReq(t, route.Path))
+	}
+}
+
+// SetupEngineRoutes registers the handlers the engine runs for forwarded requests
+func SetupEngineRoutes(router *gin.Engine) {
+	for _, route := range Routes {
+		handler := route.Handler
+		if route.Wrap != nil {
+			handler = route.Wrap(handler)
+		}
+		router.Handle(route.Method, route.Path, handler)
+	}
+}
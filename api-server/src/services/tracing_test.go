@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/engine"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestTraceAcrossQueue sends a request carrying a traceparent through the API
+// server, the queue and the engine: every span belongs to the caller's trace,
+// each one a child of the step before it
+func TestTraceAcrossQueue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved, savedProvider := config.Current, otel.GetTracerProvider()
+	t.Cleanup(func() { config.Current = saved; otel.SetTracerProvider(savedProvider) })
+	config.Current = config.Defaults()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	engineRouter := gin.New()
+	engineRouter.POST("/order", func(c *gin.Context) {
+		_, span := tracing.Start(c.Request.Context(), "match")
+		span.End()
+		c.JSON(http.StatusCreated, gin.H{"success": true})
+	})
+	handle := engine.NewHandler(engineRouter, nil)
+	var carried map[string]string
+	stub := stubTransport{reply: func(_ context.Context, data models.QueueData) (models.EngineReply, error) {
+		carried = data.Trace
+		return handle(data)
+	}}
+	router := gin.New()
+	router.Use(Trace())
+	router.POST("/order", ForwardReq(stub, "/order"))
+
+	const traceID, callerSpan = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(`{"userId":"alice"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+callerSpan+"-01")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(carried["traceparent"], traceID) {
+		t.Errorf("queued command carries %v, want the trace %s", carried, traceID)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	tests := []struct {
+		name   string
+		parent string
+		kind   trace.SpanKind
+	}{
+		{"POST /order", "", trace.SpanKindServer},
+		{"forward /order", "POST /order", trace.SpanKindProducer},
+		{"queue wait", "forward /order", trace.SpanKindInternal},
+		{"engine POST /order", "forward /order", trace.SpanKindConsumer},
+		{"match", "engine POST /order", trace.SpanKindInternal},
+	}
+	for _, tt := range tests {
+		span, ok := spans[tt.name]
+		if !ok {
+			t.Errorf("no span %q among %d", tt.name, len(spans))
+			continue
+		}
+		parent := callerSpan
+		if tt.parent != "" && spans[tt.parent] != nil {
+			parent = spans[tt.parent].SpanContext().SpanID().String()
+		}
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("span %q is in trace %s, want %s", tt.name, got, traceID)
+		}
+		if got := span.Parent().SpanID().String(); got != parent {
+			t.Errorf("span %q has parent %s, want %q's %s", tt.name, got, tt.parent, parent)
+		}
+		if span.SpanKind() != tt.kind {
+			t.Errorf("span %q is a %v, want a %v", tt.name, span.SpanKind(), tt.kind)
+		}
+	}
+}
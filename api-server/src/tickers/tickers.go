@@ -0,0 +1,217 @@
+// Package tickers keeps a summary of every market up to date as the engine
+// runs: last price, best bid and ask, 24h volume and price change, open
+// interest and number of traders. The engine reports trades, book changes,
+// minted pairs and resolutions, so reading a ticker scans nothing. Like the
+// rest of the engine state it is guarded by the engine lock.
+package tickers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/models"
+)
+
+// Window is the period the volume and price change cover
+const Window = 24 * time.Hour
+
+// Quote is the best bid and ask of one outcome, 0 when that side is empty
+type Quote struct {
+	Bid int `json:"bid"`
+	Ask int `json:"ask"`
+}
+
+// Ticker summarises a market. Prices are YES prices, a NO price is the
+// contract price minus the YES one.
+type Ticker struct {
+	Symbol       string    `json:"symbol"`
+	LastPrice    int       `json:"lastPrice"`
+	LastTradeAt  time.Time `json:"lastTradeAt"`
+	Yes          Quote     `json:"yes"`
+	No           Quote     `json:"no"`
+	Volume24h    int       `json:"volume24h"`
+	Notional24h  int       `json:"notional24h"`
+	Change24h    int       `json:"change24h"`
+	OpenInterest int       `json:"openInterest"`
+	Traders      int       `json:"traders"`
+	Resolved     string    `json:"resolved,omitempty"`
+}
+
+// bucket is a minute of trading inside the window
+type bucket struct {
+	start    time.Time
+	open     int
+	close    int
+	volume   int
+	notional int
+}
+
+type market struct {
+	ticker  Ticker
+	traders map[string]bool
+	buckets []bucket
+	// reference is the YES price of the last trade before the window, 0 if none
+	reference int
+}
+
+var markets = map[string]*market{}
+
+func get(symbol string) *market {
+	m, ok := markets[symbol]
+	if !ok {
+		m = &market{ticker: Ticker{Symbol: symbol}, traders: map[string]bool{}}
+		markets[symbol] = m
+	}
+	return m
+}
+
+// List adds a new market so it has a ticker before its first trade
+func List(symbol string) {
+	get(symbol)
+}
+
+// Trade records a fill
+func Trade(trade models.Trade) {
+	m := get(trade.Symbol)
+	price := trade.Price
+	if trade.Outcome == "no" {
+		price = models.ContractPrice - trade.Price
+	}
+
+	m.ticker.LastPrice = price
+	m.ticker.LastTradeAt = trade.Timestamp
+	for _, userId := range []string{trade.Buyer, trade.Seller} {
+		if !amm.IsAccount(userId) {
+			m.traders[userId] = true
+		}
+	}
+	m.ticker.Traders = len(m.traders)
+
+	start := trade.Timestamp.Truncate(time.Minute)
+	if n := len(m.buckets); n == 0 || m.buckets[n-1].start.Before(start) {
+		m.buckets = append(m.buckets, bucket{start: start, open: price})
+	}
+	last := &m.buckets[len(m.buckets)-1]
+	last.close = price
+	last.volume += trade.Quantity
+	last.notional += trade.Price * trade.Quantity
+	m.ticker.Volume24h += trade.Quantity
+	m.ticker.Notional24h += trade.Price * trade.Quantity
+	m.expire(trade.Timestamp)
+}
+
+// Book refreshes the best bid and ask of a market after its book changed.
+// Every order resting on an outcome offers it; only buyers of the outcome,
+// resting as inverse orders on the other side, bid for it.
+func Book(symbol string, book models.Pricing) {
+	m := get(symbol)
+	m.ticker.Yes = Quote{Bid: bid(book.No), Ask: ask(book.Yes)}
+	m.ticker.No = Quote{Bid: bid(book.Yes), Ask: ask(book.No)}
+}
+
+func ask(offers map[int]models.OrderType) int {
+	for price := 1; price < models.ContractPrice; price++ {
+		if offers[price].Total > 0 {
+			return price
+		}
+	}
+	return 0
+}
+
+func bid(other map[int]models.OrderType) int {
+	for level := 1; level < models.ContractPrice; level++ {
+		for _, order := range other[level].Orders {
+			if order.Type != "sell" && order.Quantity > 0 {
+				return models.ContractPrice - level
+			}
+		}
+	}
+	return 0
+}
+
+// Mint adds YES/NO pairs created in a market to its open interest, a market
+// maker redeeming pairs takes them away with a negative count
+func Mint(symbol string, pairs int) {
+	get(symbol).ticker.OpenInterest += pairs
+}
+
+// Resolve marks a market settled, its pairs are paid out and its book is empty
+func Resolve(symbol, outcome string) {
+	m := get(symbol)
+	m.ticker.Resolved = outcome
+	m.ticker.OpenInterest = 0
+	m.ticker.Yes, m.ticker.No = Quote{}, Quote{}
+}
+
+// expire drops the buckets that fell out of the window
+func (m *market) expire(now time.Time) {
+	cutoff := now.Add(-Window)
+	dropped := 0
+	for _, b := range m.buckets {
+		if b.start.Add(time.Minute).After(cutoff) {
+			break
+		}
+		m.ticker.Volume24h -= b.volume
+		m.ticker.Notional24h -= b.notional
+		m.reference = b.close
+		dropped++
+	}
+	m.buckets = m.buckets[dropped:]
+}
+
+// view returns the ticker as of now
+func (m *market) view(now time.Time) Ticker {
+	m.expire(now)
+	ticker := m.ticker
+	ticker.Change24h = 0
+	if len(m.buckets) > 0 {
+		reference := m.reference
+		if reference == 0 {
+			reference = m.buckets[0].open
+		}
+		ticker.Change24h = ticker.LastPrice - reference
+	}
+	return ticker
+}
+
+// All returns the ticker of every market ordered by symbol
+func All(now time.Time) []Ticker {
+	tickers := make([]Ticker, 0, len(markets))
+	for _, m := range markets {
+		tickers = append(tickers, m.view(now))
+	}
+	sort.Slice(tickers, func(i, j int) bool { return tickers[i].Symbol < tickers[j].Symbol })
+	return tickers
+}
+
+// Get returns the ticker of one market
+func Get(symbol string, now time.Time) (Ticker, bool) {
+	m, ok := markets[symbol]
+	if !ok {
+		return Ticker{}, false
+	}
+	return m.view(now), true
+}
+
+// Rebuild replaces every ticker with ones built from the engine state: the
+// trade log, the books, the holdings and the resolved markets
+func Rebuild(trades []models.Trade, books models.Orderbook, stocks models.Stock, resolved map[string]string) {
+	clear(markets)
+	for symbol, book := range books {
+		List(symbol)
+		Book(symbol, book)
+	}
+	for _, trade := range trades {
+		Trade(trade)
+	}
+	for symbol, users := range stocks {
+		for _, holdings := range users {
+			yes := holdings["yes"]
+			Mint(symbol, yes.Quantity+yes.Locked)
+		}
+	}
+	for symbol, outcome := range resolved {
+		Resolve(symbol, outcome)
+	}
+}
@@ -0,0 +1,165 @@
+package tickers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sahilrush/src/amm"
+	"github.com/sahilrush/src/models"
+	"github.com/sahilrush/src/tickers"
+)
+
+var base = time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+func reset(t *testing.T) {
+	tickers.Rebuild(nil, nil, nil, nil)
+	t.Cleanup(func() { tickers.Rebuild(nil, nil, nil, nil) })
+}
+
+func trade(at time.Duration, outcome string, price, quantity int, buyer, seller string) models.Trade {
+	return models.Trade{Symbol: "BTC", Outcome: outcome, Price: price, Quantity: quantity,
+		Buyer: buyer, Seller: seller, Timestamp: base.Add(at)}
+}
+
+func get(t *testing.T, now time.Time) tickers.Ticker {
+	t.Helper()
+	ticker, ok := tickers.Get("BTC", now)
+	if !ok {
+		t.Fatal("no BTC ticker")
+	}
+	return ticker
+}
+
+func TestBook(t *testing.T) {
+	level := func(orders ...models.Orders) models.OrderType {
+		total := 0
+		for _, order := range orders {
+			total += order.Quantity
+		}
+		return models.OrderType{Total: total, Orders: orders}
+	}
+	sell := func(quantity int) models.Orders {
+		return models.Orders{UserId: "s", Quantity: quantity, Type: "sell"}
+	}
+	inverse := func(quantity int) models.Orders {
+		return models.Orders{UserId: "b", Quantity: quantity, Type: "inverse"}
+	}
+
+	tests := []struct {
+		name    string
+		book    models.Pricing
+		yes, no tickers.Quote
+	}{
+		{"empty", models.Pricing{}, tickers.Quote{}, tickers.Quote{}},
+		{"asks only", models.Pricing{
+			Yes: map[int]models.OrderType{7: level(sell(2)), 6: level(sell(1))},
+			No:  map[int]models.OrderType{5: level(sell(3))},
+		}, tickers.Quote{Ask: 6}, tickers.Quote{Ask: 5}},
+		{"a YES bid rests on NO", models.Pricing{
+			No: map[int]models.OrderType{4: level(inverse(2)), 3: level(inverse(1))},
+		}, tickers.Quote{Bid: 7}, tickers.Quote{Ask: 3}},
+		{"bids and asks", models.Pricing{
+			Yes: map[int]models.OrderType{6: level(sell(1)), 8: level(inverse(1))},
+			No:  map[int]models.OrderType{5: level(sell(1), inverse(2))},
+		}, tickers.Quote{Bid: 5, Ask: 6}, tickers.Quote{Bid: 2, Ask: 5}},
+		{"emptied levels are skipped", models.Pricing{
+			Yes: map[int]models.OrderType{2: {}, 4: level(sell(1))},
+			No:  map[int]models.OrderType{1: {}, 3: level(inverse(1))},
+		}, tickers.Quote{Bid: 7, Ask: 4}, tickers.Quote{Ask: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset(t)
+			tickers.Book("BTC", tt.book)
+			ticker := get(t, base)
+			if ticker.Yes != tt.yes || ticker.No != tt.no {
+				t.Errorf("yes %+v no %+v, want yes %+v no %+v", ticker.Yes, ticker.No, tt.yes, tt.no)
+			}
+		})
+	}
+}
+
+func TestTrades(t *testing.T) {
+	reset(t)
+	tickers.List("BTC")
+	if ticker := get(t, base); ticker.LastPrice != 0 || ticker.Volume24h != 0 || ticker.Change24h != 0 {
+		t.Fatalf("listed market = %+v, want an empty ticker", ticker)
+	}
+
+	tickers.Trade(trade(0, "yes", 4, 2, "alice", "bob"))
+	tickers.Trade(trade(time.Hour, "no", 3, 1, "carol", amm.Account("BTC")))
+	tickers.Trade(trade(2*time.Hour, "yes", 6, 3, "alice", "carol"))
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		volume   int
+		notional int
+		change   int
+	}{
+		{"inside the window", base.Add(3 * time.Hour), 6, 29, 2},
+		{"first minute still in the window", base.Add(tickers.Window + 59*time.Second), 6, 29, 2},
+		{"first trade out of the window", base.Add(tickers.Window + time.Minute), 4, 21, 2},
+		{"change from the last price before the window", base.Add(tickers.Window + time.Hour + time.Minute), 3, 18, -1},
+		{"every trade out of the window", base.Add(tickers.Window + 3*time.Hour), 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ticker := get(t, tt.now)
+			if ticker.Volume24h != tt.volume || ticker.Notional24h != tt.notional || ticker.Change24h != tt.change {
+				t.Errorf("volume %d notional %d change %d, want %d %d %d",
+					ticker.Volume24h, ticker.Notional24h, ticker.Change24h, tt.volume, tt.notional, tt.change)
+			}
+			if ticker.LastPrice != 6 || !ticker.LastTradeAt.Equal(base.Add(2*time.Hour)) {
+				t.Errorf("last trade %d at %v, want 6 at the third trade", ticker.LastPrice, ticker.LastTradeAt)
+			}
+			if ticker.Traders != 3 {
+				t.Errorf("traders = %d, want 3 without the market maker", ticker.Traders)
+			}
+		})
+	}
+}
+
+func TestOpenInterest(t *testing.T) {
+	reset(t)
+	tickers.Mint("BTC", 10)
+	tickers.Mint("BTC", 5)
+	tickers.Mint("BTC", -3)
+	tickers.Book("BTC", models.Pricing{Yes: map[int]models.OrderType{6: {Total: 1, Orders: []models.Orders{{Quantity: 1, Type: "sell"}}}}})
+	if ticker := get(t, base); ticker.OpenInterest != 12 {
+		t.Errorf("open interest = %d, want 12", ticker.OpenInterest)
+	}
+
+	tickers.Resolve("BTC", "yes")
+	ticker := get(t, base)
+	if ticker.Resolved != "yes" || ticker.OpenInterest != 0 || ticker.Yes != (tickers.Quote{}) {
+		t.Errorf("resolved ticker = %+v, want settled with no interest or quotes", ticker)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	reset(t)
+	books := models.Orderbook{
+		"BTC": {Yes: map[int]models.OrderType{6: {Total: 1, Orders: []models.Orders{{Quantity: 1, Type: "sell"}}}}},
+		"ETH": {},
+	}
+	stocks := models.Stock{"BTC": {
+		"alice": {"yes": {Quantity: 3, Locked: 1}, "no": {Quantity: 2}},
+		"bob":   {"no": {Quantity: 2}},
+	}}
+	tickers.Rebuild([]models.Trade{trade(0, "yes", 6, 1, "alice", "bob")}, books, stocks, map[string]string{"ETH": "no"})
+
+	all := tickers.All(base)
+	if len(all) != 2 || all[0].Symbol != "BTC" || all[1].Symbol != "ETH" {
+		t.Fatalf("All = %+v, want BTC then ETH", all)
+	}
+	if btc := all[0]; btc.OpenInterest != 4 || btc.Yes.Ask != 6 || btc.LastPrice != 6 || btc.Traders != 2 {
+		t.Errorf("BTC = %+v", btc)
+	}
+	if eth := all[1]; eth.Resolved != "no" {
+		t.Errorf("ETH = %+v, want resolved", eth)
+	}
+	if _, ok := tickers.Get("SOL", base); ok {
+		t.Error("Get found an unknown market")
+	}
+}
@@ -0,0 +1,47 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+
+	config.Current.Tracing.Exporter = "none"
+	shutdown, err := tracing.Setup(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("no exporter: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+
+	config.Current.Tracing.Exporter = "zipkin"
+	if _, err := tracing.Setup(context.Background(), "test"); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
+
+// TestInjectExtract sends a span's context through a message the way
+// QueueData.Trace carries it to the engine
+func TestInjectExtract(t *testing.T) {
+	if carrier := tracing.Inject(context.Background()); carrier != nil {
+		t.Errorf("a context without a span injected %v", carrier)
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	carrier := tracing.Inject(trace.ContextWithSpanContext(context.Background(), sent))
+
+	got := trace.SpanContextFromContext(tracing.Extract(context.Background(), carrier))
+	if !got.IsRemote() || got.TraceID() != traceID || got.SpanID() != spanID || !got.IsSampled() {
+		t.Errorf("extracted %+v from %v, want the span sent", got, carrier)
+	}
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+)
+
+// InProc runs the API server and the engine in one process over channels
+type InProc struct {
+	commands chan inprocRequest
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan []byte]bool
+}
+
+type inprocRequest struct {
+	data  models.QueueData
+	reply chan models.EngineReply
+}
+
+func NewInProc() *InProc {
+	return &InProc{
+		commands:    make(chan inprocRequest, 1024),
+		subscribers: map[string]map[chan []byte]bool{},
+	}
+}
+
+func (t *InProc) Request(ctx context.Context, data models.QueueData) (models.EngineReply, error) {
+	req := inprocRequest{data: data, reply: make(chan models.EngineReply, 1)}
+
+	select {
+	case t.commands <- req:
+	case <-ctx.Done():
+		return models.EngineReply{}, ctx.Err()
+	}
+
+	select {
+	case reply := <-req.reply:
+		return reply, nil
+	case <-ctx.Done():
+		return models.EngineReply{}, ctx.Err()
+	}
+}
+
+func (t *InProc) Serve(ctx context.Context, handler Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case req := <-t.commands:
+			reply, err := handler(req.data)
+			if err != nil {
+				// Nothing to redeliver from, the caller gets the failure instead
+				slog.Error("command failed", logging.RequestID, req.data.ID, "error", err)
+			}
+			req.reply <- reply
+		}
+	}
+}
+
+// Publish drops the event for subscribers that are not keeping up
+func (t *InProc) Publish(ctx context.Context, topic string, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for ch := range t.subscribers[topic] {
+		select {
+		case ch <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+func (t *InProc) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, 64)
+
+	t.mu.Lock()
+	if t.subscribers[topic] == nil {
+		t.subscribers[topic] = map[chan []byte]bool{}
+	}
+	t.subscribers[topic][ch] = true
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.subscribers[topic], ch)
+		t.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Ping always succeeds, there is nothing in between to lose
+func (t *InProc) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (t *InProc) Depth(ctx context.Context) (int64, error) {
+	return int64(len(t.commands)), nil
+}
+
+func (t *InProc) Close() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sahilrush/src/models"
+)
+
+// TestInProcRequest runs commands over the in-process transport: a request
+// waits for the engine, gets its own reply, and gives up with its context
+func TestInProcRequest(t *testing.T) {
+	inproc := NewInProc()
+
+	// Nobody serves yet, the command waits in the channel until the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := inproc.Request(ctx, models.QueueData{ID: "early"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request without an engine = %v, want a timeout", err)
+	}
+	if depth, _ := inproc.Depth(context.Background()); depth != 1 {
+		t.Errorf("depth %d with one command waiting, want 1", depth)
+	}
+
+	engine := newEngine()
+	serveCtx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- inproc.Serve(serveCtx, func(data models.QueueData) (models.EngineReply, error) {
+			if data.ID == "failing" {
+				return models.EngineReply{ID: data.ID, StatusCode: 500}, errors.New("engine crashed")
+			}
+			return engine.handle(data)
+		})
+	}()
+
+	for _, id := range []string{"first", "second"} {
+		reply, err := inproc.Request(context.Background(), models.QueueData{ID: id})
+		if err != nil || reply.ID != id || string(reply.Data) != `{"id":"`+id+`"}` {
+			t.Errorf("request %s got %+v, %v", id, reply, err)
+		}
+	}
+	// A failed command is not delivered again, its requester gets the reply
+	if reply, err := inproc.Request(context.Background(), models.QueueData{ID: "failing"}); err != nil || reply.StatusCode != 500 {
+		t.Errorf("failing command got %+v, %v", reply, err)
+	}
+	if engine.count("early") != 1 || engine.count("first") != 1 {
+		t.Errorf("commands ran %d and %d times, want once each", engine.count("early"), engine.count("first"))
+	}
+
+	stop()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve = %v after its context ended", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve still running after its context ended")
+	}
+}
+
+// TestInProcSubscribe publishes events to the subscribers of a topic only,
+// drops them for subscribers that are not reading, and closes a subscription
+// when its context ends
+func TestInProcSubscribe(t *testing.T) {
+	inproc := NewInProc()
+	ctx := context.Background()
+
+	first, err := inproc.Subscribe(ctx, "trades")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leavingCtx, leave := context.WithCancel(ctx)
+	leaving, _ := inproc.Subscribe(leavingCtx, "trades")
+	other, _ := inproc.Subscribe(ctx, "heartbeats")
+
+	inproc.Publish(ctx, "trades", []byte("t1"))
+	for name, ch := range map[string]<-chan []byte{"first": first, "leaving": leaving} {
+		select {
+		case payload := <-ch:
+			if string(payload) != "t1" {
+				t.Errorf("%s subscriber got %q, want t1", name, payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s subscriber got nothing", name)
+		}
+	}
+	select {
+	case payload := <-other:
+		t.Errorf("subscriber to another topic got %q", payload)
+	default:
+	}
+
+	leave()
+	select {
+	case _, open := <-leaving:
+		if open {
+			t.Error("subscription still delivering after its context ended")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription not closed after its context ended")
+	}
+
+	// first stops reading: publishing must not block on it
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for range 2 * cap(first) {
+			inproc.Publish(ctx, "trades", []byte("t2"))
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a subscriber that is not reading")
+	}
+	if len(first) != cap(first) {
+		t.Errorf("%d events buffered for a slow subscriber, want %d", len(first), cap(first))
+	}
+}
@@ -0,0 +1,354 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+)
+
+// Redis carries commands over a Redis stream read by a consumer group and
+// replies over pub/sub. Every API server instance holds one subscription on
+// its own reply channel and matches replies to waiting requests by ID.
+//
+// An entry is acknowledged only after the handler reports it applied, so a
+// crash mid-command leaves it pending and it is delivered again.
+type Redis struct {
+	Client     *redis.Client
+	Subscriber *redis.Client
+	Stream     string
+	// MaxLen roughly caps how many entries the stream keeps
+	MaxLen int64
+
+	// InstanceID names this API server's reply channel under ReplyPrefix
+	InstanceID  string
+	ReplyPrefix string
+
+	// Group and Consumer identify the engine reading the stream
+	Group    string
+	Consumer string
+	// ClaimIdle is how long an entry must sit unacknowledged at another
+	// consumer before this one takes it over
+	ClaimIdle time.Duration
+
+	mu      sync.Mutex
+	pubsub  *redis.PubSub
+	waiting map[string]chan models.EngineReply
+}
+
+// replyChannel is where the engine publishes replies meant for this instance
+func (t *Redis) replyChannel() string {
+	return t.ReplyPrefix + t.InstanceID
+}
+
+// listen subscribes to the instance channel the first time it is called. A
+// failed attempt is retried by the next request.
+func (t *Redis) listen(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pubsub != nil {
+		return nil
+	}
+
+	pubsub := t.Subscriber.Subscribe(ctx, t.replyChannel())
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+	t.pubsub = pubsub
+	t.waiting = map[string]chan models.EngineReply{}
+
+	go t.dispatch(pubsub.Channel())
+	slog.Info("listening for engine replies", "channel", t.replyChannel())
+	return nil
+}
+
+// dispatch hands each reply to the request waiting on its ID
+func (t *Redis) dispatch(ch <-chan *redis.Message) {
+	for msg := range ch {
+		var reply models.EngineReply
+		if err := json.Unmarshal([]byte(msg.Payload), &reply); err != nil {
+			slog.Warn("dropping malformed reply", "error", err)
+			continue
+		}
+
+		t.mu.Lock()
+		waiter, ok := t.waiting[reply.ID]
+		delete(t.waiting, reply.ID)
+		t.mu.Unlock()
+
+		// A reply nobody waits for belongs to a request that timed out
+		if ok {
+			waiter <- reply
+		}
+	}
+}
+
+func (t *Redis) forget(id string) {
+	t.mu.Lock()
+	delete(t.waiting, id)
+	t.mu.Unlock()
+}
+
+func (t *Redis) Request(ctx context.Context, data models.QueueData) (models.EngineReply, error) {
+	if err := t.listen(ctx); err != nil {
+		return models.EngineReply{}, err
+	}
+	data.ReplyTo = t.replyChannel()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return models.EngineReply{}, err
+	}
+
+	// Register first so the reply cannot arrive before anyone waits for it
+	waiter := make(chan models.EngineReply, 1)
+	t.mu.Lock()
+	t.waiting[data.ID] = waiter
+	t.mu.Unlock()
+
+	if err := t.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: t.Stream,
+		MaxLen: t.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": payload},
+	}).Err(); err != nil {
+		t.forget(data.ID)
+		return models.EngineReply{}, err
+	}
+
+	select {
+	case reply := <-waiter:
+		return reply, nil
+	case <-ctx.Done():
+		t.forget(data.ID)
+		return models.EngineReply{}, ctx.Err()
+	}
+}
+
+// Serve creates the group if needed, redelivers this consumer's own pending
+// entries, then reads new ones and reclaims stale ones until ctx is done
+func (t *Redis) Serve(ctx context.Context, handler Handler) error {
+	// A new group starts from the beginning so requests queued before the
+	// first engine came up are not skipped
+	err := t.Client.XGroupCreateMkStream(ctx, t.Stream, t.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	// Entries delivered to us before a restart come first
+	if err := t.drainPending(ctx, handler); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	lastClaim := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(lastClaim) > t.ClaimIdle {
+			t.reclaim(ctx, handler)
+			lastClaim = time.Now()
+		}
+
+		streams, err := t.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    t.Group,
+			Consumer: t.Consumer,
+			Streams:  []string{t.Stream, ">"},
+			Count:    10,
+			Block:    5 * time.Second,
+		}).Result()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to read from stream", "stream", t.Stream, "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				t.handle(ctx, handler, message)
+			}
+		}
+	}
+}
+
+// drainPending handles entries that were delivered to this consumer but never acknowledged
+func (t *Redis) drainPending(ctx context.Context, handler Handler) error {
+	for {
+		streams, err := t.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    t.Group,
+			Consumer: t.Consumer,
+			Streams:  []string{t.Stream, "0"},
+			Count:    100,
+		}).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		handled := 0
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				if !t.handle(ctx, handler, message) {
+					// Still pending, stop instead of reading it again forever
+					return nil
+				}
+				handled++
+			}
+		}
+		if handled == 0 {
+			return nil
+		}
+	}
+}
+
+// reclaim takes over entries another consumer left pending for too long
+func (t *Redis) reclaim(ctx context.Context, handler Handler) {
+	start := "0-0"
+	for {
+		messages, next, err := t.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   t.Stream,
+			Group:    t.Group,
+			Consumer: t.Consumer,
+			MinIdle:  t.ClaimIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed to reclaim pending entries", "error", err)
+			}
+			return
+		}
+
+		for _, message := range messages {
+			slog.Info("reclaimed pending entry", "entry", message.ID)
+			t.handle(ctx, handler, message)
+		}
+		if next == "0-0" || len(messages) == 0 {
+			return
+		}
+		start = next
+	}
+}
+
+// handle runs one entry, publishes the reply and acknowledges the entry. It
+// reports whether the entry was acknowledged.
+func (t *Redis) handle(ctx context.Context, handler Handler, message redis.XMessage) bool {
+	raw, _ := message.Values["payload"].(string)
+
+	var data models.QueueData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil || data.ID == "" {
+		slog.Warn("dropping malformed request", "entry", message.ID, "error", err)
+		t.Client.XAck(ctx, t.Stream, t.Group, message.ID)
+		return true
+	}
+
+	reply, err := handler(data)
+	if err != nil {
+		slog.Error("leaving request pending", logging.RequestID, data.ID, "error", err)
+		return false
+	}
+	replyJSON, _ := json.Marshal(reply)
+
+	// Older API servers listen on a channel named after the request itself
+	channel := data.ReplyTo
+	if channel == "" {
+		channel = data.ID
+	}
+	if err := t.Client.Publish(ctx, channel, replyJSON).Err(); err != nil {
+		slog.Error("failed to publish reply", logging.RequestID, data.ID, "error", err)
+	}
+
+	if err := t.Client.XAck(ctx, t.Stream, t.Group, message.ID).Err(); err != nil {
+		slog.Error("failed to acknowledge", logging.RequestID, data.ID, "entry", message.ID, "error", err)
+	}
+	return true
+}
+
+// Publish sends an event to every subscriber of the topic
+func (t *Redis) Publish(ctx context.Context, topic string, payload []byte) error {
+	return t.Client.Publish(ctx, "events:"+topic, payload).Err()
+}
+
+func (t *Redis) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	pubsub := t.Subscriber.Subscribe(ctx, "events:"+topic)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	ch := make(chan []byte, 64)
+	go func() {
+		defer close(ch)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- []byte(msg.Payload):
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (t *Redis) Ping(ctx context.Context) error {
+	return t.Client.Ping(ctx).Err()
+}
+
+// Depth counts the entries the group has not read yet plus those read but not
+// acknowledged
+func (t *Redis) Depth(ctx context.Context) (int64, error) {
+	groups, err := t.Client.XInfoGroups(ctx, t.Stream).Result()
+	if err != nil {
+		return 0, err
+	}
+	for _, group := range groups {
+		if group.Name == t.Group {
+			return group.Lag + group.Pending, nil
+		}
+	}
+	// No engine has created the group yet, everything in the stream waits
+	return t.Client.XLen(ctx, t.Stream).Result()
+}
+
+// Close stops listening for replies and closes both clients
+func (t *Redis) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	if t.pubsub != nil {
+		errs = append(errs, t.pubsub.Close())
+		t.pubsub = nil
+	}
+	errs = append(errs, t.Client.Close(), t.Subscriber.Close())
+	return errors.Join(errs...)
+}
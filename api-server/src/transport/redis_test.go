@@ -0,0 +1,216 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/models"
+)
+
+// newRedis returns a transport on server for an API server instance or an
+// engine consumer
+func newRedis(t *testing.T, server *miniredis.Miniredis, consumer string, claimIdle time.Duration) *Redis {
+	t.Helper()
+	transport := &Redis{
+		Client:      redis.NewClient(&redis.Options{Addr: server.Addr()}),
+		Subscriber:  redis.NewClient(&redis.Options{Addr: server.Addr()}),
+		Stream:      "engine",
+		MaxLen:      1000,
+		InstanceID:  "api-" + consumer,
+		ReplyPrefix: "replies:",
+		Group:       "engines",
+		Consumer:    consumer,
+		ClaimIdle:   claimIdle,
+	}
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+// engine counts the commands it runs by request ID
+type engine struct {
+	mu   sync.Mutex
+	runs map[string]int
+}
+
+func newEngine() *engine {
+	return &engine{runs: map[string]int{}}
+}
+
+func (e *engine) handle(data models.QueueData) (models.EngineReply, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runs[data.ID]++
+	return models.EngineReply{ID: data.ID, StatusCode: 200, Data: []byte(`{"id":"` + data.ID + `"}`)}, nil
+}
+
+func (e *engine) count(id string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.runs[id]
+}
+
+// crashing is a handler that fails every command, leaving it pending. crashed
+// is closed on the first one.
+func crashing() (handler Handler, crashed <-chan struct{}) {
+	ch := make(chan struct{})
+	var once sync.Once
+	return func(models.QueueData) (models.EngineReply, error) {
+		once.Do(func() { close(ch) })
+		return models.EngineReply{}, errors.New("engine crashed")
+	}, ch
+}
+
+// serve runs the engine on transport until the returned stop is called.
+// Stopping closes the client too, which ends a blocked read at once.
+func serve(transport *Redis, handler Handler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		transport.Serve(ctx, handler)
+	}()
+	return func() {
+		cancel()
+		transport.Client.Close()
+		<-done
+	}
+}
+
+// request sends a command and waits for its reply for at most wait
+func request(api *Redis, id string, wait time.Duration) (models.EngineReply, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	return api.Request(ctx, models.QueueData{ID: id, Endpoint: "/test", Method: "POST"})
+}
+
+// pending is the number of entries read by the group but not acknowledged
+func pending(t *testing.T, server *miniredis.Miniredis) int64 {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	summary, err := client.XPending(context.Background(), "engine", "engines").Result()
+	if err != nil {
+		t.Fatalf("XPENDING: %v", err)
+	}
+	return summary.Count
+}
+
+func TestMain(m *testing.M) {
+	logging.Setup(io.Discard, "error", "text")
+	os.Exit(m.Run())
+}
+
+// TestRedisLateReply times a request out before any engine runs, then starts
+// one: its reply to the abandoned request must go nowhere, not to the next
+// request waiting on the same instance
+func TestRedisLateReply(t *testing.T) {
+	server := miniredis.RunT(t)
+	api := newRedis(t, server, "api", time.Hour)
+	engine := newEngine()
+
+	if _, err := request(api, "abandoned", 50*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request without an engine = %v, want a timeout", err)
+	}
+	stop := serve(newRedis(t, server, "engine-1", time.Hour), engine.handle)
+	defer stop()
+
+	reply, err := request(api, "next", 5*time.Second)
+	if err != nil {
+		t.Fatalf("next request: %v", err)
+	}
+	if reply.ID != "next" || string(reply.Data) != `{"id":"next"}` {
+		t.Errorf("next request got the reply %+v", reply)
+	}
+	if engine.count("abandoned") != 1 {
+		t.Errorf("abandoned request ran %d times, want once", engine.count("abandoned"))
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.waiting) != 0 {
+		t.Errorf("%d requests still waiting", len(api.waiting))
+	}
+}
+
+// TestRedisPendingAfterRestart crashes the engine on a command, leaving it
+// pending, and restarts it under the same consumer name: the command runs
+// exactly once and its requester still gets the reply
+func TestRedisPendingAfterRestart(t *testing.T) {
+	server := miniredis.RunT(t)
+	api := newRedis(t, server, "api", time.Hour)
+
+	handler, crashed := crashing()
+	stop := serve(newRedis(t, server, "engine-1", time.Hour), handler)
+
+	replies := make(chan models.EngineReply, 1)
+	go func() {
+		reply, _ := request(api, "survivor", 5*time.Second)
+		replies <- reply
+	}()
+	<-crashed
+	stop()
+	if n := pending(t, server); n != 1 {
+		t.Fatalf("%d entries pending after the crash, want 1", n)
+	}
+
+	engine := newEngine()
+	stop = serve(newRedis(t, server, "engine-1", time.Hour), engine.handle)
+	defer stop()
+	if reply := <-replies; reply.ID != "survivor" {
+		t.Fatalf("requester got %+v after the restart", reply)
+	}
+
+	// Another command makes sure the loop went round after the redelivery
+	if _, err := request(api, "after", 5*time.Second); err != nil {
+		t.Fatalf("request after the restart: %v", err)
+	}
+	if engine.count("survivor") != 1 {
+		t.Errorf("pending command ran %d times after the restart, want once", engine.count("survivor"))
+	}
+	if n := pending(t, server); n != 0 {
+		t.Errorf("%d entries still pending", n)
+	}
+}
+
+// TestRedisReclaim has one engine die holding a command and another take it
+// over once it sits idle. Reclaiming again, or the first engine coming back,
+// must not run it a second time.
+func TestRedisReclaim(t *testing.T) {
+	const idle = 20 * time.Millisecond
+	server := miniredis.RunT(t)
+	api := newRedis(t, server, "api", time.Hour)
+	ctx := context.Background()
+
+	go request(api, "stranded", 5*time.Second)
+	handler, crashed := crashing()
+	stop := serve(newRedis(t, server, "engine-1", idle), handler)
+	<-crashed
+	stop()
+
+	engine := newEngine()
+	survivor := newRedis(t, server, "engine-2", idle)
+	time.Sleep(2 * idle)
+	survivor.reclaim(ctx, engine.handle)
+	if engine.count("stranded") != 1 {
+		t.Fatalf("reclaimed command ran %d times, want once", engine.count("stranded"))
+	}
+
+	time.Sleep(2 * idle)
+	survivor.reclaim(ctx, engine.handle)
+	if err := newRedis(t, server, "engine-1", idle).drainPending(ctx, engine.handle); err != nil {
+		t.Fatalf("first engine coming back: %v", err)
+	}
+	if engine.count("stranded") != 1 {
+		t.Errorf("command ran %d times after reclaiming again and a restart, want once", engine.count("stranded"))
+	}
+	if n := pending(t, server); n != 0 {
+		t.Errorf("%d entries still pending", n)
+	}
+}
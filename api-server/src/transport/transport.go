@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/sahilrush/src/models"
+)
+
+// Handler runs a command on the engine. An error means the command was not
+// durably applied and the transport should deliver it again.
+type Handler func(data models.QueueData) (models.EngineReply, error)
+
+// Transport carries commands from the API server to the engine and events
+// from the engine to whoever listens
+type Transport interface {
+	// Request sends a command to the engine and waits for its reply until ctx is done
+	Request(ctx context.Context, data models.QueueData) (models.EngineReply, error)
+	// Serve delivers commands to the handler until ctx is done, it runs on the engine
+	Serve(ctx context.Context, handler Handler) error
+	// Publish broadcasts an event on a topic
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns the events published on a topic until ctx is done
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+	// Ping reports whether the transport can currently carry messages
+	Ping(ctx context.Context) error
+	// Depth is the number of commands waiting for or being run by the engine
+	Depth(ctx context.Context) (int64, error)
+	Close() error
+}
@@ -1 +1,60 @@
 package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sahilrush/src/config"
+	"github.com/sahilrush/src/logging"
+	"github.com/sahilrush/src/metrics"
+	"github.com/sahilrush/src/services"
+	"github.com/sahilrush/src/tracing"
+)
+
+func main() {
+	if err := config.Load(); err != nil {
+		logging.Fatal("invalid configuration", "error", err)
+	}
+	logging.Setup(os.Stderr, config.Current.Log.Level, config.Current.Log.Format)
+
+	if mode := config.Current.Queue.Transport; mode != "redis" {
+		logging.Fatal("the engine binary only serves the redis transport, run the API server alone instead", "transport", mode)
+	}
+
+	// SIGTERM lets the current command finish and the state reach the snapshot
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "opnify-engine")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
+	}
+
+	t := services.NewRedisTransport()
+
+	// the engine has no API of its own, metrics get a small server
+	if addr := config.Current.Engine.MetricsAddr; addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, metrics.Handler()); err != nil {
+				slog.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	slog.Info("engine reading requests", "consumer", t.Consumer, "stream", t.Stream)
+	err = services.RunEngine(ctx, t)
+	if closeErr := t.Close(); closeErr != nil {
+		slog.Warn("failed to close transport", "error", closeErr)
+	}
+	if flushErr := shutdownTracing(context.Background()); flushErr != nil {
+		slog.Warn("failed to flush traces", "error", flushErr)
+	}
+	if err != nil {
+		logging.Fatal("engine stopped", "error", err)
+	}
+	slog.Info("engine stopped")
+}